@@ -8,12 +8,19 @@ import (
 	"os/signal"
 	"service_template/internal/api"
 	"service_template/internal/config"
+	"service_template/internal/middleware"
 	"service_template/internal/repository"
+	"service_template/internal/repository/model"
 	"service_template/internal/server"
 	"service_template/internal/service"
 	"service_template/pkg/cache"
 	"service_template/pkg/db"
+	"service_template/pkg/ipsearch"
+	"service_template/pkg/jwt"
+	"service_template/pkg/lock"
 	"service_template/pkg/logger"
+	"service_template/pkg/policy"
+	"service_template/pkg/signature"
 	"syscall"
 	"time"
 
@@ -43,6 +50,10 @@ func main() {
 		cfg.Log.ErrOutput = append(cfg.Log.Output, os.Stderr)
 	}
 	log := logger.InitLogger(cfg.Log)
+	// 初始化 JWT
+	if err := jwt.Init(cfg.Jwt); err != nil {
+		panic(err)
+	}
 	// 初始化数据库
 	cfg.Database.Debug = *debugMode
 	database, err := db.NewDB(cfg.Database)
@@ -50,6 +61,9 @@ func main() {
 		panic(err)
 	}
 	defer database.Close()
+	if err := database.AutoMigrate(model.Tables...); err != nil {
+		panic(err)
+	}
 	// 初始化存储层
 	repo := repository.NewRepository(database)
 	// 初始化 Redis
@@ -58,8 +72,54 @@ func main() {
 		panic(err)
 	}
 	defer rdb.Close()
+	// 初始化选主
+	var election *lock.LeaderElection
+	if cfg.Election.Enable {
+		election = lock.NewLeaderElection(rdb.(*cache.Redis), cfg.Election, lock.ElectionCallbacks{
+			OnElected: func(ctx context.Context) {
+				log.Infof("instance %s elected as leader", election.Identity())
+			},
+			OnRevoked: func() {
+				log.Warnf("instance %s lost leadership", election.Identity())
+			},
+		})
+		election.Start()
+	}
+	// 初始化分布式锁
+	locker, err := lock.NewLock(cfg.Lock, rdb.(*cache.Redis))
+	if err != nil {
+		panic(err)
+	}
 	// 初始化服务层
-	srv := service.NewService(repo, rdb)
+	// 初始化 refresh token 存储
+	refreshStore, err := jwt.NewRefreshStore(cfg.Jwt.RefreshStore, rdb.(*cache.Redis), repo.RefreshTokenRepository)
+	if err != nil {
+		panic(err)
+	}
+	// 初始化 IP 库，策略引擎和登录会话共用
+	var locate ipsearch.Locator
+	if cfg.IpDatabase != "" {
+		ipsearch.InitIpDatabase(cfg.IpDatabase)
+		locate = ipsearch.Locate
+	}
+	// 初始化策略引擎
+	cfg.Policy.Locate = locate
+	policyEngine, err := policy.NewEngine(cfg.Policy)
+	if err != nil {
+		panic(err)
+	}
+	revoker := jwt.NewRevoker(rdb.(*cache.Redis), jwt.Default())
+	srv := service.NewService(repo, rdb, locker, cfg.Quota, cfg.Rbac, cfg.ApiKey, cfg.User, cfg.TwoFactor, cfg.Oidc, cfg.Session, policyEngine, refreshStore, revoker, locate)
+	srv.QuotaService.Start()
+	// 初始化请求签名校验，nonce 保存在缓存中
+	verifier, err := signature.NewVerifier(cfg.Signature, rdb)
+	if err != nil {
+		panic(err)
+	}
+	rateLimit, err := middleware.RateLimit(cfg.RateLimit, rdb.(*cache.Redis))
+	if err != nil {
+		panic(err)
+	}
 	// 初始化接口层
 	httpApi := api.InitApi(srv)
 	if *debugMode {
@@ -69,10 +129,14 @@ func main() {
 	}
 	// 启动服务
 	engine := gin.New()
-	engine.Use(gin.RecoveryWithWriter(log.GetOutput()))
+	engine.Use(middleware.RequestId(), gin.RecoveryWithWriter(log.GetOutput()), middleware.Cors(cfg.Cors))
 	pprof.Register(engine, pprof.DefaultPrefix)
 	s := server.NewServer(engine, cfg.HttpServer)
-	api.InitRouter(engine, httpApi, srv)
+	api.InitRouter(engine, httpApi, srv, middleware.Signature(verifier),
+		middleware.LoadShedding(cfg.LoadShed, database),
+		rateLimit,
+		middleware.PolicyEnvironment(),
+	)
 	if *debugMode {
 		api.RegisterSwagger(engine, s.Addr())
 	}
@@ -96,6 +160,14 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = s.Shutdown(ctx)
+	if err := srv.QuotaService.Stop(ctx); err != nil {
+		log.Errorf("stop quota service failed: %v", err)
+	}
+	if election != nil {
+		if err := election.Resign(ctx); err != nil {
+			log.Errorf("resign leadership failed: %v", err)
+		}
+	}
 }
 
 func genTestData(db *db.DB) error {
@@ -3,15 +3,35 @@ package api
 import (
 	"github.com/gin-gonic/gin"
 	"service_template/internal/service"
+	"service_template/pkg/jwt"
 )
 
 type Api struct {
-	ExampleApi *ExampleApi
+	ExampleApi   *ExampleApi
+	QuotaApi     *QuotaApi
+	AuthApi      *AuthApi
+	RbacApi      *RbacApi
+	ApiKeyApi    *ApiKeyApi
+	UserApi      *UserApi
+	TwoFactorApi *TwoFactorApi
+	OidcApi      *OidcApi
+	SessionApi   *SessionApi
+	// 未初始化 JWT 时为 nil
+	WellKnownApi *WellKnownApi
 }
 
 func InitApi(srv *service.Service) *Api {
 	return &Api{
-		ExampleApi: NewExampleApi(srv),
+		ExampleApi:   NewExampleApi(srv),
+		QuotaApi:     NewQuotaApi(srv.QuotaService),
+		AuthApi:      NewAuthApi(srv.AuthService),
+		RbacApi:      NewRbacApi(srv.RbacService),
+		ApiKeyApi:    NewApiKeyApi(srv.ApiKeyService),
+		UserApi:      NewUserApi(srv.UserService),
+		TwoFactorApi: NewTwoFactorApi(srv.TwoFactorService),
+		OidcApi:      NewOidcApi(srv.OidcService, srv.AuthService),
+		SessionApi:   NewSessionApi(srv.SessionService),
+		WellKnownApi: NewWellKnownApi(jwt.Default()),
 	}
 }
 
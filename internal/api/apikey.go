@@ -0,0 +1,130 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewApiKeyApi(srv service.ApiKeyService) *ApiKeyApi {
+	return &ApiKeyApi{
+		srv: srv,
+	}
+}
+
+type ApiKeyApi struct {
+	srv service.ApiKeyService
+}
+
+type CreateApiKeyReq struct {
+	Name string `json:"name" binding:"required"`
+	// 只能包含当前用户角色已拥有的权限
+	Scopes []string `json:"scopes"`
+	// 有效期，单位秒，0 表示使用默认有效期
+	Ttl int `json:"ttl"`
+}
+
+// principal 只允许通过 token 登录的用户管理 API key，避免泄露的 key 签发新 key
+func (s *ApiKeyApi) principal(c *gin.Context) (*common.Principal, bool) {
+	p, ok := common.GetPrincipal(c)
+	if !ok {
+		response.HandleResponse(c, errors.Unauthorized, nil, nil)
+		return nil, false
+	}
+	if p.AuthMethod != common.AuthMethodToken {
+		response.HandleResponse(c, errors.Forbidden, nil, nil)
+		return nil, false
+	}
+	return p, true
+}
+
+// List
+// @ID ListApiKeys
+// @Summary 查询当前用户的 API key
+// @Tags api_key
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]model.ApiKey}
+// @Router /api_keys [get]
+func (s *ApiKeyApi) List(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	keys, err := s.srv.List(c.Request.Context(), p.UserId)
+	response.HandleResponse(c, err, nil, keys)
+}
+
+// Create
+// @ID CreateApiKey
+// @Summary 签发 API key，明文只在本次返回
+// @Tags api_key
+// @Param token header string true "token"
+// @Param body body CreateApiKeyReq true "API key"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=service.IssuedApiKey}
+// @Router /api_keys [post]
+func (s *ApiKeyApi) Create(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	req := &CreateApiKeyReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	key, err := s.srv.Issue(c.Request.Context(), p, req.Name, req.Scopes, req.Ttl)
+	response.HandleResponse(c, err, req, key)
+}
+
+// Rotate
+// @ID RotateApiKey
+// @Summary 轮换 API key，旧 key 在宽限期后失效
+// @Tags api_key
+// @Param token header string true "token"
+// @Param id path int true "API key ID"
+// @Produce json
+// @Success 200 {object} response.Response{data=service.IssuedApiKey}
+// @Router /api_keys/{id}/rotate [post]
+func (s *ApiKeyApi) Rotate(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	key, err := s.srv.Rotate(c.Request.Context(), p.UserId, id)
+	response.HandleResponse(c, err, id, key)
+}
+
+// Revoke
+// @ID RevokeApiKey
+// @Summary 吊销 API key
+// @Tags api_key
+// @Param token header string true "token"
+// @Param id path int true "API key ID"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /api_keys/{id} [delete]
+func (s *ApiKeyApi) Revoke(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err = s.srv.Revoke(c.Request.Context(), p.UserId, id)
+	response.HandleResponse(c, err, id, nil)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewAuthApi(srv service.AuthService) *AuthApi {
+	return &AuthApi{
+		srv: srv,
+	}
+}
+
+type AuthApi struct {
+	srv service.AuthService
+}
+
+type LoginReq struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type TwoFactorVerifyReq struct {
+	Challenge string `json:"challenge" binding:"required"`
+	// 验证器中的验证码或恢复码
+	Code string `json:"code" binding:"required"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Login
+// @ID Login
+// @Summary 登录，返回 access token 和 refresh token；开启二次验证的用户返回 challenge
+// @Tags auth
+// @Param X-Device-Name header string false "设备名称"
+// @Param body body LoginReq true "用户名和密码"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=service.LoginResult}
+// @Router /auth/login [post]
+func (s *AuthApi) Login(c *gin.Context) {
+	req := &LoginReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	result, err := s.srv.Login(c.Request.Context(), req.Username, req.Password, device(c))
+	response.HandleResponse(c, err, LoginReq{Username: req.Username}, result)
+}
+
+// VerifyTwoFactor
+// @ID VerifyTwoFactor
+// @Summary 使用登录返回的 challenge 完成二次验证，返回 access token 和 refresh token
+// @Tags auth
+// @Param X-Device-Name header string false "设备名称"
+// @Param body body TwoFactorVerifyReq true "challenge 和验证码"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=jwt.TokenPair}
+// @Router /auth/2fa/verify [post]
+func (s *AuthApi) VerifyTwoFactor(c *gin.Context) {
+	req := &TwoFactorVerifyReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	pair, err := s.srv.VerifyTwoFactor(c.Request.Context(), req.Challenge, req.Code, device(c))
+	response.HandleResponse(c, err, nil, pair)
+}
+
+// Refresh
+// @ID Refresh
+// @Summary 使用 refresh token 换取新的 token 对，旧 refresh token 随即失效
+// @Tags auth
+// @Param body body RefreshReq true "refresh token"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=jwt.TokenPair}
+// @Router /auth/refresh [post]
+func (s *AuthApi) Refresh(c *gin.Context) {
+	req := &RefreshReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	pair, err := s.srv.Refresh(c.Request.Context(), req.RefreshToken)
+	response.HandleResponse(c, err, nil, pair)
+}
+
+// Logout
+// @ID Logout
+// @Summary 登出，吊销 refresh token 所在的登录会话，并吊销请求头中的 access token
+// @Tags auth
+// @Param token header string false "token"
+// @Param body body RefreshReq true "refresh token"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /auth/logout [post]
+func (s *AuthApi) Logout(c *gin.Context) {
+	req := &RefreshReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.Logout(c.Request.Context(), req.RefreshToken, c.GetHeader(common.TokenHeader))
+	response.HandleResponse(c, err, nil, nil)
+}
+
+// LogoutAll
+// @ID LogoutAll
+// @Summary 在所有设备上登出
+// @Tags auth
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /auth/logout_all [post]
+func (s *AuthApi) LogoutAll(c *gin.Context) {
+	err := s.srv.LogoutAll(c.Request.Context(), common.GetUserId(c))
+	response.HandleResponse(c, err, nil, nil)
+}
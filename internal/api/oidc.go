@@ -0,0 +1,169 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewOidcApi(srv service.OidcService, auth service.AuthService) *OidcApi {
+	return &OidcApi{
+		srv:  srv,
+		auth: auth,
+	}
+}
+
+type OidcApi struct {
+	srv  service.OidcService
+	auth service.AuthService
+}
+
+type AuthUrlResp struct {
+	Url string `json:"url"`
+}
+
+// OidcCallbackReq 提供方跳转回 redirect_url 时携带的参数，由前端提交
+type OidcCallbackReq struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// userId 只允许通过 token 登录的用户管理外部身份
+func (s *OidcApi) userId(c *gin.Context) (int, bool) {
+	p, ok := common.GetPrincipal(c)
+	if !ok {
+		response.HandleResponse(c, errors.Unauthorized, nil, nil)
+		return 0, false
+	}
+	if p.AuthMethod != common.AuthMethodToken {
+		response.HandleResponse(c, errors.Forbidden, nil, nil)
+		return 0, false
+	}
+	return p.UserId, true
+}
+
+// Providers
+// @ID OidcProviders
+// @Summary 查询可用于登录的 OIDC 提供方
+// @Tags auth
+// @Produce json
+// @Success 200 {object} response.Response{data=[]string}
+// @Router /auth/oidc/providers [get]
+func (s *OidcApi) Providers(c *gin.Context) {
+	response.HandleResponse(c, nil, nil, s.srv.Providers())
+}
+
+// AuthUrl
+// @ID OidcAuthUrl
+// @Summary 返回提供方的授权地址，前端跳转到该地址登录
+// @Tags auth
+// @Param provider path string true "提供方"
+// @Produce json
+// @Success 200 {object} response.Response{data=AuthUrlResp}
+// @Router /auth/oidc/{provider}/authorize [get]
+func (s *OidcApi) AuthUrl(c *gin.Context) {
+	u, err := s.srv.AuthURL(c.Request.Context(), c.Param("provider"))
+	response.HandleResponse(c, err, nil, AuthUrlResp{Url: u})
+}
+
+// Callback
+// @ID OidcCallback
+// @Summary 使用提供方回调中的 state 和 code 登录，开启二次验证的用户返回 challenge
+// @Tags auth
+// @Param provider path string true "提供方"
+// @Param X-Device-Name header string false "设备名称"
+// @Param body body OidcCallbackReq true "回调参数"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=service.LoginResult}
+// @Router /auth/oidc/{provider}/callback [post]
+func (s *OidcApi) Callback(c *gin.Context) {
+	req := &OidcCallbackReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	result, err := s.auth.LoginOidc(c.Request.Context(), c.Param("provider"), req.State, req.Code, device(c))
+	response.HandleResponse(c, err, nil, result)
+}
+
+// Identities
+// @ID ListIdentities
+// @Summary 查询当前用户关联的外部身份
+// @Tags user
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]model.UserIdentity}
+// @Router /users/me/identities [get]
+func (s *OidcApi) Identities(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	identities, err := s.srv.Identities(c.Request.Context(), userId)
+	response.HandleResponse(c, err, nil, identities)
+}
+
+// LinkUrl
+// @ID IdentityLinkUrl
+// @Summary 返回关联外部身份的授权地址，回调参数提交到 /users/me/identities/{provider}
+// @Tags user
+// @Param token header string true "token"
+// @Param provider path string true "提供方"
+// @Produce json
+// @Success 200 {object} response.Response{data=AuthUrlResp}
+// @Router /users/me/identities/{provider}/authorize [post]
+func (s *OidcApi) LinkUrl(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	u, err := s.srv.LinkURL(c.Request.Context(), c.Param("provider"), userId)
+	response.HandleResponse(c, err, nil, AuthUrlResp{Url: u})
+}
+
+// Link
+// @ID LinkIdentity
+// @Summary 使用提供方回调中的 state 和 code 关联外部身份
+// @Tags user
+// @Param token header string true "token"
+// @Param provider path string true "提供方"
+// @Param body body OidcCallbackReq true "回调参数"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=model.UserIdentity}
+// @Router /users/me/identities/{provider} [post]
+func (s *OidcApi) Link(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	req := &OidcCallbackReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	identity, err := s.srv.Link(c.Request.Context(), userId, c.Param("provider"), req.State, req.Code)
+	response.HandleResponse(c, err, nil, identity)
+}
+
+// Unlink
+// @ID UnlinkIdentity
+// @Summary 解除关联的外部身份
+// @Tags user
+// @Param token header string true "token"
+// @Param provider path string true "提供方"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /users/me/identities/{provider} [delete]
+func (s *OidcApi) Unlink(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	err := s.srv.Unlink(c.Request.Context(), userId, c.Param("provider"))
+	response.HandleResponse(c, err, nil, nil)
+}
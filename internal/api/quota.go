@@ -0,0 +1,38 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewQuotaApi(srv service.QuotaService) *QuotaApi {
+	return &QuotaApi{
+		srv: srv,
+	}
+}
+
+type QuotaApi struct {
+	srv service.QuotaService
+}
+
+// Usage
+// @ID QuotaUsage
+// @Summary 查询当前租户的配额用量
+// @Tags quota
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=service.QuotaResult}
+// @Router /quota/usage [get]
+func (s *QuotaApi) Usage(c *gin.Context) {
+	tenantId := common.GetTenantId(c)
+	if tenantId == "" {
+		response.HandleResponse(c, errors.Unauthorized, nil, nil)
+		return
+	}
+	res, err := s.srv.Usage(c.Request.Context(), tenantId)
+	response.HandleResponse(c, err, nil, res)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionRbacManage 管理角色和权限所需的权限
+const PermissionRbacManage = "rbac:manage"
+
+func NewRbacApi(srv service.RbacService) *RbacApi {
+	return &RbacApi{
+		srv: srv,
+	}
+}
+
+type RbacApi struct {
+	srv service.RbacService
+}
+
+type CreateRoleReq struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type CreatePermissionReq struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type GrantReq struct {
+	Permission string `json:"permission" binding:"required"`
+}
+
+type AssignRoleReq struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ListRoles
+// @ID ListRoles
+// @Summary 查询角色
+// @Tags rbac
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]model.Role}
+// @Router /admin/rbac/roles [get]
+func (s *RbacApi) ListRoles(c *gin.Context) {
+	roles, err := s.srv.ListRoles(c.Request.Context())
+	response.HandleResponse(c, err, nil, roles)
+}
+
+// CreateRole
+// @ID CreateRole
+// @Summary 创建角色
+// @Tags rbac
+// @Param token header string true "token"
+// @Param body body CreateRoleReq true "角色"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=model.Role}
+// @Router /admin/rbac/roles [post]
+func (s *RbacApi) CreateRole(c *gin.Context) {
+	req := &CreateRoleReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	role, err := s.srv.CreateRole(c.Request.Context(), req.Name, req.Description)
+	response.HandleResponse(c, err, req, role)
+}
+
+// DeleteRole
+// @ID DeleteRole
+// @Summary 删除角色
+// @Tags rbac
+// @Param token header string true "token"
+// @Param role path string true "角色"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /admin/rbac/roles/{role} [delete]
+func (s *RbacApi) DeleteRole(c *gin.Context) {
+	err := s.srv.DeleteRole(c.Request.Context(), c.Param("role"))
+	response.HandleResponse(c, err, c.Param("role"), nil)
+}
+
+// RolePermissions
+// @ID RolePermissions
+// @Summary 查询角色的权限
+// @Tags rbac
+// @Param token header string true "token"
+// @Param role path string true "角色"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]string}
+// @Router /admin/rbac/roles/{role}/permissions [get]
+func (s *RbacApi) RolePermissions(c *gin.Context) {
+	permissions, err := s.srv.RolePermissions(c.Request.Context(), c.Param("role"))
+	response.HandleResponse(c, err, c.Param("role"), permissions)
+}
+
+// Grant
+// @ID Grant
+// @Summary 为角色授予权限
+// @Tags rbac
+// @Param token header string true "token"
+// @Param role path string true "角色"
+// @Param body body GrantReq true "权限"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /admin/rbac/roles/{role}/permissions [post]
+func (s *RbacApi) Grant(c *gin.Context) {
+	req := &GrantReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.Grant(c.Request.Context(), c.Param("role"), req.Permission)
+	response.HandleResponse(c, err, req, nil)
+}
+
+// Revoke
+// @ID Revoke
+// @Summary 撤销角色的权限
+// @Tags rbac
+// @Param token header string true "token"
+// @Param role path string true "角色"
+// @Param permission path string true "权限"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /admin/rbac/roles/{role}/permissions/{permission} [delete]
+func (s *RbacApi) Revoke(c *gin.Context) {
+	err := s.srv.Revoke(c.Request.Context(), c.Param("role"), c.Param("permission"))
+	response.HandleResponse(c, err, nil, nil)
+}
+
+// ListPermissions
+// @ID ListPermissions
+// @Summary 查询权限
+// @Tags rbac
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]model.Permission}
+// @Router /admin/rbac/permissions [get]
+func (s *RbacApi) ListPermissions(c *gin.Context) {
+	permissions, err := s.srv.ListPermissions(c.Request.Context())
+	response.HandleResponse(c, err, nil, permissions)
+}
+
+// CreatePermission
+// @ID CreatePermission
+// @Summary 创建权限，名称格式为 资源:操作
+// @Tags rbac
+// @Param token header string true "token"
+// @Param body body CreatePermissionReq true "权限"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=model.Permission}
+// @Router /admin/rbac/permissions [post]
+func (s *RbacApi) CreatePermission(c *gin.Context) {
+	req := &CreatePermissionReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	permission, err := s.srv.CreatePermission(c.Request.Context(), req.Name, req.Description)
+	response.HandleResponse(c, err, req, permission)
+}
+
+// DeletePermission
+// @ID DeletePermission
+// @Summary 删除权限
+// @Tags rbac
+// @Param token header string true "token"
+// @Param permission path string true "权限"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /admin/rbac/permissions/{permission} [delete]
+func (s *RbacApi) DeletePermission(c *gin.Context) {
+	err := s.srv.DeletePermission(c.Request.Context(), c.Param("permission"))
+	response.HandleResponse(c, err, c.Param("permission"), nil)
+}
+
+// UserRoles
+// @ID UserRoles
+// @Summary 查询用户的角色
+// @Tags rbac
+// @Param token header string true "token"
+// @Param user_id path int true "用户 ID"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]string}
+// @Router /admin/rbac/users/{user_id}/roles [get]
+func (s *RbacApi) UserRoles(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	roles, err := s.srv.UserRoles(c.Request.Context(), userId)
+	response.HandleResponse(c, err, userId, roles)
+}
+
+// AssignRole
+// @ID AssignRole
+// @Summary 为用户分配角色，用户刷新 token 后生效
+// @Tags rbac
+// @Param token header string true "token"
+// @Param user_id path int true "用户 ID"
+// @Param body body AssignRoleReq true "角色"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /admin/rbac/users/{user_id}/roles [post]
+func (s *RbacApi) AssignRole(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	req := &AssignRoleReq{}
+	if err != nil || c.ShouldBindJSON(req) != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err = s.srv.AssignRole(c.Request.Context(), userId, req.Role)
+	response.HandleResponse(c, err, req, nil)
+}
+
+// UnassignRole
+// @ID UnassignRole
+// @Summary 移除用户的角色，用户刷新 token 后生效
+// @Tags rbac
+// @Param token header string true "token"
+// @Param user_id path int true "用户 ID"
+// @Param role path string true "角色"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /admin/rbac/users/{user_id}/roles/{role} [delete]
+func (s *RbacApi) UnassignRole(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err = s.srv.UnassignRole(c.Request.Context(), userId, c.Param("role"))
+	response.HandleResponse(c, err, nil, nil)
+}
@@ -10,11 +10,66 @@ import (
 	"service_template/internal/service"
 )
 
-func InitRouter(engine *gin.Engine, api *Api, srv *service.Service) {
-	auth := func(token string) (int, error) {
-		return 0, nil
-	}
-	_ = engine.Group(common.ApiPrefix, middleware.Authentication(auth))
+func InitRouter(engine *gin.Engine, api *Api, srv *service.Service, signature gin.HandlerFunc, middlewares ...gin.HandlerFunc) {
+	public := engine.Group(common.ApiPrefix, middlewares...)
+	public.POST("/auth/login", api.AuthApi.Login)
+	public.POST("/auth/refresh", api.AuthApi.Refresh)
+	public.POST("/auth/logout", api.AuthApi.Logout)
+	public.POST("/auth/2fa/verify", api.AuthApi.VerifyTwoFactor)
+	public.GET("/auth/oidc/providers", api.OidcApi.Providers)
+	public.GET("/auth/oidc/:provider/authorize", api.OidcApi.AuthUrl)
+	public.POST("/auth/oidc/:provider/callback", api.OidcApi.Callback)
+	public.POST("/users/register", api.UserApi.Register)
+	public.POST("/users/verify_email", api.UserApi.VerifyEmail)
+	public.POST("/users/resend_verify_email", api.UserApi.ResendVerifyEmail)
+	public.POST("/users/password/forgot", api.UserApi.ForgotPassword)
+	public.POST("/users/password/reset", api.UserApi.ResetPassword)
+	// 使用请求签名认证的合作方接口注册在该分组下
+	_ = engine.Group(common.ApiPrefix+"/partner", append([]gin.HandlerFunc{signature}, middlewares...)...)
+	wellKnown := engine.Group("/.well-known", middlewares...)
+	wellKnown.GET("/jwks.json", api.WellKnownApi.JWKS)
+	wellKnown.GET("/openid-configuration", api.WellKnownApi.Discovery)
+	authentication := middleware.Authentication(
+		middleware.TokenAuthenticator(srv.AuthService.Authenticate, srv.Revoker, srv.SessionService.Validate),
+		middleware.ApiKeyAuthenticator(srv.ApiKeyService.Authenticate),
+	)
+	// 账号和安全相关的接口不消耗配额，超出配额后仍可登出、吊销会话和查询用量
+	authed := engine.Group(common.ApiPrefix, append([]gin.HandlerFunc{authentication}, middlewares...)...)
+	authed.POST("/auth/logout_all", api.AuthApi.LogoutAll)
+	authed.GET("/auth/2fa", api.TwoFactorApi.Status)
+	authed.POST("/auth/2fa/enroll", api.TwoFactorApi.Enroll)
+	authed.POST("/auth/2fa/confirm", api.TwoFactorApi.Confirm)
+	authed.POST("/auth/2fa/disable", api.TwoFactorApi.Disable)
+	authed.POST("/auth/2fa/recovery_codes", api.TwoFactorApi.RegenerateRecoveryCodes)
+	authed.GET("/sessions", api.SessionApi.List)
+	authed.DELETE("/sessions", api.SessionApi.RevokeOthers)
+	authed.DELETE("/sessions/:id", api.SessionApi.Revoke)
+	authed.GET("/quota/usage", api.QuotaApi.Usage)
+	authed.GET("/users/me", api.UserApi.Me)
+	authed.GET("/users/me/identities", api.OidcApi.Identities)
+	authed.POST("/users/me/identities/:provider/authorize", api.OidcApi.LinkUrl)
+	authed.POST("/users/me/identities/:provider", api.OidcApi.Link)
+	authed.DELETE("/users/me/identities/:provider", api.OidcApi.Unlink)
+	authed.GET("/api_keys", api.ApiKeyApi.List)
+	authed.POST("/api_keys", api.ApiKeyApi.Create)
+	authed.POST("/api_keys/:id/rotate", api.ApiKeyApi.Rotate)
+	authed.DELETE("/api_keys/:id", api.ApiKeyApi.Revoke)
+	admin := authed.Group("/admin/rbac", middleware.RequirePermission(srv.RbacService, PermissionRbacManage))
+	admin.GET("/roles", api.RbacApi.ListRoles)
+	admin.POST("/roles", api.RbacApi.CreateRole)
+	admin.DELETE("/roles/:role", api.RbacApi.DeleteRole)
+	admin.GET("/roles/:role/permissions", api.RbacApi.RolePermissions)
+	admin.POST("/roles/:role/permissions", api.RbacApi.Grant)
+	admin.DELETE("/roles/:role/permissions/:permission", api.RbacApi.Revoke)
+	admin.GET("/permissions", api.RbacApi.ListPermissions)
+	admin.POST("/permissions", api.RbacApi.CreatePermission)
+	admin.DELETE("/permissions/:permission", api.RbacApi.DeletePermission)
+	admin.GET("/users/:user_id/roles", api.RbacApi.UserRoles)
+	admin.POST("/users/:user_id/roles", api.RbacApi.AssignRole)
+	admin.DELETE("/users/:user_id/roles/:role", api.RbacApi.UnassignRole)
+	// 需要消耗配额的业务接口注册在该分组下
+	metered := authed.Group("", middleware.Quota(srv.QuotaService))
+	metered.GET("/example", api.ExampleApi.Example)
 }
 
 func RegisterSwagger(engine *gin.Engine, host string) {
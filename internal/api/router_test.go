@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/repository/model"
+	"service_template/internal/response"
+	"service_template/internal/service"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeAuthService struct {
+	service.AuthService
+}
+
+// Authenticate token 即用户的角色
+func (fakeAuthService) Authenticate(ctx context.Context, token string) (*common.Principal, error) {
+	if token == "invalid" {
+		return nil, errors.Unauthorized
+	}
+	return &common.Principal{AuthMethod: common.AuthMethodToken, UserId: 2, Roles: []string{token}}, nil
+}
+
+type fakeSessionService struct {
+	service.SessionService
+}
+
+func (fakeSessionService) Validate(ctx context.Context, userId int, sessionId, ip string) error {
+	return nil
+}
+
+type fakeApiKeyService struct {
+	service.ApiKeyService
+}
+
+func (fakeApiKeyService) Authenticate(ctx context.Context, key, ip string) (*common.Principal, error) {
+	return &common.Principal{AuthMethod: common.AuthMethodApiKey, UserId: 1, TenantId: "tenant"}, nil
+}
+
+// fakeRbacService admin 角色拥有全部权限
+type fakeRbacService struct {
+	service.RbacService
+}
+
+func (fakeRbacService) Authorize(ctx context.Context, roles []string, permissions ...string) (bool, error) {
+	return len(roles) == 1 && roles[0] == "admin", nil
+}
+
+func (fakeRbacService) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	return []*model.Role{{Name: "admin"}}, nil
+}
+
+// fakeQuotaService 记录消耗配额的租户，allowed 为 false 时拒绝
+type fakeQuotaService struct {
+	service.QuotaService
+	allowed  bool
+	consumed []string
+}
+
+func (s *fakeQuotaService) Consume(ctx context.Context, tenantId string, n int64) (*service.QuotaResult, error) {
+	s.consumed = append(s.consumed, tenantId)
+	return &service.QuotaResult{Allowed: s.allowed}, nil
+}
+
+func (s *fakeQuotaService) Usage(ctx context.Context, tenantId string) (*service.QuotaResult, error) {
+	return &service.QuotaResult{Allowed: true}, nil
+}
+
+func newTestRouter(quota *fakeQuotaService) *gin.Engine {
+	srv := &service.Service{
+		AuthService:    fakeAuthService{},
+		SessionService: fakeSessionService{},
+		ApiKeyService:  fakeApiKeyService{},
+		QuotaService:   quota,
+		RbacService:    fakeRbacService{},
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	InitRouter(engine, InitApi(srv), srv, func(c *gin.Context) { c.Next() })
+	return engine
+}
+
+func get(engine *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(common.ApiKeyHeader, "key")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestQuotaRoutes(t *testing.T) {
+	quota := &fakeQuotaService{}
+	engine := newTestRouter(quota)
+
+	// 业务接口消耗配额，超出后拒绝
+	w := get(engine, "/example")
+	resp := response.Response{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Code != errors.QuotaExceeded.Code() || len(quota.consumed) != 1 || quota.consumed[0] != "tenant" {
+		t.Fatalf("expected quota exceeded, got %s, consumed %v", w.Body.String(), quota.consumed)
+	}
+	quota.allowed = true
+	if w := get(engine, "/example"); w.Code != http.StatusOK || len(quota.consumed) != 2 {
+		t.Fatalf("expected example to pass, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 查询用量不消耗配额
+	quota.allowed = false
+	w = get(engine, "/quota/usage")
+	resp = response.Response{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Code != errors.Success.Code() || len(quota.consumed) != 2 {
+		t.Fatalf("expected usage without consuming quota, got %s, consumed %v", w.Body.String(), quota.consumed)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	engine := newTestRouter(&fakeQuotaService{allowed: true})
+	cases := []struct {
+		name    string
+		headers map[string]string
+		code    int
+	}{
+		{"anonymous", nil, errors.Unauthorized.Code()},
+		{"invalid token", map[string]string{common.TokenHeader: "invalid"}, errors.Unauthorized.Code()},
+		{"without permission", map[string]string{common.TokenHeader: "viewer"}, errors.Forbidden.Code()},
+		{"admin", map[string]string{common.TokenHeader: "admin"}, errors.Success.Code()},
+		// API key 没有 rbac:manage scope
+		{"api key", map[string]string{common.ApiKeyHeader: "key"}, errors.Forbidden.Code()},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/admin/rbac/roles", nil)
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		resp := response.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Code != c.code {
+			t.Errorf("%s: expect code %d, got %s", c.name, c.code, w.Body.String())
+		}
+	}
+}
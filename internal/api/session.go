@@ -0,0 +1,98 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// device 登录请求的设备信息
+func device(c *gin.Context) service.Device {
+	return service.Device{
+		Name:      c.GetHeader(common.DeviceHeader),
+		UserAgent: c.Request.UserAgent(),
+		Ip:        c.ClientIP(),
+	}
+}
+
+func NewSessionApi(srv service.SessionService) *SessionApi {
+	return &SessionApi{
+		srv: srv,
+	}
+}
+
+type SessionApi struct {
+	srv service.SessionService
+}
+
+// principal 会话只属于通过 token 登录的用户
+func (s *SessionApi) principal(c *gin.Context) (*common.Principal, bool) {
+	p, ok := common.GetPrincipal(c)
+	if !ok {
+		response.HandleResponse(c, errors.Unauthorized, nil, nil)
+		return nil, false
+	}
+	if p.AuthMethod != common.AuthMethodToken {
+		response.HandleResponse(c, errors.Forbidden, nil, nil)
+		return nil, false
+	}
+	return p, true
+}
+
+// List
+// @ID ListSessions
+// @Summary 查询当前用户已登录的设备
+// @Tags session
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=[]model.Session}
+// @Router /sessions [get]
+func (s *SessionApi) List(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	sessions, err := s.srv.List(c.Request.Context(), p.UserId)
+	for _, session := range sessions {
+		session.Current = session.Id == p.SessionId
+	}
+	response.HandleResponse(c, err, nil, sessions)
+}
+
+// Revoke
+// @ID RevokeSession
+// @Summary 退出指定设备的登录
+// @Tags session
+// @Param token header string true "token"
+// @Param id path string true "会话 ID"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /sessions/{id} [delete]
+func (s *SessionApi) Revoke(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	err := s.srv.Revoke(c.Request.Context(), p.UserId, c.Param("id"))
+	response.HandleResponse(c, err, nil, nil)
+}
+
+// RevokeOthers
+// @ID RevokeOtherSessions
+// @Summary 退出当前设备以外的所有登录
+// @Tags session
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /sessions [delete]
+func (s *SessionApi) RevokeOthers(c *gin.Context) {
+	p, ok := s.principal(c)
+	if !ok {
+		return
+	}
+	err := s.srv.RevokeOthers(c.Request.Context(), p.UserId, p.SessionId)
+	response.HandleResponse(c, err, nil, nil)
+}
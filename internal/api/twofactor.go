@@ -0,0 +1,145 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewTwoFactorApi(srv service.TwoFactorService) *TwoFactorApi {
+	return &TwoFactorApi{
+		srv: srv,
+	}
+}
+
+type TwoFactorApi struct {
+	srv service.TwoFactorService
+}
+
+type TwoFactorCodeReq struct {
+	// 验证器中的验证码，关闭二次验证时也可使用恢复码
+	Code string `json:"code" binding:"required"`
+}
+
+// userId 只允许通过 token 登录的用户管理二次验证，API key 不可用
+func (s *TwoFactorApi) userId(c *gin.Context) (int, bool) {
+	p, ok := common.GetPrincipal(c)
+	if !ok {
+		response.HandleResponse(c, errors.Unauthorized, nil, nil)
+		return 0, false
+	}
+	if p.AuthMethod != common.AuthMethodToken {
+		response.HandleResponse(c, errors.Forbidden, nil, nil)
+		return 0, false
+	}
+	return p.UserId, true
+}
+
+// Status
+// @ID TwoFactorStatus
+// @Summary 查询二次验证状态和剩余恢复码数量
+// @Tags auth
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=service.TwoFactorStatus}
+// @Router /auth/2fa [get]
+func (s *TwoFactorApi) Status(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	status, err := s.srv.Status(c.Request.Context(), userId)
+	response.HandleResponse(c, err, nil, status)
+}
+
+// Enroll
+// @ID TwoFactorEnroll
+// @Summary 生成 TOTP 密钥和二维码内容，确认后生效
+// @Tags auth
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=service.Enrollment}
+// @Router /auth/2fa/enroll [post]
+func (s *TwoFactorApi) Enroll(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	enrollment, err := s.srv.Enroll(c.Request.Context(), userId)
+	response.HandleResponse(c, err, nil, enrollment)
+}
+
+// Confirm
+// @ID TwoFactorConfirm
+// @Summary 校验验证码后开启二次验证，返回恢复码，恢复码只返回这一次
+// @Tags auth
+// @Param token header string true "token"
+// @Param body body TwoFactorCodeReq true "验证码"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=[]string}
+// @Router /auth/2fa/confirm [post]
+func (s *TwoFactorApi) Confirm(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	req := &TwoFactorCodeReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	codes, err := s.srv.Confirm(c.Request.Context(), userId, req.Code)
+	response.HandleResponse(c, err, nil, codes)
+}
+
+// Disable
+// @ID TwoFactorDisable
+// @Summary 关闭二次验证
+// @Tags auth
+// @Param token header string true "token"
+// @Param body body TwoFactorCodeReq true "验证码或恢复码"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /auth/2fa/disable [post]
+func (s *TwoFactorApi) Disable(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	req := &TwoFactorCodeReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.Disable(c.Request.Context(), userId, req.Code)
+	response.HandleResponse(c, err, nil, nil)
+}
+
+// RegenerateRecoveryCodes
+// @ID TwoFactorRegenerateRecoveryCodes
+// @Summary 重新生成恢复码，旧恢复码失效
+// @Tags auth
+// @Param token header string true "token"
+// @Param body body TwoFactorCodeReq true "验证码"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=[]string}
+// @Router /auth/2fa/recovery_codes [post]
+func (s *TwoFactorApi) RegenerateRecoveryCodes(c *gin.Context) {
+	userId, ok := s.userId(c)
+	if !ok {
+		return
+	}
+	req := &TwoFactorCodeReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	codes, err := s.srv.RegenerateRecoveryCodes(c.Request.Context(), userId, req.Code)
+	response.HandleResponse(c, err, nil, codes)
+}
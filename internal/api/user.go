@@ -0,0 +1,147 @@
+package api
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewUserApi(srv service.UserService) *UserApi {
+	return &UserApi{
+		srv: srv,
+	}
+}
+
+type UserApi struct {
+	srv service.UserService
+}
+
+type RegisterReq struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type TokenReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type EmailReq struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Register
+// @ID Register
+// @Summary 注册用户，并发送邮箱验证邮件
+// @Tags user
+// @Param body body RegisterReq true "用户信息"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=model.User}
+// @Router /users/register [post]
+func (s *UserApi) Register(c *gin.Context) {
+	req := &RegisterReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	user, err := s.srv.Register(c.Request.Context(), req.Username, req.Email, req.Password)
+	response.HandleResponse(c, err, RegisterReq{Username: req.Username, Email: req.Email}, user)
+}
+
+// Me
+// @ID Me
+// @Summary 查询当前用户
+// @Tags user
+// @Param token header string true "token"
+// @Produce json
+// @Success 200 {object} response.Response{data=model.User}
+// @Router /users/me [get]
+func (s *UserApi) Me(c *gin.Context) {
+	user, err := s.srv.Get(c.Request.Context(), common.GetUserId(c))
+	response.HandleResponse(c, err, nil, user)
+}
+
+// VerifyEmail
+// @ID VerifyEmail
+// @Summary 验证邮箱
+// @Tags user
+// @Param body body TokenReq true "邮件中的 token"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /users/verify_email [post]
+func (s *UserApi) VerifyEmail(c *gin.Context) {
+	req := &TokenReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.VerifyEmail(c.Request.Context(), req.Token)
+	response.HandleResponse(c, err, nil, nil)
+}
+
+// ResendVerifyEmail
+// @ID ResendVerifyEmail
+// @Summary 重新发送邮箱验证邮件
+// @Tags user
+// @Param body body EmailReq true "邮箱"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /users/resend_verify_email [post]
+func (s *UserApi) ResendVerifyEmail(c *gin.Context) {
+	req := &EmailReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.ResendVerifyEmail(c.Request.Context(), req.Email)
+	response.HandleResponse(c, err, req, nil)
+}
+
+// ForgotPassword
+// @ID ForgotPassword
+// @Summary 发送重置密码邮件
+// @Tags user
+// @Param body body EmailReq true "邮箱"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /users/password/forgot [post]
+func (s *UserApi) ForgotPassword(c *gin.Context) {
+	req := &EmailReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.ForgotPassword(c.Request.Context(), req.Email)
+	response.HandleResponse(c, err, req, nil)
+}
+
+// ResetPassword
+// @ID ResetPassword
+// @Summary 使用邮件中的 token 重置密码，已登录的会话随之失效
+// @Tags user
+// @Param body body ResetPasswordReq true "token 和新密码"
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /users/password/reset [post]
+func (s *UserApi) ResetPassword(c *gin.Context) {
+	req := &ResetPasswordReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.HandleResponse(c, errors.BadParameters, nil, nil)
+		return
+	}
+	err := s.srv.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	response.HandleResponse(c, err, nil, nil)
+}
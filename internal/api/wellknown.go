@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"service_template/pkg/jwt"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewWellKnownApi(manager *jwt.Manager) *WellKnownApi {
+	return &WellKnownApi{
+		manager: manager,
+	}
+}
+
+// WellKnownApi 公开验证 token 所需的公钥，只在使用非对称算法时可用。
+// 返回标准格式，不使用 response.Response 包装。
+type WellKnownApi struct {
+	manager *jwt.Manager
+}
+
+func (s *WellKnownApi) jwks() *jwt.JWKS {
+	if s.manager == nil {
+		return nil
+	}
+	jwks := s.manager.JWKS()
+	if len(jwks.Keys) == 0 {
+		return nil
+	}
+	return jwks
+}
+
+// JWKS
+// @ID JWKS
+// @Summary 验证 token 使用的公钥集合
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwt.JWKS
+// @Router /.well-known/jwks.json [get]
+func (s *WellKnownApi) JWKS(c *gin.Context) {
+	jwks := s.jwks()
+	if jwks == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.manager.JwksMaxAge().Seconds())))
+	c.JSON(http.StatusOK, jwks)
+}
+
+// Discovery
+// @ID Discovery
+// @Summary OpenID Connect 发现文档
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwt.Discovery
+// @Router /.well-known/openid-configuration [get]
+func (s *WellKnownApi) Discovery(c *gin.Context) {
+	if s.jwks() == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	jwksUri := fmt.Sprintf("%s://%s/.well-known/jwks.json", scheme, c.Request.Host)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.manager.JwksMaxAge().Seconds())))
+	c.JSON(http.StatusOK, s.manager.Discovery(jwksUri))
+}
@@ -3,6 +3,12 @@ package common
 const (
 	ApiPrefix = ""
 
-	TokenHeader = "token"
-	UserIdKey   = "user_id"
+	TokenHeader  = "token"
+	ApiKeyHeader = "X-API-Key"
+	// 客户端上报的设备名称，记录在登录会话中
+	DeviceHeader = "X-Device-Name"
+	UserIdKey    = "user_id"
+	TenantIdKey  = "tenant_id"
+	ClientIdKey  = "client_id"
+	PrincipalKey = "principal"
 )
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AuthMethodToken  = "token"
+	AuthMethodApiKey = "api_key"
+)
+
+// Principal 认证通过后的调用方身份
+type Principal struct {
+	// 认证方式：token / api_key
+	AuthMethod string
+	UserId     int
+	TenantId   string
+	SessionId  string
+	// access token 的 jti，API key 为 apikey:<id>
+	TokenId    string
+	Roles      []string
+	Scopes     []string
+	Extensions map[string]interface{}
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrincipal 返回 Authentication 中间件设置的身份，未认证时返回 false
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	v, ok := c.Get(PrincipalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
+
+// GetUserId 返回当前用户 ID，未认证时返回 0
+func GetUserId(c *gin.Context) int {
+	return c.GetInt(UserIdKey)
+}
+
+// GetTenantId 返回当前租户，未设置租户时使用用户 ID
+func GetTenantId(c *gin.Context) string {
+	if tenantId := c.GetString(TenantIdKey); tenantId != "" {
+		return tenantId
+	}
+	if userId := GetUserId(c); userId != 0 {
+		return strconv.Itoa(userId)
+	}
+	return ""
+}
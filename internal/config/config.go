@@ -3,17 +3,39 @@ package config
 import (
 	"gopkg.in/yaml.v3"
 	"os"
+	"service_template/internal/middleware"
 	"service_template/internal/server"
+	"service_template/internal/service"
 	"service_template/pkg/cache"
 	"service_template/pkg/db"
+	"service_template/pkg/jwt"
+	"service_template/pkg/lock"
 	"service_template/pkg/logger"
+	"service_template/pkg/policy"
+	"service_template/pkg/signature"
 )
 
 type Config struct {
-	Database   db.Option     `json:"database" yaml:"database"`
-	Cache      cache.Option  `json:"cache" yaml:"cache"`
-	HttpServer server.Option `json:"http_server" yaml:"http_server"`
-	Log        logger.Option `json:"log" yaml:"log"`
+	Database   db.Option                     `json:"database" yaml:"database"`
+	Cache      cache.Option                  `json:"cache" yaml:"cache"`
+	HttpServer server.Option                 `json:"http_server" yaml:"http_server"`
+	Log        logger.Option                 `json:"log" yaml:"log"`
+	Election   lock.ElectionOption           `json:"election" yaml:"election"`
+	Lock       lock.Option                   `json:"lock" yaml:"lock"`
+	Cors       middleware.CorsOption         `json:"cors" yaml:"cors"`
+	RateLimit  middleware.RateLimitOption    `json:"rate_limit" yaml:"rate_limit"`
+	LoadShed   middleware.LoadSheddingOption `json:"load_shedding" yaml:"load_shedding"`
+	Quota      service.QuotaOption           `json:"quota" yaml:"quota"`
+	Rbac       service.RbacOption            `json:"rbac" yaml:"rbac"`
+	ApiKey     service.ApiKeyOption          `json:"api_key" yaml:"api_key"`
+	User       service.UserOption            `json:"user" yaml:"user"`
+	TwoFactor  service.TwoFactorOption       `json:"two_factor" yaml:"two_factor"`
+	Oidc       service.OidcOption            `json:"oidc" yaml:"oidc"`
+	Session    service.SessionOption         `json:"session" yaml:"session"`
+	Policy     policy.Option                 `json:"policy" yaml:"policy"`
+	Signature  signature.Option              `json:"signature" yaml:"signature"`
+	Jwt        jwt.Option                    `json:"jwt" yaml:"jwt"`
+	IpDatabase string                        `json:"ip_database" yaml:"ip_database"`
 }
 
 func InitConfig(f string) (*Config, error) {
@@ -1,8 +1,14 @@
 package errors
 
 var (
-	Success       = NewError(200, "成功")
-	BadParameters = NewError(400, "参数错误")
-	Unauthorized  = NewError(401, "未授权")
-	InternalError = NewError(500, "内部错误")
+	Success            = NewError(200, "成功")
+	BadParameters      = NewError(400, "参数错误")
+	Unauthorized       = NewError(401, "未授权")
+	QuotaExceeded      = NewError(402, "配额已用尽")
+	Forbidden          = NewError(403, "无权限")
+	NotFound           = NewError(404, "资源不存在")
+	AccountLocked      = NewError(423, "账号已锁定，请稍后重试")
+	TooManyRequests    = NewError(429, "请求过于频繁")
+	InternalError      = NewError(500, "内部错误")
+	ServiceUnavailable = NewError(503, "服务繁忙，请稍后重试")
 )
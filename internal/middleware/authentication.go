@@ -1,27 +1,99 @@
 package middleware
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
 	"service_template/internal/common"
 	"service_template/internal/errors"
 	"service_template/internal/response"
+	"service_template/pkg/jwt"
+	"service_template/pkg/logger"
 )
 
-func Authentication(auth func(token string) (int, error)) gin.HandlerFunc {
-	return func(c *gin.Context) {
+// ErrNoCredentials 请求中没有该认证方式的凭证，继续尝试下一个认证方式
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator 认证请求并返回调用方身份
+type Authenticator func(c *gin.Context) (*common.Principal, error)
+
+// SessionValidator 校验 token 所属的登录会话未被吊销
+type SessionValidator func(ctx context.Context, userId int, sessionId, ip string) error
+
+// TokenAuthenticator 校验 common.TokenHeader 中的 JWT，revoker 不为 nil 时同时检查 token 是否已被吊销，
+// sessions 不为 nil 时同时检查 token 所属的会话
+func TokenAuthenticator(auth func(ctx context.Context, token string) (*common.Principal, error), revoker *jwt.Revoker, sessions SessionValidator) Authenticator {
+	return func(c *gin.Context) (*common.Principal, error) {
 		token := c.GetHeader(common.TokenHeader)
 		if token == "" {
-			response.HandleResponse(c, errors.Unauthorized, nil, nil)
-			c.Abort()
-			return
+			return nil, ErrNoCredentials
 		}
-		userId, err := auth(token)
+		principal, err := auth(c.Request.Context(), token)
 		if err != nil {
+			return nil, err
+		}
+		if revoker != nil {
+			revoked, err := revoker.IsTokenRevoked(c.Request.Context(), principal.UserId, principal.TokenId, principal.IssuedAt)
+			if err != nil {
+				// 吊销检查不可用时不影响正常请求
+				logger.WithContext(c.Request.Context()).Errorf("check token revocation error: %v", err)
+			}
+			if revoked {
+				return nil, errors.Wrap(errors.Unauthorized, "token revoked")
+			}
+		}
+		if sessions != nil && principal.SessionId != "" {
+			if err := sessions(c.Request.Context(), principal.UserId, principal.SessionId, c.ClientIP()); err != nil {
+				return nil, err
+			}
+		}
+		return principal, nil
+	}
+}
+
+// ApiKeyAuthenticator 校验 common.ApiKeyHeader 中的 API key
+func ApiKeyAuthenticator(auth func(ctx context.Context, key, ip string) (*common.Principal, error)) Authenticator {
+	return func(c *gin.Context) (*common.Principal, error) {
+		key := c.GetHeader(common.ApiKeyHeader)
+		if key == "" {
+			return nil, ErrNoCredentials
+		}
+		return auth(c.Request.Context(), key, c.ClientIP())
+	}
+}
+
+// Authentication 依次尝试 authenticators，使用第一个认证成功的身份，全部失败时返回第一个错误
+func Authentication(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var principal *common.Principal
+		var firstErr error
+		for _, auth := range authenticators {
+			p, err := auth(c)
+			if err == nil {
+				principal = p
+				break
+			}
+			if firstErr == nil && err != ErrNoCredentials {
+				firstErr = err
+			}
+		}
+		if principal == nil {
+			err := firstErr
+			if err == nil {
+				err = errors.Unauthorized
+			} else if !errors.As(err, new(errors.Error)) {
+				// 非业务错误码的错误视为凭证无效
+				err = errors.Wrap(errors.Unauthorized, err.Error())
+			}
 			response.HandleResponse(c, err, nil, nil)
 			c.Abort()
 			return
 		}
-		c.Set(common.UserIdKey, userId)
+		c.Set(common.PrincipalKey, principal)
+		c.Set(common.UserIdKey, principal.UserId)
+		if principal.TenantId != "" {
+			c.Set(common.TenantIdKey, principal.TenantId)
+		}
 		c.Next()
 	}
 }
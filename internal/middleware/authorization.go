@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+	"service_template/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hasScopes 判断 scopes 是否直接包含全部 permissions
+func hasScopes(p *common.Principal, permissions []string) bool {
+	for _, permission := range permissions {
+		if !p.HasScope(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// RequirePermission 要求当前用户的角色拥有全部 permissions，需放在 Authentication 之后。
+// API key 的 scopes 只用于进一步收窄权限，key 还须包含全部 permissions
+func RequirePermission(srv service.RbacService, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := common.GetPrincipal(c)
+		if !ok {
+			response.HandleResponse(c, errors.Unauthorized, nil, nil)
+			c.Abort()
+			return
+		}
+		if principal.AuthMethod == common.AuthMethodApiKey && !hasScopes(principal, permissions) {
+			response.HandleResponse(c, errors.Forbidden, nil, nil)
+			c.Abort()
+			return
+		}
+		allowed, err := srv.Authorize(c.Request.Context(), principal.Roles, permissions...)
+		if err != nil {
+			// 无法确认权限时拒绝请求
+			logger.WithContext(c.Request.Context()).Errorf("authorize user %d error: %v", principal.UserId, err)
+			response.HandleResponse(c, errors.InternalError, nil, nil)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			response.HandleResponse(c, errors.Forbidden, nil, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope 要求当前调用方拥有全部 scopes，需放在 Authentication 之后
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := common.GetPrincipal(c)
+		if !ok {
+			response.HandleResponse(c, errors.Unauthorized, nil, nil)
+			c.Abort()
+			return
+		}
+		if !hasScopes(principal, scopes) {
+			response.HandleResponse(c, errors.Forbidden, nil, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRbac 按角色名授予权限，err 不为 nil 时授权失败
+type fakeRbac struct {
+	service.RbacService
+	permissions map[string][]string
+	err         error
+}
+
+func (f fakeRbac) Authorize(ctx context.Context, roles []string, permissions ...string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, required := range permissions {
+		ok := false
+		for _, role := range roles {
+			for _, p := range f.permissions[role] {
+				if p == required {
+					ok = true
+				}
+			}
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// serve 以 principal 的身份请求受 handlers 保护的接口，返回响应中的错误码
+func serve(t *testing.T, principal *common.Principal, handlers ...gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		if principal != nil {
+			c.Set(common.PrincipalKey, principal)
+		}
+	})
+	handlers = append(handlers, func(c *gin.Context) {
+		response.HandleResponse(c, nil, nil, nil)
+	})
+	engine.GET("/", handlers...)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	resp := response.Response{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	rbac := fakeRbac{permissions: map[string][]string{"admin": {"rbac:manage"}, "editor": {"order:read"}}}
+	cases := []struct {
+		name      string
+		principal *common.Principal
+		code      int
+	}{
+		{"anonymous", nil, errors.Unauthorized.Code()},
+		{"role granted", &common.Principal{AuthMethod: common.AuthMethodToken, Roles: []string{"admin"}}, errors.Success.Code()},
+		{"role not granted", &common.Principal{AuthMethod: common.AuthMethodToken, Roles: []string{"editor"}}, errors.Forbidden.Code()},
+		// scope 不能代替角色授权
+		{"scope without role", &common.Principal{AuthMethod: common.AuthMethodApiKey, Roles: []string{"editor"}, Scopes: []string{"rbac:manage"}}, errors.Forbidden.Code()},
+		{"role without scope", &common.Principal{AuthMethod: common.AuthMethodApiKey, Roles: []string{"admin"}, Scopes: []string{"order:read"}}, errors.Forbidden.Code()},
+		{"role and scope", &common.Principal{AuthMethod: common.AuthMethodApiKey, Roles: []string{"admin"}, Scopes: []string{"rbac:manage"}}, errors.Success.Code()},
+	}
+	for _, c := range cases {
+		if code := serve(t, c.principal, RequirePermission(rbac, "rbac:manage")); code != c.code {
+			t.Errorf("%s: expect code %d, got %d", c.name, c.code, code)
+		}
+	}
+	// 无法确认权限时拒绝
+	rbac.err = errors.New("db down")
+	principal := &common.Principal{AuthMethod: common.AuthMethodToken, Roles: []string{"admin"}}
+	if code := serve(t, principal, RequirePermission(rbac, "rbac:manage")); code != errors.InternalError.Code() {
+		t.Fatalf("expect internal error, got %d", code)
+	}
+}
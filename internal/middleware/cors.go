@@ -1,22 +1,248 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"service_template/internal/common"
+	"service_template/pkg/requestid"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Cors(allowOrigin string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, Origin, Host, Connection, Accept-Encoding, Accept-Language")
-		if c.Request.Method == http.MethodOptions {
-			c.AbortWithStatus(http.StatusNoContent)
+type CorsOption struct {
+	Enable     bool `json:"enable" yaml:"enable"`
+	CorsPolicy `json:",inline" yaml:",inline"`
+	// 按路由前缀覆盖默认策略，最长前缀优先，如 /partner 不允许浏览器跨域访问
+	Routes []CorsRoute `json:"routes" yaml:"routes"`
+}
+
+type CorsPolicy struct {
+	// 允许的来源，如 https://app.example.com，https://*.example.com 匹配任意子域名，* 允许所有来源
+	AllowOrigins []string `json:"allow_origins" yaml:"allow_origins"`
+	// 默认 GET, POST, PUT, PATCH, DELETE, HEAD
+	AllowMethods []string `json:"allow_methods" yaml:"allow_methods"`
+	// 默认允许常用请求头和认证相关的请求头，* 允许预检请求中的所有请求头
+	AllowHeaders []string `json:"allow_headers" yaml:"allow_headers"`
+	// 浏览器脚本可以读取的响应头
+	ExposeHeaders []string `json:"expose_headers" yaml:"expose_headers"`
+	// 允许携带 cookie 等凭据，不能与 * 来源同时使用
+	AllowCredentials bool `json:"allow_credentials" yaml:"allow_credentials"`
+	// 预检结果的缓存时间，单位秒，默认 600，小于 0 时不缓存
+	MaxAge int `json:"max_age" yaml:"max_age"`
+}
+
+type CorsRoute struct {
+	// 请求路径前缀，如 /api/v1/.well-known
+	Prefix     string `json:"prefix" yaml:"prefix"`
+	CorsPolicy `json:",inline" yaml:",inline"`
+}
+
+var (
+	defaultCorsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+	defaultCorsHeaders = []string{"Accept", "Accept-Language", "Content-Type", "Authorization",
+		common.TokenHeader, common.ApiKeyHeader, common.DeviceHeader, requestid.Header}
+)
+
+// corsPolicy 预先处理好的跨域策略
+type corsPolicy struct {
+	allowAll    bool
+	origins     map[string]bool
+	wildcards   [][2]string
+	methods     map[string]bool
+	allowMethod string
+	anyHeader   bool
+	headers     map[string]bool
+	allowHeader string
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+func newCorsPolicy(p CorsPolicy) (*corsPolicy, error) {
+	if len(p.AllowMethods) == 0 {
+		p.AllowMethods = defaultCorsMethods
+	}
+	if len(p.AllowHeaders) == 0 {
+		p.AllowHeaders = defaultCorsHeaders
+	}
+	if p.MaxAge == 0 {
+		p.MaxAge = 600
+	}
+	cp := &corsPolicy{
+		origins:     map[string]bool{},
+		methods:     map[string]bool{},
+		headers:     map[string]bool{},
+		expose:      strings.Join(p.ExposeHeaders, ", "),
+		credentials: p.AllowCredentials,
+	}
+	for _, o := range p.AllowOrigins {
+		o = strings.ToLower(strings.TrimSuffix(o, "/"))
+		switch {
+		case o == "*":
+			cp.allowAll = true
+		case strings.Count(o, "*") > 1 || (strings.Contains(o, "*") && !strings.Contains(o, "://*.")):
+			return nil, fmt.Errorf("invalid cors origin pattern %s", o)
+		case strings.Contains(o, "*"):
+			i := strings.Index(o, "*")
+			cp.wildcards = append(cp.wildcards, [2]string{o[:i], o[i+1:]})
+		default:
+			cp.origins[o] = true
+		}
+	}
+	if cp.allowAll && cp.credentials {
+		return nil, fmt.Errorf("cors origin * cannot be used with allow_credentials")
+	}
+	methods := make([]string, 0, len(p.AllowMethods))
+	for _, m := range p.AllowMethods {
+		m = strings.ToUpper(m)
+		cp.methods[m] = true
+		methods = append(methods, m)
+	}
+	cp.allowMethod = strings.Join(methods, ", ")
+	for _, h := range p.AllowHeaders {
+		if h == "*" {
+			cp.anyHeader = true
+			continue
+		}
+		cp.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	headers := make([]string, 0, len(cp.headers))
+	for h := range cp.headers {
+		headers = append(headers, h)
+	}
+	sort.Strings(headers)
+	cp.allowHeader = strings.Join(headers, ", ")
+	if p.MaxAge > 0 {
+		cp.maxAge = strconv.Itoa(p.MaxAge)
+	}
+	return cp, nil
+}
+
+// allowOrigin 通配符只匹配子域名，https://*.example.com 不匹配 https://example.com
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.allowAll || p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(origin) <= len(w[0])+len(w[1]) || !strings.HasPrefix(origin, w[0]) || !strings.HasSuffix(origin, w[1]) {
+			continue
+		}
+		sub := origin[len(w[0]) : len(origin)-len(w[1])]
+		if !strings.ContainsAny(sub, "/:?#@") && !strings.HasPrefix(sub, ".") && !strings.HasSuffix(sub, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders 返回预检请求中的请求头是否都被允许
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !p.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *corsPolicy) handle(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	header := c.Writer.Header()
+	// 只有允许所有来源且不携带凭据时返回 *，其他情况响应随 Origin 变化
+	if !p.allowAll || p.credentials {
+		header.Add("Vary", "Origin")
+	}
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" {
+		c.Next()
+		return
+	}
+	if !p.allowOrigin(origin) {
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
 			return
 		}
-		c.Request.Header.Del("Origin")
+		// 非预检请求不带跨域响应头，由浏览器拒绝读取响应
+		c.Next()
+		return
+	}
+	if p.allowAll && !p.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if p.expose != "" {
+			header.Set("Access-Control-Expose-Headers", p.expose)
+		}
 		c.Next()
+		return
+	}
+	requestHeaders := c.GetHeader("Access-Control-Request-Headers")
+	if !p.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] || !p.allowHeaders(requestHeaders) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	header.Set("Access-Control-Allow-Methods", p.allowMethod)
+	if p.anyHeader && requestHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", requestHeaders)
+	} else if p.allowHeader != "" {
+		header.Set("Access-Control-Allow-Headers", p.allowHeader)
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// Cors 跨域访问控制，需要在 engine 上注册，使未注册 OPTIONS 路由的接口也能响应预检请求
+func Cors(opt CorsOption) gin.HandlerFunc {
+	if !opt.Enable {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	def, err := newCorsPolicy(opt.CorsPolicy)
+	if err != nil {
+		panic(err)
+	}
+	type route struct {
+		prefix string
+		policy *corsPolicy
+	}
+	routes := make([]route, 0, len(opt.Routes))
+	for _, r := range opt.Routes {
+		p, err := newCorsPolicy(r.CorsPolicy)
+		if err != nil {
+			panic(fmt.Errorf("cors route %s: %w", r.Prefix, err))
+		}
+		routes = append(routes, route{prefix: r.Prefix, policy: p})
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+	return func(c *gin.Context) {
+		for _, r := range routes {
+			if strings.HasPrefix(c.Request.URL.Path, r.prefix) {
+				r.policy.handle(c)
+				return
+			}
+		}
+		def.handle(c)
 	}
 }
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCorsEngine(opt CorsOption) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Cors(opt))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	for _, path := range []string{"/users", "/partner/orders", "/partner/public/jwks"} {
+		engine.GET(path, ok)
+		engine.POST(path, ok)
+	}
+	return engine
+}
+
+func TestCors(t *testing.T) {
+	engine := newCorsEngine(CorsOption{
+		Enable: true,
+		CorsPolicy: CorsPolicy{
+			AllowOrigins:     []string{"https://app.example.com", "https://*.example.com"},
+			ExposeHeaders:    []string{"X-Request-ID"},
+			AllowCredentials: true,
+		},
+		Routes: []CorsRoute{
+			// 空的 allow_origins 不允许任何来源
+			{Prefix: "/partner"},
+			{Prefix: "/partner/public", CorsPolicy: CorsPolicy{AllowOrigins: []string{"*"}, MaxAge: -1}},
+		},
+	})
+	cases := []struct {
+		name string
+		// preflight 不为空时发送预检请求，值为 Access-Control-Request-Method
+		path, origin, preflight, requestHeaders string
+		status                                  int
+		allowOrigin, maxAge                     string
+		vary                                    []string
+	}{
+		{name: "exact origin", path: "/users", origin: "https://app.example.com",
+			status: http.StatusOK, allowOrigin: "https://app.example.com", vary: []string{"Origin"}},
+		{name: "wildcard subdomain", path: "/users", origin: "https://a.example.com",
+			status: http.StatusOK, allowOrigin: "https://a.example.com", vary: []string{"Origin"}},
+		{name: "wildcard nested subdomain", path: "/users", origin: "https://a.b.example.com",
+			status: http.StatusOK, allowOrigin: "https://a.b.example.com", vary: []string{"Origin"}},
+		{name: "wildcard not match apex", path: "/users", origin: "https://example.com",
+			status: http.StatusOK, vary: []string{"Origin"}},
+		{name: "wildcard not match suffix", path: "/users", origin: "https://evilexample.com",
+			status: http.StatusOK, vary: []string{"Origin"}},
+		{name: "wildcard not match other domain", path: "/users", origin: "https://example.com.evil.com",
+			status: http.StatusOK, vary: []string{"Origin"}},
+		{name: "wildcard not match scheme", path: "/users", origin: "http://a.example.com",
+			status: http.StatusOK, vary: []string{"Origin"}},
+		{name: "no origin", path: "/users",
+			status: http.StatusOK, vary: []string{"Origin"}},
+		{name: "preflight", path: "/users", origin: "https://a.example.com", preflight: "POST", requestHeaders: "content-type, x-request-id",
+			status: http.StatusNoContent, allowOrigin: "https://a.example.com", maxAge: "600",
+			vary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		{name: "preflight origin denied", path: "/users", origin: "https://evil.com", preflight: "POST",
+			status: http.StatusForbidden, vary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		{name: "preflight method denied", path: "/users", origin: "https://app.example.com", preflight: "TRACE",
+			status: http.StatusForbidden, allowOrigin: "https://app.example.com",
+			vary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		{name: "preflight header denied", path: "/users", origin: "https://app.example.com", preflight: "POST", requestHeaders: "X-Custom",
+			status: http.StatusForbidden, allowOrigin: "https://app.example.com",
+			vary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		{name: "route without origins", path: "/partner/orders", origin: "https://app.example.com",
+			status: http.StatusOK, vary: []string{"Origin"}},
+		{name: "route without origins preflight", path: "/partner/orders", origin: "https://app.example.com", preflight: "POST",
+			status: http.StatusForbidden, vary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		// 最长前缀优先
+		{name: "longest prefix", path: "/partner/public/jwks", origin: "https://other.com",
+			status: http.StatusOK, allowOrigin: "*"},
+		{name: "longest prefix preflight", path: "/partner/public/jwks", origin: "https://other.com", preflight: "GET",
+			status: http.StatusNoContent, allowOrigin: "*", vary: []string{"Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+	}
+	for _, c := range cases {
+		method := http.MethodGet
+		if c.preflight != "" {
+			method = http.MethodOptions
+		}
+		req := httptest.NewRequest(method, c.path, nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.preflight != "" {
+			req.Header.Set("Access-Control-Request-Method", c.preflight)
+		}
+		if c.requestHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", c.requestHeaders)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		h := w.Header()
+		if w.Code != c.status {
+			t.Errorf("%s: expect status %d, got %d", c.name, c.status, w.Code)
+		}
+		if got := h.Get("Access-Control-Allow-Origin"); got != c.allowOrigin {
+			t.Errorf("%s: expect allow origin %q, got %q", c.name, c.allowOrigin, got)
+		}
+		if got := h.Get("Access-Control-Max-Age"); got != c.maxAge {
+			t.Errorf("%s: expect max age %q, got %q", c.name, c.maxAge, got)
+		}
+		if got := strings.Join(h.Values("Vary"), ","); got != strings.Join(c.vary, ",") {
+			t.Errorf("%s: expect vary %v, got %v", c.name, c.vary, got)
+		}
+		// 携带凭据时同时返回 Allow-Credentials
+		if c.allowOrigin != "" && c.allowOrigin != "*" && h.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%s: missing allow credentials", c.name)
+		}
+	}
+}
+
+func TestCorsPreflightHeaders(t *testing.T) {
+	engine := newCorsEngine(CorsOption{Enable: true, CorsPolicy: CorsPolicy{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{"get", "post"},
+		AllowHeaders: []string{"*"},
+		MaxAge:       60,
+	}})
+	req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	h := w.Header()
+	if w.Code != http.StatusNoContent || h.Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		h.Get("Access-Control-Allow-Headers") != "X-Custom" || h.Get("Access-Control-Max-Age") != "60" {
+		t.Fatalf("unexpected preflight response %d %v", w.Code, h)
+	}
+}
+
+func TestCorsInvalidOption(t *testing.T) {
+	cases := map[string]CorsOption{
+		"wildcard with credentials": {Enable: true, CorsPolicy: CorsPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}},
+		"route wildcard with credentials": {Enable: true, Routes: []CorsRoute{
+			{Prefix: "/partner", CorsPolicy: CorsPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}},
+		}},
+		"multiple wildcards":  {Enable: true, CorsPolicy: CorsPolicy{AllowOrigins: []string{"https://*.*.example.com"}}},
+		"wildcard not prefix": {Enable: true, CorsPolicy: CorsPolicy{AllowOrigins: []string{"https://app*.example.com"}}},
+	}
+	for name, opt := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expect panic", name)
+				}
+			}()
+			Cors(opt)
+		}()
+	}
+	// 未开启时不校验
+	Cors(CorsOption{CorsPolicy: CorsPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}})
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"net/http"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/pkg/db"
+	"service_template/pkg/ratelimiter"
+	"service_template/pkg/requestid"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoadSheddingOption struct {
+	Enable bool `json:"enable" yaml:"enable"`
+	// 全局并发限制，Limit 为 0 时不限制
+	Global ratelimiter.ConcurrencyOption `json:"global" yaml:"global"`
+	Rules  []ConcurrencyRule             `json:"rules" yaml:"rules"`
+	// 从不丢弃的路由，如健康检查和管理接口，以 * 结尾时按前缀匹配
+	Critical []string `json:"critical" yaml:"critical"`
+	// 低优先级路由，并发使用率超过 LowPriorityRatio 时优先丢弃
+	LowPriority      []string `json:"low_priority" yaml:"low_priority"`
+	LowPriorityRatio float64  `json:"low_priority_ratio" yaml:"low_priority_ratio"`
+	// 数据库连接池使用率达到该比例时丢弃非关键请求，为 0 时不检查
+	DBSaturation float64 `json:"db_saturation" yaml:"db_saturation"`
+}
+
+type ConcurrencyRule struct {
+	// gin 路由模式，如 /users/:id
+	Route string `json:"route" yaml:"route"`
+	// 为空或 * 匹配所有方法
+	Method string                        `json:"method" yaml:"method"`
+	Limit  ratelimiter.ConcurrencyOption `json:"limit" yaml:"limit"`
+}
+
+const (
+	priorityCritical = iota
+	priorityNormal
+	priorityLow
+)
+
+type concurrencyRule struct {
+	route   string
+	method  string
+	limiter *ratelimiter.ConcurrencyLimiter
+}
+
+func matchRoute(patterns []string, route string) bool {
+	for _, p := range patterns {
+		if p == route || strings.HasSuffix(p, "*") && strings.HasPrefix(route, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadShedding 限制处理中的请求数，在服务或数据库连接池过载前返回 503
+func LoadShedding(opt LoadSheddingOption, database *db.DB) gin.HandlerFunc {
+	if !opt.Enable {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	if opt.LowPriorityRatio <= 0 || opt.LowPriorityRatio > 1 {
+		opt.LowPriorityRatio = 0.8
+	}
+	var global *ratelimiter.ConcurrencyLimiter
+	if opt.Global.Limit > 0 {
+		global = ratelimiter.NewConcurrencyLimiter(opt.Global)
+	}
+	rules := make([]*concurrencyRule, 0, len(opt.Rules))
+	for _, r := range opt.Rules {
+		rules = append(rules, &concurrencyRule{
+			route:   r.Route,
+			method:  r.Method,
+			limiter: ratelimiter.NewConcurrencyLimiter(r.Limit),
+		})
+	}
+	priority := func(route string) int {
+		if matchRoute(opt.Critical, route) {
+			return priorityCritical
+		}
+		if matchRoute(opt.LowPriority, route) {
+			return priorityLow
+		}
+		return priorityNormal
+	}
+	// 按优先级计算丢弃阈值，低优先级请求在达到阈值前提前丢弃
+	threshold := func(p int) float64 {
+		if p == priorityLow {
+			return opt.LowPriorityRatio
+		}
+		return 1
+	}
+	dbSaturated := func(p int) bool {
+		if opt.DBSaturation <= 0 || database == nil {
+			return false
+		}
+		stats := database.Stats()
+		if stats.MaxOpenConnections <= 0 {
+			return false
+		}
+		return float64(stats.InUse)/float64(stats.MaxOpenConnections) >= opt.DBSaturation*threshold(p)
+	}
+	acquire := func(l *ratelimiter.ConcurrencyLimiter, p int) (func(), bool) {
+		if p == priorityLow && l.Utilization() >= threshold(p) {
+			return nil, false
+		}
+		return l.Acquire()
+	}
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		p := priority(route)
+		if p == priorityCritical {
+			c.Next()
+			return
+		}
+		if dbSaturated(p) {
+			shed(c)
+			return
+		}
+		if global != nil {
+			release, ok := acquire(global, p)
+			if !ok {
+				shed(c)
+				return
+			}
+			defer release()
+		}
+		for _, r := range rules {
+			if r.route != route || r.method != "" && r.method != "*" && !strings.EqualFold(r.method, c.Request.Method) {
+				continue
+			}
+			release, ok := acquire(r.limiter, p)
+			if !ok {
+				shed(c)
+				return
+			}
+			defer release()
+		}
+		c.Next()
+	}
+}
+
+func shed(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, response.Response{
+		Code:      errors.ServiceUnavailable.Code(),
+		Message:   errors.ServiceUnavailable.Message(),
+		RequestId: requestid.FromContext(c.Request.Context()),
+	})
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"service_template/pkg/policy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyEnvironment 将客户端 IP 和请求时间写入请求上下文，供服务层评估策略
+func PolicyEnvironment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := policy.NewContext(c.Request.Context(), policy.Environment{
+			Time: time.Now(),
+			IP:   c.ClientIP(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
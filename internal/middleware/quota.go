@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/internal/service"
+	"service_template/pkg/logger"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Quota 按租户套餐消耗配额，需放在 Authentication 之后
+func Quota(srv service.QuotaService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantId := common.GetTenantId(c)
+		if tenantId == "" {
+			c.Next()
+			return
+		}
+		res, err := srv.Consume(c.Request.Context(), tenantId, 1)
+		if err != nil {
+			logger.WithContext(c.Request.Context()).Errorf("consume quota of tenant %s error: %v", tenantId, err)
+			c.Next()
+			return
+		}
+		setQuotaHeaders(c, res)
+		if !res.Allowed {
+			response.HandleResponse(c, errors.QuotaExceeded, nil, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// setQuotaHeaders 按剩余配额最少的周期设置响应头
+func setQuotaHeaders(c *gin.Context, res *service.QuotaResult) {
+	var usage *service.QuotaPeriodUsage
+	for _, u := range res.Usages {
+		if usage == nil || u.Remaining < usage.Remaining {
+			usage = u
+		}
+	}
+	if usage == nil {
+		return
+	}
+	header := c.Writer.Header()
+	header.Set("X-Quota-Limit", strconv.FormatInt(usage.Limit, 10))
+	header.Set("X-Quota-Remaining", strconv.FormatInt(usage.Remaining, 10))
+	header.Set("X-Quota-Reset", strconv.FormatInt(ceilSeconds(time.Until(usage.ResetAt)), 10))
+	if res.Overage {
+		header.Set("X-Quota-Overage", "true")
+	}
+}
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"service_template/pkg/ratelimiter"
+	"service_template/pkg/requestid"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	KeyByIP     = "ip"
+	KeyByUser   = "user"
+	KeyByApiKey = "api_key"
+	// KeyByHeader 按请求头限流，格式为 header:X-Name
+	KeyByHeader = "header:"
+)
+
+type RateLimitOption struct {
+	Enable bool `json:"enable" yaml:"enable"`
+	// Redis key 前缀
+	Prefix string          `json:"prefix" yaml:"prefix"`
+	Rules  []RateLimitRule `json:"rules" yaml:"rules"`
+}
+
+type RateLimitRule struct {
+	// 规则名称，作为限流 key 的一部分，不能重复，默认为 method + route + key + max/interval
+	Name string `json:"name" yaml:"name"`
+	// gin 路由模式，如 /users/:id，* 匹配所有路由
+	Route string `json:"route" yaml:"route"`
+	// 为空或 * 匹配所有方法
+	Method string `json:"method" yaml:"method"`
+	// 限流维度：ip / user / api_key / header:X-Name / 自定义提取器名称
+	Key   string             `json:"key" yaml:"key"`
+	Limit ratelimiter.Option `json:"limit" yaml:"limit"`
+}
+
+// KeyExtractor 从请求中提取限流维度的值，返回空字符串时按客户端 IP 限流
+type KeyExtractor func(c *gin.Context) string
+
+var (
+	extractorMu   sync.RWMutex
+	keyExtractors = map[string]KeyExtractor{
+		KeyByIP: func(c *gin.Context) string {
+			return c.ClientIP()
+		},
+		KeyByUser: func(c *gin.Context) string {
+			userId := common.GetUserId(c)
+			if userId == 0 {
+				return ""
+			}
+			return strconv.Itoa(userId)
+		},
+		KeyByApiKey: func(c *gin.Context) string {
+			apiKey := c.GetHeader(common.ApiKeyHeader)
+			if apiKey == "" {
+				return ""
+			}
+			sum := sha256.Sum256([]byte(apiKey))
+			return hex.EncodeToString(sum[:8])
+		},
+	}
+)
+
+// RegisterKeyExtractor 注册自定义限流维度，需在 RateLimit 之前调用
+func RegisterKeyExtractor(name string, fn KeyExtractor) {
+	extractorMu.Lock()
+	defer extractorMu.Unlock()
+	keyExtractors[name] = fn
+}
+
+func getKeyExtractor(key string) KeyExtractor {
+	if strings.HasPrefix(key, KeyByHeader) {
+		header := strings.TrimPrefix(key, KeyByHeader)
+		return func(c *gin.Context) string {
+			return c.GetHeader(header)
+		}
+	}
+	extractorMu.RLock()
+	defer extractorMu.RUnlock()
+	return keyExtractors[key]
+}
+
+type rateLimitRule struct {
+	name      string
+	route     string
+	method    string
+	keyType   string
+	extractor KeyExtractor
+	limiter   ratelimiter.RateLimiter
+}
+
+func (r *rateLimitRule) match(c *gin.Context) bool {
+	if r.route != "*" && r.route != c.FullPath() {
+		return false
+	}
+	return r.method == "" || r.method == "*" || strings.EqualFold(r.method, c.Request.Method)
+}
+
+func (r *rateLimitRule) key(prefix string, c *gin.Context) string {
+	value := r.extractor(c)
+	keyType := r.keyType
+	if value == "" {
+		keyType = KeyByIP
+		value = c.ClientIP()
+	}
+	return fmt.Sprintf("%s:%s:%s:%s", prefix, r.name, keyType, value)
+}
+
+// RateLimit 按配置的路由规则限流，同一路由的多条规则全部生效，规则配置有误时返回错误
+func RateLimit(opt RateLimitOption, rdb *cache.Redis) (gin.HandlerFunc, error) {
+	if !opt.Enable || len(opt.Rules) == 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}, nil
+	}
+	if opt.Prefix == "" {
+		opt.Prefix = "ratelimit"
+	}
+	rules := make([]*rateLimitRule, 0, len(opt.Rules))
+	names := make(map[string]bool, len(opt.Rules))
+	for _, r := range opt.Rules {
+		if r.Route == "" {
+			r.Route = "*"
+		}
+		if r.Key == "" {
+			r.Key = KeyByIP
+		}
+		if r.Name == "" {
+			// 同一路由可叠加不同维度、不同窗口的规则，如按 IP 每秒 10 次和按用户每小时 1000 次
+			r.Name = fmt.Sprintf("%s%s:%s:%d/%d", strings.ToUpper(r.Method), r.Route, r.Key, r.Limit.Max, r.Limit.Interval)
+		}
+		// 同名规则共用限流 key，计数会相互影响
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rate limit rule: %s", r.Name)
+		}
+		names[r.Name] = true
+		extractor := getKeyExtractor(r.Key)
+		if extractor == nil {
+			return nil, fmt.Errorf("unknown rate limit key extractor: %s", r.Key)
+		}
+		limiter, err := ratelimiter.NewRateLimiter(r.Limit, rdb)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit rule %s: %w", r.Name, err)
+		}
+		rules = append(rules, &rateLimitRule{
+			name:      r.Name,
+			route:     r.Route,
+			method:    r.Method,
+			keyType:   r.Key,
+			extractor: extractor,
+			limiter:   limiter,
+		})
+	}
+	return func(c *gin.Context) {
+		var (
+			matched  bool
+			decision ratelimiter.Decision
+		)
+		for _, r := range rules {
+			if !r.match(c) {
+				continue
+			}
+			d, err := r.limiter.Allow(r.key(opt.Prefix, c))
+			if err != nil {
+				logger.WithContext(c.Request.Context()).Errorf("rate limit rule %s error: %v", r.name, err)
+				continue
+			}
+			if !matched || restrictive(d, decision) {
+				decision = d
+			}
+			matched = true
+		}
+		if !matched {
+			c.Next()
+			return
+		}
+		setRateLimitHeaders(c.Writer.Header(), decision)
+		if !decision.Allowed {
+			// 被拒绝的请求不记录日志，避免攻击时日志量过大
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, response.Response{
+				Code:      errors.TooManyRequests.Code(),
+				Message:   errors.TooManyRequests.Message(),
+				RequestId: requestid.FromContext(c.Request.Context()),
+			})
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// restrictive 判断 a 是否比 b 更严格
+func restrictive(a, b ratelimiter.Decision) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func setRateLimitHeaders(header http.Header, d ratelimiter.Decision) {
+	header.Set("RateLimit-Limit", strconv.FormatInt(d.Limit, 10))
+	header.Set("RateLimit-Remaining", strconv.FormatInt(d.Remaining, 10))
+	header.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(time.Until(d.ResetAt)), 10))
+	if !d.Allowed {
+		header.Set("Retry-After", strconv.FormatInt(ceilSeconds(d.RetryAfter), 10))
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
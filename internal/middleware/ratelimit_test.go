@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/pkg/ratelimiter"
+	"service_template/pkg/requestid"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func localLimit(max int64) ratelimiter.Option {
+	return ratelimiter.Option{Store: ratelimiter.StoreLocal, Max: max, Interval: 60}
+}
+
+// newRateLimitEngine 请求头 X-User 模拟已登录的用户
+func newRateLimitEngine(t *testing.T, rules ...RateLimitRule) *gin.Engine {
+	handler, err := RateLimit(RateLimitOption{Enable: true, Rules: rules}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RequestId(), func(c *gin.Context) {
+		if userId, _ := strconv.Atoi(c.GetHeader("X-User")); userId != 0 {
+			c.Set(common.UserIdKey, userId)
+		}
+	}, handler)
+	engine.GET("/a", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	engine.GET("/b", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return engine
+}
+
+func request(engine *gin.Engine, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func countAllowed(engine *gin.Engine, path string, headers map[string]string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if request(engine, path, headers).Code == http.StatusOK {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestRateLimitStackedRules(t *testing.T) {
+	// 同一路由、相同配额，按 IP 和按用户的规则同时生效
+	engine := newRateLimitEngine(t,
+		RateLimitRule{Route: "/a", Key: KeyByIP, Limit: localLimit(4)},
+		RateLimitRule{Route: "/a", Key: KeyByUser, Limit: localLimit(4)},
+		RateLimitRule{Route: "/a", Key: KeyByUser, Limit: ratelimiter.Option{Store: ratelimiter.StoreLocal, Max: 2, Interval: 1}},
+	)
+	// 被拒绝的请求仍消耗了其他规则的配额
+	if n := countAllowed(engine, "/a", map[string]string{"X-User": "1"}, 3); n != 2 {
+		t.Fatalf("expect the strictest rule to allow 2 requests, got %d", n)
+	}
+	// 同一 IP 的其他用户受 IP 规则限制
+	if n := countAllowed(engine, "/a", map[string]string{"X-User": "2"}, 5); n != 1 {
+		t.Fatalf("expect the ip rule to allow 1 more request, got %d", n)
+	}
+	// 未匹配规则的路由不限流
+	if n := countAllowed(engine, "/b", nil, 5); n != 5 {
+		t.Fatalf("expect unmatched route not limited, got %d", n)
+	}
+}
+
+func TestRateLimitInvalidRules(t *testing.T) {
+	cases := map[string][]RateLimitRule{
+		"duplicate": {
+			{Route: "/a", Key: KeyByIP, Limit: localLimit(3)},
+			{Route: "/a", Key: KeyByIP, Limit: localLimit(3)},
+		},
+		"duplicate name": {
+			{Name: "a", Route: "/a", Limit: localLimit(3)},
+			{Name: "a", Route: "/b", Limit: localLimit(3)},
+		},
+		"unknown extractor": {{Route: "/a", Key: "unknown", Limit: localLimit(3)}},
+		"invalid limit":     {{Route: "/a", Limit: ratelimiter.Option{Store: ratelimiter.StoreLocal}}},
+	}
+	for name, rules := range cases {
+		if _, err := RateLimit(RateLimitOption{Enable: true, Rules: rules}, nil); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+}
+
+func TestRateLimitKeyExtractors(t *testing.T) {
+	cases := []struct {
+		key string
+		// 相同的值共享配额，不同的值互不影响
+		same, other map[string]string
+	}{
+		{KeyByUser, map[string]string{"X-User": "1"}, map[string]string{"X-User": "2"}},
+		{KeyByApiKey, map[string]string{common.ApiKeyHeader: "sk_a"}, map[string]string{common.ApiKeyHeader: "sk_b"}},
+		{KeyByHeader + "X-Tenant", map[string]string{"X-Tenant": "a"}, map[string]string{"X-Tenant": "b"}},
+	}
+	for _, c := range cases {
+		engine := newRateLimitEngine(t, RateLimitRule{Route: "*", Key: c.key, Limit: localLimit(1)})
+		if n := countAllowed(engine, "/a", c.same, 2); n != 1 {
+			t.Errorf("%s: expect 1 request allowed, got %d", c.key, n)
+		}
+		if n := countAllowed(engine, "/b", c.other, 1); n != 1 {
+			t.Errorf("%s: expect another value not limited, got %d", c.key, n)
+		}
+		// 没有该维度的值时按 IP 限流
+		if n := countAllowed(engine, "/a", nil, 2); n != 1 {
+			t.Errorf("%s: expect fallback to ip, got %d allowed", c.key, n)
+		}
+	}
+}
+
+func TestRateLimitRejected(t *testing.T) {
+	engine := newRateLimitEngine(t, RateLimitRule{Route: "/a", Limit: localLimit(1)})
+	if w := request(engine, "/a", nil); w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("unexpected first response: %d %v", w.Code, w.Header())
+	}
+	w := request(engine, "/a", map[string]string{requestid.Header: "req-1"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Limit") != "1" {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	resp := response.Response{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != errors.TooManyRequests.Code() || resp.RequestId != "req-1" {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
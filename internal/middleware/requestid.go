@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"service_template/pkg/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestId 使用客户端传入的 X-Request-ID 或生成新的请求 ID，写入请求上下文和响应头
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
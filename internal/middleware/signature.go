@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/response"
+	"service_template/pkg/logger"
+	"service_template/pkg/signature"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Signature 校验合作方的请求签名，通过后将客户端 ID 写入上下文
+func Signature(v *signature.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientId, err := v.Verify(c.Request)
+		switch {
+		case err == nil:
+			c.Set(common.ClientIdKey, clientId)
+			c.Next()
+			return
+		case errors.Is(err, signature.ErrMissingSignature), errors.Is(err, signature.ErrInvalidSignature),
+			errors.Is(err, signature.ErrUnknownClient), errors.Is(err, signature.ErrTimestampSkew),
+			errors.Is(err, signature.ErrReplayed):
+			logger.WithContext(c.Request.Context()).Warnf("verify signature of client %s failed: %v", clientId, err)
+			response.HandleResponse(c, errors.Wrap(errors.Unauthorized, err.Error()), nil, nil)
+		case errors.Is(err, signature.ErrBodyTooLarge):
+			response.HandleResponse(c, errors.Wrap(errors.BadParameters, err.Error()), nil, nil)
+		default:
+			// 无法检查 nonce 时拒绝请求，避免重放
+			response.HandleResponse(c, err, nil, nil)
+		}
+		c.Abort()
+	}
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepository interface {
+	Create(ctx context.Context, key *model.ApiKey) error
+	Get(ctx context.Context, id int64) (*model.ApiKey, error)
+	GetByHash(ctx context.Context, hash string) (*model.ApiKey, error)
+	ListByUser(ctx context.Context, userId int) ([]*model.ApiKey, error)
+	Revoke(ctx context.Context, id int64, at time.Time) error
+	// Rotate 创建新 key，并将旧 key 的过期时间提前到 expiresAt
+	Rotate(ctx context.Context, key *model.ApiKey, expiresAt time.Time) error
+	// Touch 记录最后使用的时间和 IP
+	Touch(ctx context.Context, id int64, at time.Time, ip string) error
+}
+
+func NewApiKeyRepository(db *db.DB) ApiKeyRepository {
+	return &apiKeyRepository{
+		db: db,
+	}
+}
+
+type apiKeyRepository struct {
+	db *db.DB
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *model.ApiKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *apiKeyRepository) Get(ctx context.Context, id int64) (*model.ApiKey, error) {
+	key := &model.ApiKey{}
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return key, err
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, hash string) (*model.ApiKey, error) {
+	key := &model.ApiKey{}
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return key, err
+}
+
+func (r *apiKeyRepository) ListByUser(ctx context.Context, userId int) ([]*model.ApiKey, error) {
+	var keys []*model.ApiKey
+	err := r.db.WithContext(ctx).Where("user_id = ?", userId).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id int64, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.ApiKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, key *model.ApiKey, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		// 旧 key 原本的过期时间更早时保持不变
+		return tx.Model(&model.ApiKey{}).
+			Where("id = ? AND (expires_at IS NULL OR expires_at > ?)", key.RotatedFrom, expiresAt).
+			Update("expires_at", expiresAt).Error
+	})
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id int64, at time.Time, ip string) error {
+	return r.db.WithContext(ctx).Model(&model.ApiKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+}
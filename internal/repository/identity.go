@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IdentityRepository interface {
+	Get(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+	List(ctx context.Context, userId int) ([]*model.UserIdentity, error)
+	Create(ctx context.Context, identity *model.UserIdentity) error
+	Delete(ctx context.Context, userId int, provider string) (int64, error)
+	Touch(ctx context.Context, id int64, at time.Time) error
+}
+
+func NewIdentityRepository(db *db.DB) IdentityRepository {
+	return &identityRepository{
+		db: db,
+	}
+}
+
+type identityRepository struct {
+	db *db.DB
+}
+
+func (r *identityRepository) Get(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	identity := &model.UserIdentity{}
+	err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return identity, err
+}
+
+func (r *identityRepository) List(ctx context.Context, userId int) ([]*model.UserIdentity, error) {
+	var identities []*model.UserIdentity
+	err := r.db.WithContext(ctx).Where("user_id = ?", userId).Order("id").Find(&identities).Error
+	return identities, err
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *model.UserIdentity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r *identityRepository) Delete(ctx context.Context, userId int, provider string) (int64, error) {
+	res := r.db.WithContext(ctx).Where("user_id = ? AND provider = ?", userId, provider).Delete(&model.UserIdentity{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *identityRepository) Touch(ctx context.Context, id int64, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.UserIdentity{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
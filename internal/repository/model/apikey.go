@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// ApiKey 机器客户端使用的 API key，只保存哈希
+type ApiKey struct {
+	Id   int64  `gorm:"primaryKey"`
+	Name string `gorm:"size:64"`
+	// key 的前几位，用于在列表中辨认
+	Prefix string `gorm:"size:16"`
+	Hash   string `gorm:"size:64;uniqueIndex"`
+	// 创建该 key 的用户
+	UserId   int      `gorm:"index"`
+	TenantId string   `gorm:"size:64"`
+	Scopes   []string `gorm:"serializer:json;size:1024"`
+	// 为空时不过期
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	// 轮换前的 key
+	RotatedFrom int64
+	LastUsedAt  *time.Time
+	LastUsedIp  string `gorm:"size:64"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// UserIdentity 关联到本地用户的外部身份，同一提供方的 subject 只能关联一个用户
+type UserIdentity struct {
+	Id          int64      `gorm:"primaryKey" json:"id"`
+	UserId      int        `gorm:"index" json:"user_id"`
+	Provider    string     `gorm:"size:64;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject     string     `gorm:"size:255;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email       string     `gorm:"size:255" json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -1,3 +1,19 @@
 package model
 
-var Tables = []interface{}{}
+var Tables = []interface{}{
+	&Plan{},
+	&TenantPlan{},
+	&QuotaUsage{},
+	&Role{},
+	&Permission{},
+	&RolePermission{},
+	&UserRole{},
+	&ApiKey{},
+	&User{},
+	&UserToken{},
+	&UserTotp{},
+	&RecoveryCode{},
+	&UserIdentity{},
+	&Session{},
+	&RefreshToken{},
+}
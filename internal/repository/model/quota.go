@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Plan 套餐，同名套餐优先于配置文件中的定义
+type Plan struct {
+	Id           int64  `gorm:"primaryKey"`
+	Name         string `gorm:"size:64;uniqueIndex"`
+	DailyLimit   int64
+	MonthlyLimit int64
+	// 超出配额后的处理：reject / allow
+	Overage string `gorm:"size:16"`
+	// overage 为 allow 时允许超出的数量，0 表示不限制
+	OverageLimit int64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// TenantPlan 租户使用的套餐
+type TenantPlan struct {
+	TenantId  string `gorm:"size:64;primaryKey"`
+	PlanName  string `gorm:"size:64"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// QuotaUsage 租户在一个周期内的用量，由 Redis 计数定期持久化
+type QuotaUsage struct {
+	Id        int64  `gorm:"primaryKey"`
+	TenantId  string `gorm:"size:64;uniqueIndex:idx_quota_usage"`
+	Period    string `gorm:"size:16;uniqueIndex:idx_quota_usage"`
+	PeriodId  string `gorm:"size:16;uniqueIndex:idx_quota_usage"`
+	Used      int64
+	UpdatedAt time.Time
+}
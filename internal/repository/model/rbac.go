@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Role 角色
+type Role struct {
+	Id          int64  `gorm:"primaryKey"`
+	Name        string `gorm:"size:64;uniqueIndex"`
+	Description string `gorm:"size:255"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Permission 权限，名称格式为 资源:操作，如 quota:read
+type Permission struct {
+	Id          int64  `gorm:"primaryKey"`
+	Name        string `gorm:"size:128;uniqueIndex"`
+	Description string `gorm:"size:255"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RolePermission 角色拥有的权限
+type RolePermission struct {
+	RoleId       int64 `gorm:"primaryKey"`
+	PermissionId int64 `gorm:"primaryKey"`
+	CreatedAt    time.Time
+}
+
+// UserRole 用户拥有的角色
+type UserRole struct {
+	UserId    int   `gorm:"primaryKey"`
+	RoleId    int64 `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
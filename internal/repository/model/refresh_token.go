@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// RefreshToken refresh_store 为 db 时保存的 refresh token，只保存哈希，Family 即登录会话 ID
+type RefreshToken struct {
+	Hash      string `gorm:"size:64;primaryKey"`
+	Family    string `gorm:"size:32;index"`
+	UserId    int
+	Used      bool
+	Revoked   bool
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
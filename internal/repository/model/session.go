@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Session 登录会话，Id 为 token 中的 session id，即同一次登录轮换出的 refresh token 族
+type Session struct {
+	Id     string `gorm:"size:64;primaryKey" json:"id"`
+	UserId int    `gorm:"index" json:"-"`
+	// 客户端上报的设备名称
+	Device    string `gorm:"size:128" json:"device,omitempty"`
+	UserAgent string `gorm:"size:512" json:"user_agent,omitempty"`
+	// 最后活跃时的 IP 和地理位置
+	Ip         string     `gorm:"size:64" json:"ip"`
+	Location   string     `gorm:"size:255" json:"location,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// 是否为当前请求所属的会话
+	Current bool `gorm:"-" json:"current"`
+}
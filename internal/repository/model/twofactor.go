@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// UserTotp 用户绑定的 TOTP 验证器，Secret 加密保存
+type UserTotp struct {
+	UserId int    `gorm:"primaryKey;autoIncrement:false"`
+	Secret string `gorm:"size:255"`
+	// 为空时尚未确认绑定，登录时不要求二次验证
+	ConfirmedAt *time.Time
+	// 最近一次通过验证的时间步，防止验证码重放
+	LastUsedStep int64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RecoveryCode 一次性恢复码，只保存哈希
+type RecoveryCode struct {
+	Id        int64  `gorm:"primaryKey"`
+	UserId    int    `gorm:"index"`
+	Hash      string `gorm:"size:64"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	UserTokenVerifyEmail   = "verify_email"
+	UserTokenResetPassword = "reset_password"
+)
+
+type User struct {
+	Id           int    `gorm:"primaryKey" json:"id"`
+	Username     string `gorm:"size:64;uniqueIndex" json:"username"`
+	Email        string `gorm:"size:255;uniqueIndex" json:"email"`
+	PasswordHash string `gorm:"size:255" json:"-"`
+	TenantId     string `gorm:"size:64" json:"tenant_id,omitempty"`
+	// 为空时邮箱未验证
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// 连续登录失败后锁定到该时间
+	LockedUntil *time.Time `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// UserToken 邮箱验证和重置密码的一次性 token，只保存哈希
+type UserToken struct {
+	Id        int64  `gorm:"primaryKey"`
+	UserId    int    `gorm:"index"`
+	Purpose   string `gorm:"size:32"`
+	Hash      string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
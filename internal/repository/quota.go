@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QuotaRepository interface {
+	GetPlan(ctx context.Context, name string) (*model.Plan, error)
+	GetTenantPlan(ctx context.Context, tenantId string) (*model.TenantPlan, error)
+	GetUsage(ctx context.Context, tenantId, period, periodId string) (*model.QuotaUsage, error)
+	SaveUsages(ctx context.Context, usages []*model.QuotaUsage) error
+}
+
+func NewQuotaRepository(db *db.DB) QuotaRepository {
+	return &quotaRepository{
+		db: db,
+	}
+}
+
+type quotaRepository struct {
+	db *db.DB
+}
+
+func (r *quotaRepository) GetPlan(ctx context.Context, name string) (*model.Plan, error) {
+	plan := &model.Plan{}
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return plan, err
+}
+
+func (r *quotaRepository) GetTenantPlan(ctx context.Context, tenantId string) (*model.TenantPlan, error) {
+	tp := &model.TenantPlan{}
+	err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantId).First(tp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return tp, err
+}
+
+func (r *quotaRepository) GetUsage(ctx context.Context, tenantId, period, periodId string) (*model.QuotaUsage, error) {
+	usage := &model.QuotaUsage{}
+	err := r.db.WithContext(ctx).
+		Where("tenant_id = ? AND period = ? AND period_id = ?", tenantId, period, periodId).
+		First(usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return usage, err
+}
+
+// SaveUsages 按租户和周期写入用量，已存在时覆盖
+func (r *quotaRepository) SaveUsages(ctx context.Context, usages []*model.QuotaUsage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "period"}, {Name: "period_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"used", "updated_at"}),
+	}).Create(usages).Error
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RbacRepository interface {
+	ListRoles(ctx context.Context) ([]*model.Role, error)
+	GetRole(ctx context.Context, name string) (*model.Role, error)
+	CreateRole(ctx context.Context, role *model.Role) error
+	// DeleteRole 删除角色及其权限、用户关系
+	DeleteRole(ctx context.Context, name string) error
+	ListPermissions(ctx context.Context) ([]*model.Permission, error)
+	GetPermission(ctx context.Context, name string) (*model.Permission, error)
+	CreatePermission(ctx context.Context, permission *model.Permission) error
+	// DeletePermission 删除权限及其角色关系，返回受影响的角色
+	DeletePermission(ctx context.Context, name string) ([]string, error)
+	// RolePermissions 返回角色拥有的权限名称
+	RolePermissions(ctx context.Context, role string) ([]string, error)
+	Grant(ctx context.Context, roleId, permissionId int64) error
+	Revoke(ctx context.Context, roleId, permissionId int64) error
+	// UserRoles 返回用户拥有的角色名称
+	UserRoles(ctx context.Context, userId int) ([]string, error)
+	AssignRole(ctx context.Context, userId int, roleId int64) error
+	UnassignRole(ctx context.Context, userId int, roleId int64) error
+}
+
+func NewRbacRepository(db *db.DB) RbacRepository {
+	return &rbacRepository{
+		db: db,
+	}
+}
+
+type rbacRepository struct {
+	db *db.DB
+}
+
+func (r *rbacRepository) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	var roles []*model.Role
+	err := r.db.WithContext(ctx).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *rbacRepository) GetRole(ctx context.Context, name string) (*model.Role, error) {
+	role := &model.Role{}
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return role, err
+}
+
+func (r *rbacRepository) CreateRole(ctx context.Context, role *model.Role) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *rbacRepository) DeleteRole(ctx context.Context, name string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		role := &model.Role{}
+		err := tx.Where("name = ?", name).First(role).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return RecordNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.Id).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.Id).Delete(&model.UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
+func (r *rbacRepository) ListPermissions(ctx context.Context) ([]*model.Permission, error) {
+	var permissions []*model.Permission
+	err := r.db.WithContext(ctx).Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *rbacRepository) GetPermission(ctx context.Context, name string) (*model.Permission, error) {
+	permission := &model.Permission{}
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(permission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return permission, err
+}
+
+func (r *rbacRepository) CreatePermission(ctx context.Context, permission *model.Permission) error {
+	return r.db.WithContext(ctx).Create(permission).Error
+}
+
+func (r *rbacRepository) DeletePermission(ctx context.Context, name string) ([]string, error) {
+	var roles []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		permission := &model.Permission{}
+		err := tx.Where("name = ?", name).First(permission).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return RecordNotFound
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.Role{}).
+			Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
+			Where("role_permissions.permission_id = ?", permission.Id).
+			Pluck("roles.name", &roles).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("permission_id = ?", permission.Id).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(permission).Error
+	})
+	return roles, err
+}
+
+func (r *rbacRepository) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	var permissions []string
+	err := r.db.WithContext(ctx).Model(&model.Permission{}).
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", role).
+		Order("permissions.name").
+		Pluck("permissions.name", &permissions).Error
+	return permissions, err
+}
+
+func (r *rbacRepository) Grant(ctx context.Context, roleId, permissionId int64) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.RolePermission{RoleId: roleId, PermissionId: permissionId}).Error
+}
+
+func (r *rbacRepository) Revoke(ctx context.Context, roleId, permissionId int64) error {
+	return r.db.WithContext(ctx).
+		Where("role_id = ? AND permission_id = ?", roleId, permissionId).
+		Delete(&model.RolePermission{}).Error
+}
+
+func (r *rbacRepository) UserRoles(ctx context.Context, userId int) ([]string, error) {
+	var roles []string
+	err := r.db.WithContext(ctx).Model(&model.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Order("roles.name").
+		Pluck("roles.name", &roles).Error
+	return roles, err
+}
+
+func (r *rbacRepository) AssignRole(ctx context.Context, userId int, roleId int64) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.UserRole{UserId: userId, RoleId: roleId}).Error
+}
+
+func (r *rbacRepository) UnassignRole(ctx context.Context, userId int, roleId int64) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND role_id = ?", userId, roleId).
+		Delete(&model.UserRole{}).Error
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"service_template/pkg/jwt"
+
+	"gorm.io/gorm"
+)
+
+// RefreshTokenRepository 使用 refresh_tokens 表实现 refresh_store 为 db 时的存储
+type RefreshTokenRepository interface {
+	jwt.RefreshStore
+}
+
+func NewRefreshTokenRepository(db *db.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{
+		db: db,
+	}
+}
+
+type refreshTokenRepository struct {
+	db *db.DB
+}
+
+func (r *refreshTokenRepository) Save(ctx context.Context, t *jwt.RefreshToken) error {
+	return r.db.WithContext(ctx).Create(&model.RefreshToken{
+		Hash:      t.Hash,
+		Family:    t.Family,
+		UserId:    t.UserId,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: t.IssuedAt,
+	}).Error
+}
+
+func (r *refreshTokenRepository) Get(ctx context.Context, hash string) (*jwt.RefreshToken, error) {
+	t := &model.RefreshToken{}
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, jwt.ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &jwt.RefreshToken{
+		Hash:      t.Hash,
+		Family:    t.Family,
+		UserId:    t.UserId,
+		Used:      t.Used,
+		Revoked:   t.Revoked,
+		IssuedAt:  t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+	}, nil
+}
+
+func (r *refreshTokenRepository) MarkUsed(ctx context.Context, hash string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("hash = ? AND used = ?", hash, false).
+		Update("used", true)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, family string) error {
+	return r.db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("family = ?", family).
+		Update("revoked", true).Error
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"service_template/pkg/jwt"
+	"testing"
+	"time"
+)
+
+func testDB(t *testing.T) *db.DB {
+	database, err := db.NewDB(db.Option{Driver: db.Sqlite, DbName: t.TempDir() + "/repository.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+	// 与启动时迁移相同的表
+	if err := database.AutoMigrate(model.Tables...); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestRefreshTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	store := NewRefreshTokenRepository(testDB(t))
+	now := time.Now().Truncate(time.Second)
+	for _, hash := range []string{"h1", "h2"} {
+		err := store.Save(ctx, &jwt.RefreshToken{Hash: hash, Family: "f1", UserId: 1, IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := store.Get(ctx, "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Family != "f1" || got.UserId != 1 || got.Used || got.Revoked || !got.IssuedAt.Equal(now) || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected token %+v", got)
+	}
+	if _, err := store.Get(ctx, "missing"); err != jwt.ErrRefreshTokenNotFound {
+		t.Fatalf("expect ErrRefreshTokenNotFound, got %v", err)
+	}
+
+	// 只有第一次标记成功
+	if first, err := store.MarkUsed(ctx, "h1"); err != nil || !first {
+		t.Fatalf("first mark used: %v %v", first, err)
+	}
+	if first, _ := store.MarkUsed(ctx, "h1"); first {
+		t.Fatal("token marked used twice")
+	}
+
+	if err := store.RevokeFamily(ctx, "f1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get(ctx, "h2"); !got.Revoked {
+		t.Fatal("family not revoked")
+	}
+}
+
+func TestRefreshTokenRepositoryReuse(t *testing.T) {
+	ctx := context.Background()
+	m, err := jwt.NewManager(jwt.Option{Keys: []jwt.KeyOption{{Kid: "hs", Algorithm: jwt.HS256, Secret: "0123456789abcdef0123456789abcdef"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := jwt.NewRefresher(m, NewRefreshTokenRepository(testDB(t)), nil, nil)
+	pair, err := r.Issue(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := r.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重复使用旧 token 时整个族失效
+	if _, err := r.Refresh(ctx, pair.RefreshToken); !errors.Is(err, jwt.ErrRefreshTokenReused) {
+		t.Fatalf("expect ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := r.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		t.Fatalf("expect rotated token revoked, got %v", err)
+	}
+}
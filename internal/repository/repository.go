@@ -11,12 +11,28 @@ var (
 
 func NewRepository(db *db.DB) *Repository {
 	return &Repository{
-		ExampleRepository: NewExampleRepository(db),
+		ExampleRepository:      NewExampleRepository(db),
+		QuotaRepository:        NewQuotaRepository(db),
+		RbacRepository:         NewRbacRepository(db),
+		ApiKeyRepository:       NewApiKeyRepository(db),
+		UserRepository:         NewUserRepository(db),
+		TwoFactorRepository:    NewTwoFactorRepository(db),
+		IdentityRepository:     NewIdentityRepository(db),
+		SessionRepository:      NewSessionRepository(db),
+		RefreshTokenRepository: NewRefreshTokenRepository(db),
 	}
 }
 
 type Repository struct {
-	ExampleRepository ExampleRepository
+	ExampleRepository      ExampleRepository
+	QuotaRepository        QuotaRepository
+	RbacRepository         RbacRepository
+	ApiKeyRepository       ApiKeyRepository
+	UserRepository         UserRepository
+	TwoFactorRepository    TwoFactorRepository
+	IdentityRepository     IdentityRepository
+	SessionRepository      SessionRepository
+	RefreshTokenRepository RefreshTokenRepository
 }
 
 type ExampleRepository interface {
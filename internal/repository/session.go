@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	Get(ctx context.Context, id string) (*model.Session, error)
+	// ListActive 按最后活跃时间倒序返回未吊销且未过期的会话
+	ListActive(ctx context.Context, userId int, now time.Time) ([]*model.Session, error)
+	// Touch 记录未吊销会话的最后活跃时间、IP 并延长过期时间
+	Touch(ctx context.Context, id string, at time.Time, ip, location string, expiresAt time.Time) error
+	// Revoke 吊销会话，返回本次吊销的数量
+	Revoke(ctx context.Context, ids []string, at time.Time) (int64, error)
+}
+
+func NewSessionRepository(db *db.DB) SessionRepository {
+	return &sessionRepository{
+		db: db,
+	}
+}
+
+type sessionRepository struct {
+	db *db.DB
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *model.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *sessionRepository) Get(ctx context.Context, id string) (*model.Session, error) {
+	session := &model.Session{}
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return session, err
+}
+
+func (r *sessionRepository) ListActive(ctx context.Context, userId int, now time.Time) ([]*model.Session, error) {
+	var sessions []*model.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userId, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) Touch(ctx context.Context, id string, at time.Time, ip, location string, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"last_seen_at": at, "ip": ip, "location": location, "expires_at": expiresAt}).Error
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, ids []string, at time.Time) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", at)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TwoFactorRepository interface {
+	GetTotp(ctx context.Context, userId int) (*model.UserTotp, error)
+	// SaveTotp 保存未确认的 TOTP 密钥，覆盖此前未确认的密钥
+	SaveTotp(ctx context.Context, totp *model.UserTotp) error
+	// ConfirmTotp 确认绑定并替换恢复码，已确认时返回 RecordNotFound
+	ConfirmTotp(ctx context.Context, userId int, step int64, at time.Time, codes []string) error
+	// UseStep 记录通过验证的时间步，不大于上次使用的时间步时返回 false
+	UseStep(ctx context.Context, userId int, step int64) (bool, error)
+	// DeleteTotp 解除绑定并删除恢复码
+	DeleteTotp(ctx context.Context, userId int) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, codes []string) error
+	// ConsumeRecoveryCode 使用未使用过的恢复码，并发使用时只有一次成功
+	ConsumeRecoveryCode(ctx context.Context, userId int, hash string, now time.Time) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userId int) (int64, error)
+}
+
+func NewTwoFactorRepository(db *db.DB) TwoFactorRepository {
+	return &twoFactorRepository{
+		db: db,
+	}
+}
+
+type twoFactorRepository struct {
+	db *db.DB
+}
+
+func (r *twoFactorRepository) GetTotp(ctx context.Context, userId int) (*model.UserTotp, error) {
+	totp := &model.UserTotp{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userId).First(totp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return totp, err
+}
+
+func (r *twoFactorRepository) SaveTotp(ctx context.Context, totp *model.UserTotp) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", totp.UserId).Delete(&model.UserTotp{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(totp).Error
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId int, codes []string) error {
+	if err := tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	rows := make([]*model.RecoveryCode, 0, len(codes))
+	for _, hash := range codes {
+		rows = append(rows, &model.RecoveryCode{UserId: userId, Hash: hash})
+	}
+	return tx.Create(rows).Error
+}
+
+func (r *twoFactorRepository) ConfirmTotp(ctx context.Context, userId int, step int64, at time.Time, codes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.UserTotp{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userId).
+			Updates(map[string]interface{}{"confirmed_at": at, "last_used_step": step})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return RecordNotFound
+		}
+		return replaceRecoveryCodes(tx, userId, codes)
+	})
+}
+
+func (r *twoFactorRepository) UseStep(ctx context.Context, userId int, step int64) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.UserTotp{}).
+		Where("user_id = ? AND last_used_step < ?", userId, step).
+		Update("last_used_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *twoFactorRepository) DeleteTotp(ctx context.Context, userId int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&model.UserTotp{}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userId, nil)
+	})
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userId int, codes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userId, codes)
+	})
+}
+
+func (r *twoFactorRepository) ConsumeRecoveryCode(ctx context.Context, userId int, hash string, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userId, hash).
+		Update("used_at", now)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *twoFactorRepository) CountRecoveryCodes(ctx context.Context, userId int) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Count(&n).Error
+	return n, err
+}
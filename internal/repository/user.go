@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UserRepository interface {
+	Create(ctx context.Context, user *model.User) error
+	Get(ctx context.Context, id int) (*model.User, error)
+	GetByUsername(ctx context.Context, username string) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	UpdatePassword(ctx context.Context, id int, hash string) error
+	// SetLockedUntil until 为 nil 时解除锁定
+	SetLockedUntil(ctx context.Context, id int, until *time.Time) error
+	MarkEmailVerified(ctx context.Context, id int, at time.Time) error
+	CreateToken(ctx context.Context, token *model.UserToken) error
+	// ConsumeToken 使用未过期且未使用过的 token，并发使用时只有一次成功
+	ConsumeToken(ctx context.Context, purpose, hash string, now time.Time) (*model.UserToken, error)
+}
+
+func NewUserRepository(db *db.DB) UserRepository {
+	return &userRepository{
+		db: db,
+	}
+}
+
+type userRepository struct {
+	db *db.DB
+}
+
+func (r *userRepository) Create(ctx context.Context, user *model.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *userRepository) first(ctx context.Context, query string, args ...interface{}) (*model.User, error) {
+	user := &model.User{}
+	err := r.db.WithContext(ctx).Where(query, args...).First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, RecordNotFound
+	}
+	return user, err
+}
+
+func (r *userRepository) Get(ctx context.Context, id int) (*model.User, error) {
+	return r.first(ctx, "id = ?", id)
+}
+
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.first(ctx, "username = ?", username)
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.first(ctx, "email = ?", email)
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id int, hash string) error {
+	return r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Update("password_hash", hash).Error
+}
+
+func (r *userRepository) SetLockedUntil(ctx context.Context, id int, until *time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Update("locked_until", until).Error
+}
+
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id int, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", at).Error
+}
+
+func (r *userRepository) CreateToken(ctx context.Context, token *model.UserToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *userRepository) ConsumeToken(ctx context.Context, purpose, hash string, now time.Time) (*model.UserToken, error) {
+	token := &model.UserToken{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("hash = ? AND purpose = ?", hash, purpose).First(token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return RecordNotFound
+		}
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&model.UserToken{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", token.Id, now).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return RecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
@@ -5,25 +5,29 @@ import (
 	"github.com/gin-gonic/gin"
 	"service_template/internal/errors"
 	"service_template/pkg/logger"
+	"service_template/pkg/requestid"
 )
 
 type Response struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty" swaggertype:"object"`
+	// 请求 ID，与响应头 X-Request-ID 一致，用于排查问题
+	RequestId string `json:"request_id,omitempty"`
 }
 
 func HandleResponse(ctx *gin.Context, err error, req interface{}, data interface{}) {
+	requestId := requestid.FromContext(ctx.Request.Context())
 	if err != nil {
 		reqByte, _ := json.Marshal(req)
-		logger.Errorf("req params: %+v, err: %+v", string(reqByte), err)
+		logger.WithContext(ctx.Request.Context()).Errorf("req params: %+v, err: %+v", string(reqByte), err)
 		var e = new(errors.Error)
 		if errors.As(err, e) {
-			ctx.JSON(200, Response{Code: e.Code(), Message: e.Message()})
+			ctx.JSON(200, Response{Code: e.Code(), Message: e.Message(), RequestId: requestId})
 		} else {
-			ctx.JSON(200, Response{Code: errors.InternalError.Code(), Message: errors.InternalError.Message()})
+			ctx.JSON(200, Response{Code: errors.InternalError.Code(), Message: errors.InternalError.Message(), RequestId: requestId})
 		}
 		return
 	}
-	ctx.JSON(200, Response{Code: errors.Success.Code(), Message: errors.Success.Message(), Data: data})
+	ctx.JSON(200, Response{Code: errors.Success.Code(), Message: errors.Success.Message(), Data: data, RequestId: requestId})
 }
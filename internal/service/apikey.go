@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/logger"
+	"strings"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+type ApiKeyOption struct {
+	// key 的前缀，便于在日志和代码扫描中识别，默认 sk_
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// 计算哈希使用的密钥，为空时使用 SHA-256，修改后已签发的 key 全部失效
+	Secret string `json:"secret" yaml:"secret"`
+	// 未指定有效期时的默认有效期，单位秒，0 表示不过期
+	DefaultTtl int `json:"default_ttl" yaml:"default_ttl"`
+	// 轮换后旧 key 继续有效的时间，单位秒，默认 86400
+	RotationGrace int `json:"rotation_grace" yaml:"rotation_grace"`
+	// 记录最后使用时间的最小间隔，单位秒，默认 60
+	TouchInterval int `json:"touch_interval" yaml:"touch_interval"`
+}
+
+// IssuedApiKey 新签发的 key，明文只在签发时返回一次
+type IssuedApiKey struct {
+	Key    string        `json:"key"`
+	ApiKey *model.ApiKey `json:"api_key"`
+}
+
+type ApiKeyService interface {
+	// Issue 签发 key，ttl 为 0 时使用默认有效期，单位秒；scopes 只能是用户角色已拥有的权限
+	Issue(ctx context.Context, p *common.Principal, name string, scopes []string, ttl int) (*IssuedApiKey, error)
+	List(ctx context.Context, userId int) ([]*model.ApiKey, error)
+	Revoke(ctx context.Context, userId int, id int64) error
+	// Rotate 签发相同权限的新 key，旧 key 在宽限期后失效
+	Rotate(ctx context.Context, userId int, id int64) (*IssuedApiKey, error)
+	// Authenticate 校验 key 并记录最后使用的时间和 IP，返回的 Roles 为 key 所属用户当前的角色
+	Authenticate(ctx context.Context, key, ip string) (*common.Principal, error)
+}
+
+func NewApiKeyService(repo repository.ApiKeyRepository, rbac RbacService, opt ApiKeyOption) ApiKeyService {
+	if opt.Prefix == "" {
+		opt.Prefix = "sk_"
+	}
+	if opt.RotationGrace <= 0 {
+		opt.RotationGrace = 86400
+	}
+	if opt.TouchInterval <= 0 {
+		opt.TouchInterval = 60
+	}
+	return &apiKeyService{
+		repo: repo,
+		rbac: rbac,
+		opt:  opt,
+		// key 最近一次记录使用的时间
+		touched: gocache.New(time.Duration(opt.TouchInterval)*time.Second, 10*time.Minute),
+		now:     time.Now,
+	}
+}
+
+type apiKeyService struct {
+	repo    repository.ApiKeyRepository
+	rbac    RbacService
+	opt     ApiKeyOption
+	touched *gocache.Cache
+	now     func() time.Time
+}
+
+func (s *apiKeyService) hash(key string) string {
+	if s.opt.Secret == "" {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, []byte(s.opt.Secret))
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generate 生成 32 字节随机数编码的 key
+func (s *apiKeyService) generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return s.opt.Prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *apiKeyService) newKey(from *model.ApiKey) (string, *model.ApiKey, error) {
+	key, err := s.generate()
+	if err != nil {
+		return "", nil, err
+	}
+	k := &model.ApiKey{
+		Name:      from.Name,
+		Prefix:    key[:len(s.opt.Prefix)+6],
+		Hash:      s.hash(key),
+		UserId:    from.UserId,
+		TenantId:  from.TenantId,
+		Scopes:    from.Scopes,
+		ExpiresAt: from.ExpiresAt,
+	}
+	return key, k, nil
+}
+
+func (s *apiKeyService) Issue(ctx context.Context, p *common.Principal, name string, scopes []string, ttl int) (*IssuedApiKey, error) {
+	if ttl == 0 {
+		ttl = s.opt.DefaultTtl
+	}
+	if ttl < 0 {
+		return nil, errors.Wrap(errors.BadParameters, "invalid ttl")
+	}
+	// key 的权限不能超出用户自己的权限
+	roles, err := s.rbac.UserRoles(ctx, p.UserId)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		allowed, err := s.rbac.Authorize(ctx, roles, scope)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, errors.Wrap(errors.Forbidden, "scope "+scope+" not granted")
+		}
+	}
+	from := &model.ApiKey{Name: name, UserId: p.UserId, TenantId: p.TenantId, Scopes: scopes}
+	if ttl > 0 {
+		expiresAt := s.now().Add(time.Duration(ttl) * time.Second)
+		from.ExpiresAt = &expiresAt
+	}
+	key, k, err := s.newKey(from)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, k); err != nil {
+		return nil, err
+	}
+	return &IssuedApiKey{Key: key, ApiKey: k}, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, userId int) ([]*model.ApiKey, error) {
+	return s.repo.ListByUser(ctx, userId)
+}
+
+// get 返回用户自己的 key，不存在或属于其他用户时返回 NotFound
+func (s *apiKeyService) get(ctx context.Context, userId int, id int64) (*model.ApiKey, error) {
+	k, err := s.repo.Get(ctx, id)
+	if err == repository.RecordNotFound || (err == nil && k.UserId != userId) {
+		return nil, errors.Wrap(errors.NotFound, fmt.Sprintf("api key %d", id))
+	}
+	return k, err
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, userId int, id int64) error {
+	if _, err := s.get(ctx, userId, id); err != nil {
+		return err
+	}
+	return s.repo.Revoke(ctx, id, s.now())
+}
+
+func (s *apiKeyService) Rotate(ctx context.Context, userId int, id int64) (*IssuedApiKey, error) {
+	old, err := s.get(ctx, userId, id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if old.RevokedAt != nil || (old.ExpiresAt != nil && !old.ExpiresAt.After(now)) {
+		return nil, errors.Wrap(errors.BadParameters, "api key revoked or expired")
+	}
+	key, k, err := s.newKey(old)
+	if err != nil {
+		return nil, err
+	}
+	k.RotatedFrom = old.Id
+	if err := s.repo.Rotate(ctx, k, now.Add(time.Duration(s.opt.RotationGrace)*time.Second)); err != nil {
+		return nil, err
+	}
+	return &IssuedApiKey{Key: key, ApiKey: k}, nil
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, key, ip string) (*common.Principal, error) {
+	if !strings.HasPrefix(key, s.opt.Prefix) {
+		return nil, errors.Wrap(errors.Unauthorized, "invalid api key")
+	}
+	k, err := s.repo.GetByHash(ctx, s.hash(key))
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.Unauthorized, "invalid api key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if k.RevokedAt != nil {
+		return nil, errors.Wrap(errors.Unauthorized, "api key revoked")
+	}
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return nil, errors.Wrap(errors.Unauthorized, "api key expired")
+	}
+	roles, err := s.rbac.UserRoles(ctx, k.UserId)
+	if err != nil {
+		return nil, err
+	}
+	s.touch(ctx, k, now, ip)
+	p := &common.Principal{
+		UserId:     k.UserId,
+		TenantId:   k.TenantId,
+		TokenId:    fmt.Sprintf("apikey:%d", k.Id),
+		AuthMethod: common.AuthMethodApiKey,
+		Roles:      roles,
+		Scopes:     k.Scopes,
+		IssuedAt:   k.CreatedAt,
+	}
+	if k.ExpiresAt != nil {
+		p.ExpiresAt = *k.ExpiresAt
+	}
+	return p, nil
+}
+
+// touch 按间隔记录最后使用的时间和 IP，IP 变化时立即记录
+func (s *apiKeyService) touch(ctx context.Context, k *model.ApiKey, now time.Time, ip string) {
+	cacheKey := fmt.Sprint(k.Id)
+	if v, ok := s.touched.Get(cacheKey); ok && v.(string) == ip {
+		return
+	}
+	if k.LastUsedAt != nil && k.LastUsedIp == ip && now.Sub(*k.LastUsedAt) < time.Duration(s.opt.TouchInterval)*time.Second {
+		s.touched.SetDefault(cacheKey, ip)
+		return
+	}
+	if err := s.repo.Touch(ctx, k.Id, now, ip); err != nil {
+		// 不影响本次认证
+		logger.WithContext(ctx).Errorf("record api key %d usage error: %v", k.Id, err)
+		return
+	}
+	s.touched.SetDefault(cacheKey, ip)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"testing"
+)
+
+func TestApiKeyScopes(t *testing.T) {
+	database := testDB(t)
+	ctx := context.Background()
+	rbac := NewRbacService(repository.NewRbacRepository(database), nil, RbacOption{})
+	srv := NewApiKeyService(repository.NewApiKeyRepository(database), rbac, ApiKeyOption{})
+	if _, err := rbac.CreateRole(ctx, "editor", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rbac.CreatePermission(ctx, "order:read", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.Grant(ctx, "editor", "order:read"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.AssignRole(ctx, 1, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	p := &common.Principal{AuthMethod: common.AuthMethodToken, UserId: 1, TenantId: "tenant"}
+
+	// 用户没有的权限不能授予 key
+	_, err := srv.Issue(ctx, p, "admin", []string{"rbac:manage"}, 0)
+	if !errors.Is(err, errors.Forbidden) {
+		t.Fatalf("expect forbidden, got %v", err)
+	}
+	issued, err := srv.Issue(ctx, p, "reader", []string{"order:read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// key 认证后携带用户当前的角色
+	principal, err := srv.Authenticate(ctx, issued.Key, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(principal.Roles) != 1 || principal.Roles[0] != "editor" || !principal.HasScope("order:read") {
+		t.Fatalf("unexpected principal: %+v", principal)
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/pkg/jwt"
+	"service_template/pkg/logger"
+)
+
+type AuthService interface {
+	// Authenticate 校验 access token，返回调用方身份
+	Authenticate(ctx context.Context, token string) (*common.Principal, error)
+	// Login 校验密码，开启二次验证的用户只返回 challenge，需调用 VerifyTwoFactor 换取 token
+	Login(ctx context.Context, username, password string, device Device) (*LoginResult, error)
+	// LoginOidc 处理 OIDC 提供方的登录回调，与密码登录同样检查账号锁定和邮箱验证，开启二次验证的用户同样只返回 challenge
+	LoginOidc(ctx context.Context, provider, state, code string, device Device) (*LoginResult, error)
+	// VerifyTwoFactor 校验登录的 challenge 和验证码或恢复码，通过后签发 token
+	VerifyTwoFactor(ctx context.Context, challenge, code string, device Device) (*jwt.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*jwt.TokenPair, error)
+	// Logout 登出当前会话，accessToken 不为空时同时吊销该 token
+	Logout(ctx context.Context, refreshToken, accessToken string) error
+	// LogoutAll 在所有设备上登出，吊销用户此前签发的所有 token 和会话
+	LogoutAll(ctx context.Context, userId int) error
+}
+
+// LoginResult 未开启二次验证时为 token 对，否则只包含 challenge
+type LoginResult struct {
+	*jwt.TokenPair
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+}
+
+func NewAuthService(m *jwt.Manager, store jwt.RefreshStore, revoker *jwt.Revoker, rbac RbacService, users UserService, twoFactor TwoFactorService, oidc OidcService, sessions SessionService) AuthService {
+	s := &authService{
+		m:         m,
+		revoker:   revoker,
+		rbac:      rbac,
+		users:     users,
+		twoFactor: twoFactor,
+		oidc:      oidc,
+		sessions:  sessions,
+	}
+	s.refresher = jwt.NewRefresher(m, store, revoker, s.claims)
+	return s
+}
+
+type authService struct {
+	m         *jwt.Manager
+	refresher *jwt.Refresher
+	revoker   *jwt.Revoker
+	rbac      RbacService
+	users     UserService
+	twoFactor TwoFactorService
+	oidc      OidcService
+	sessions  SessionService
+}
+
+// claims 加载签入 access token 的用户信息，角色变更在下次刷新 token 后生效
+func (s *authService) claims(ctx context.Context, userId int) (*jwt.UserClaims, error) {
+	user, err := s.users.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.rbac.UserRoles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &jwt.UserClaims{TenantId: user.TenantId, Roles: roles}, nil
+}
+
+func (s *authService) Authenticate(ctx context.Context, token string) (*common.Principal, error) {
+	claims, err := s.m.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	p := &common.Principal{
+		AuthMethod: common.AuthMethodToken,
+		UserId:     claims.UserId,
+		TenantId:   claims.TenantId,
+		SessionId:  claims.SessionId,
+		TokenId:    claims.ID,
+		Roles:      claims.Roles,
+		Scopes:     claims.Scopes,
+		Extensions: claims.Extensions,
+	}
+	if claims.IssuedAt != nil {
+		p.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		p.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return p, nil
+}
+
+func (s *authService) Login(ctx context.Context, username, password string, device Device) (*LoginResult, error) {
+	user, err := s.users.Verify(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return s.login(ctx, user.Id, device)
+}
+
+func (s *authService) LoginOidc(ctx context.Context, provider, state, code string, device Device) (*LoginResult, error) {
+	user, err := s.oidc.Login(ctx, provider, state, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.CheckLogin(ctx, user); err != nil {
+		return nil, err
+	}
+	return s.login(ctx, user.Id, device)
+}
+
+// issue 签发新的 token 族并记录会话
+func (s *authService) issue(ctx context.Context, userId int, device Device) (*jwt.TokenPair, error) {
+	pair, err := s.refresher.Issue(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.Create(ctx, userId, pair.SessionId, device); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// login 第一步验证通过后签发 token，开启二次验证时只返回 challenge
+func (s *authService) login(ctx context.Context, userId int, device Device) (*LoginResult, error) {
+	enabled, err := s.twoFactor.Enabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		challenge, err := s.twoFactor.NewChallenge(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{TwoFactorRequired: true, Challenge: challenge}, nil
+	}
+	pair, err := s.issue(ctx, userId, device)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{TokenPair: pair}, nil
+}
+
+func (s *authService) VerifyTwoFactor(ctx context.Context, challenge, code string, device Device) (*jwt.TokenPair, error) {
+	userId, err := s.twoFactor.VerifyChallenge(ctx, challenge, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, userId, device)
+}
+
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*jwt.TokenPair, error) {
+	pair, err := s.refresher.Refresh(ctx, refreshToken)
+	switch {
+	case err == nil:
+		return pair, nil
+	case errors.Is(err, jwt.ErrRefreshTokenReused):
+		logger.WithContext(ctx).Warnf("refresh token reused, token family revoked")
+		return nil, errors.Wrap(errors.Unauthorized, err.Error())
+	case errors.Is(err, jwt.ErrInvalidRefreshToken):
+		return nil, errors.Wrap(errors.Unauthorized, err.Error())
+	default:
+		return nil, err
+	}
+}
+
+func (s *authService) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	if t, err := s.refresher.Lookup(ctx, refreshToken); err == nil {
+		if err := s.sessions.Revoke(ctx, t.UserId, t.Family); err != nil && !errors.Is(err, errors.NotFound) {
+			return err
+		}
+	}
+	if err := s.refresher.Revoke(ctx, refreshToken); err != nil {
+		return err
+	}
+	if accessToken == "" {
+		return nil
+	}
+	claims, err := s.m.Parse(accessToken)
+	if err != nil {
+		// access token 已失效，无需吊销
+		return nil
+	}
+	return s.revoker.RevokeToken(ctx, claims)
+}
+
+func (s *authService) LogoutAll(ctx context.Context, userId int) error {
+	if err := s.revoker.RevokeUser(ctx, userId); err != nil {
+		return err
+	}
+	return s.sessions.RevokeOthers(ctx, userId, "")
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"service_template/pkg/oidc"
+	"time"
+)
+
+type OidcOption struct {
+	oidc.Option `json:",inline" yaml:",inline"`
+	// 外部身份未关联本地用户时自动注册，提供方须返回邮箱
+	AutoRegister bool `json:"auto_register" yaml:"auto_register"`
+	// 提供方已验证的邮箱与本地已验证的邮箱一致时自动关联，只对可信的提供方开启
+	LinkByEmail bool `json:"link_by_email" yaml:"link_by_email"`
+}
+
+type OidcService interface {
+	// Providers 返回已配置的提供方
+	Providers() []string
+	// AuthURL 返回登录的授权地址
+	AuthURL(ctx context.Context, provider string) (string, error)
+	// LinkURL 返回为用户关联外部身份的授权地址
+	LinkURL(ctx context.Context, provider string, userId int) (string, error)
+	// Login 处理登录回调，返回外部身份关联的用户
+	Login(ctx context.Context, provider, state, code string) (*model.User, error)
+	// Link 处理关联回调，每个提供方只能关联一个外部身份
+	Link(ctx context.Context, userId int, provider, state, code string) (*model.UserIdentity, error)
+	Identities(ctx context.Context, userId int) ([]*model.UserIdentity, error)
+	// Unlink 解除关联，用户没有密码时不能解除最后一个外部身份
+	Unlink(ctx context.Context, userId int, provider string) error
+}
+
+func NewOidcService(repo repository.IdentityRepository, users UserService, rdb cache.Cache, opt OidcOption) OidcService {
+	client, err := oidc.NewClient(opt.Option, rdb)
+	if err != nil {
+		panic(err)
+	}
+	return &oidcService{
+		repo:   repo,
+		users:  users,
+		client: client,
+		opt:    opt,
+		now:    time.Now,
+	}
+}
+
+type oidcService struct {
+	repo   repository.IdentityRepository
+	users  UserService
+	client *oidc.Client
+	opt    OidcOption
+	now    func() time.Time
+}
+
+func oidcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, oidc.ErrUnknownProvider):
+		return errors.Wrap(errors.NotFound, err.Error())
+	case errors.Is(err, oidc.ErrInvalidState), errors.Is(err, oidc.ErrExchange), errors.Is(err, oidc.ErrInvalidIdToken):
+		logger.WithContext(ctx).Warnf("oidc callback rejected: %v", err)
+		return errors.Wrap(errors.Unauthorized, err.Error())
+	default:
+		return err
+	}
+}
+
+func linkData(userId int) string {
+	return fmt.Sprintf("link:%d", userId)
+}
+
+func (s *oidcService) Providers() []string {
+	return s.client.Providers()
+}
+
+func (s *oidcService) AuthURL(ctx context.Context, provider string) (string, error) {
+	u, err := s.client.AuthURL(ctx, provider, "")
+	return u, oidcError(ctx, err)
+}
+
+func (s *oidcService) LinkURL(ctx context.Context, provider string, userId int) (string, error) {
+	u, err := s.client.AuthURL(ctx, provider, linkData(userId))
+	return u, oidcError(ctx, err)
+}
+
+// resolve 为未关联的外部身份查找或注册本地用户
+func (s *oidcService) resolve(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	if claims.Email != "" {
+		user, err := s.users.GetByEmail(ctx, claims.Email)
+		if err == nil {
+			// 未经双方验证的邮箱可能被他人注册，不能据此关联
+			if s.opt.LinkByEmail && claims.EmailVerified && user.EmailVerifiedAt != nil {
+				return user, nil
+			}
+			return nil, errors.Wrap(errors.BadParameters, "email exists, log in and link the identity")
+		}
+		if !errors.Is(err, errors.NotFound) {
+			return nil, err
+		}
+	}
+	if !s.opt.AutoRegister {
+		return nil, errors.Wrap(errors.Unauthorized, "identity not linked")
+	}
+	if claims.Email == "" {
+		return nil, errors.Wrap(errors.BadParameters, "provider did not return email")
+	}
+	return s.users.RegisterExternal(ctx, claims.PreferredUsername, claims.Email, claims.EmailVerified)
+}
+
+func (s *oidcService) Login(ctx context.Context, provider, state, code string) (*model.User, error) {
+	res, err := s.client.Callback(ctx, provider, state, code)
+	if err != nil {
+		return nil, oidcError(ctx, err)
+	}
+	return s.login(ctx, provider, res)
+}
+
+// login 返回外部身份关联的用户，未关联时按配置关联已有用户或注册
+func (s *oidcService) login(ctx context.Context, provider string, res *oidc.Result) (*model.User, error) {
+	if res.Data != "" {
+		return nil, errors.Wrap(errors.Unauthorized, oidc.ErrInvalidState.Error())
+	}
+	identity, err := s.repo.Get(ctx, provider, res.Claims.Subject)
+	if err == nil {
+		if err := s.repo.Touch(ctx, identity.Id, s.now()); err != nil {
+			logger.WithContext(ctx).Errorf("touch identity %d error: %v", identity.Id, err)
+		}
+		return s.users.Get(ctx, identity.UserId)
+	}
+	if err != repository.RecordNotFound {
+		return nil, err
+	}
+	user, err := s.resolve(ctx, res.Claims)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	err = s.repo.Create(ctx, &model.UserIdentity{
+		UserId:      user.Id,
+		Provider:    provider,
+		Subject:     res.Claims.Subject,
+		Email:       res.Claims.Email,
+		LastLoginAt: &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *oidcService) Link(ctx context.Context, userId int, provider, state, code string) (*model.UserIdentity, error) {
+	res, err := s.client.Callback(ctx, provider, state, code)
+	if err != nil {
+		return nil, oidcError(ctx, err)
+	}
+	return s.link(ctx, userId, provider, res)
+}
+
+func (s *oidcService) link(ctx context.Context, userId int, provider string, res *oidc.Result) (*model.UserIdentity, error) {
+	// state 须由该用户发起，避免将他人的外部身份关联到当前用户
+	if res.Data != linkData(userId) {
+		return nil, errors.Wrap(errors.Unauthorized, oidc.ErrInvalidState.Error())
+	}
+	identity, err := s.repo.Get(ctx, provider, res.Claims.Subject)
+	if err == nil {
+		if identity.UserId != userId {
+			return nil, errors.Wrap(errors.BadParameters, "identity linked to another user")
+		}
+		return identity, nil
+	}
+	if err != repository.RecordNotFound {
+		return nil, err
+	}
+	identities, err := s.repo.List(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range identities {
+		if i.Provider == provider {
+			return nil, errors.Wrap(errors.BadParameters, fmt.Sprintf("%s identity already linked", provider))
+		}
+	}
+	identity = &model.UserIdentity{
+		UserId:   userId,
+		Provider: provider,
+		Subject:  res.Claims.Subject,
+		Email:    res.Claims.Email,
+	}
+	if err := s.repo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (s *oidcService) Identities(ctx context.Context, userId int) ([]*model.UserIdentity, error) {
+	return s.repo.List(ctx, userId)
+}
+
+func (s *oidcService) Unlink(ctx context.Context, userId int, provider string) error {
+	user, err := s.users.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == "" {
+		identities, err := s.repo.List(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if len(identities) <= 1 {
+			return errors.Wrap(errors.BadParameters, "set a password before unlinking the last identity")
+		}
+	}
+	n, err := s.repo.Delete(ctx, userId, provider)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.Wrap(errors.NotFound, fmt.Sprintf("%s identity", provider))
+	}
+	return nil
+}
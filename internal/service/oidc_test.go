@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/pkg/oidc"
+	"testing"
+)
+
+func newTestOidcService(t *testing.T, opt OidcOption) (*oidcService, *userService, *captureMailer) {
+	database := testDB(t)
+	users, _, mailer := newTestUserService(t, database)
+	s := NewOidcService(repository.NewIdentityRepository(database), users, testCache(t), opt).(*oidcService)
+	return s, users, mailer
+}
+
+func TestOidcResolve(t *testing.T) {
+	ctx := context.Background()
+	alice := &oidc.Claims{Email: "alice@example.com", EmailVerified: true}
+	alice.Subject = "alice"
+	unverified := &oidc.Claims{Email: "alice@example.com"}
+	unverified.Subject = "alice"
+	cases := []struct {
+		name          string
+		opt           OidcOption
+		localVerified bool
+		claims        *oidc.Claims
+		err           error
+	}{
+		{"both verified", OidcOption{LinkByEmail: true}, true, alice, nil},
+		{"link by email disabled", OidcOption{}, true, alice, errors.BadParameters},
+		{"local email not verified", OidcOption{LinkByEmail: true}, false, alice, errors.BadParameters},
+		{"provider email not verified", OidcOption{LinkByEmail: true}, true, unverified, errors.BadParameters},
+	}
+	for _, c := range cases {
+		s, users, mailer := newTestOidcService(t, c.opt)
+		if c.localVerified {
+			if err := users.VerifyEmail(ctx, mailer.token); err != nil {
+				t.Fatal(err)
+			}
+		}
+		user, err := s.resolve(ctx, c.claims)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s: expect %v, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil || user.Username != "alice" {
+			t.Errorf("%s: expect alice, got %v %v", c.name, user, err)
+		}
+	}
+}
+
+func TestOidcResolveRegister(t *testing.T) {
+	ctx := context.Background()
+	claims := &oidc.Claims{Email: "bob@example.com", EmailVerified: true, PreferredUsername: "bob"}
+	s, _, _ := newTestOidcService(t, OidcOption{})
+	if _, err := s.resolve(ctx, claims); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect unauthorized without auto register, got %v", err)
+	}
+	s.opt.AutoRegister = true
+	user, err := s.resolve(ctx, claims)
+	if err != nil || user.Email != "bob@example.com" || user.EmailVerifiedAt == nil || user.PasswordHash != "" {
+		t.Fatalf("unexpected registered user %+v, error %v", user, err)
+	}
+	if _, err := s.resolve(ctx, &oidc.Claims{}); !errors.Is(err, errors.BadParameters) {
+		t.Fatalf("expect bad parameters without email, got %v", err)
+	}
+}
+
+func TestOidcLogin(t *testing.T) {
+	ctx := context.Background()
+	s, users, mailer := newTestOidcService(t, OidcOption{LinkByEmail: true})
+	if err := users.VerifyEmail(ctx, mailer.token); err != nil {
+		t.Fatal(err)
+	}
+	res := &oidc.Result{Claims: &oidc.Claims{Email: "alice@example.com", EmailVerified: true}}
+	res.Claims.Subject = "alice"
+	user, err := s.login(ctx, "fake", res)
+	if err != nil || user.Username != "alice" {
+		t.Fatalf("expect alice, got %v %v", user, err)
+	}
+	// 已关联的身份不再按邮箱查找
+	res.Claims.Email = ""
+	if user, err := s.login(ctx, "fake", res); err != nil || user.Username != "alice" {
+		t.Fatalf("expect linked alice, got %v %v", user, err)
+	}
+	// 关联流程发起的 state 不能用于登录
+	res.Data = linkData(user.Id)
+	if _, err := s.login(ctx, "fake", res); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect unauthorized, got %v", err)
+	}
+}
+
+func TestOidcLink(t *testing.T) {
+	ctx := context.Background()
+	s, users, _ := newTestOidcService(t, OidcOption{})
+	alice, _ := users.GetByEmail(ctx, "alice@example.com")
+	bob, err := users.Register(ctx, "bob", "bob@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &oidc.Result{Claims: &oidc.Claims{}, Data: linkData(bob.Id)}
+	res.Claims.Subject = "subject-1"
+	// state 由其他用户发起
+	if _, err := s.link(ctx, alice.Id, "fake", res); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect unauthorized, got %v", err)
+	}
+	res.Data = linkData(alice.Id)
+	identity, err := s.link(ctx, alice.Id, "fake", res)
+	if err != nil || identity.UserId != alice.Id {
+		t.Fatalf("link failed: %+v %v", identity, err)
+	}
+	// 已关联其他用户的身份
+	res.Data = linkData(bob.Id)
+	if _, err := s.link(ctx, bob.Id, "fake", res); !errors.Is(err, errors.BadParameters) {
+		t.Fatalf("expect bad parameters, got %v", err)
+	}
+	// 每个提供方只能关联一个身份
+	res.Data = linkData(alice.Id)
+	res.Claims.Subject = "subject-2"
+	if _, err := s.link(ctx, alice.Id, "fake", res); !errors.Is(err, errors.BadParameters) {
+		t.Fatalf("expect bad parameters, got %v", err)
+	}
+}
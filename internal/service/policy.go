@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/common"
+	"service_template/internal/errors"
+	"service_template/pkg/policy"
+	"strconv"
+)
+
+// PolicySubject 将认证的身份转换为策略的主体
+func PolicySubject(p *common.Principal) policy.Subject {
+	return policy.Subject{
+		Id:         strconv.Itoa(p.UserId),
+		TenantId:   p.TenantId,
+		Roles:      p.Roles,
+		Attributes: p.Extensions,
+	}
+}
+
+// Authorize 检查 principal 能否对 resource 执行 action，拒绝时返回 errors.Forbidden
+func Authorize(ctx context.Context, engine *policy.Engine, p *common.Principal, action string, resource policy.Resource) error {
+	err := engine.Authorize(ctx, &policy.Request{
+		Subject:  PolicySubject(p),
+		Action:   action,
+		Resource: resource,
+	})
+	if errors.Is(err, policy.ErrDenied) {
+		return errors.Wrap(errors.Forbidden, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"service_template/pkg/ratelimiter"
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+const (
+	// OverageReject 超出配额后拒绝请求
+	OverageReject = "reject"
+	// OverageAllow 超出配额后继续放行并记录超出用量，可由 OverageLimit 限制超出数量
+	OverageAllow = "allow"
+)
+
+type PlanOption struct {
+	Name string `json:"name" yaml:"name"`
+	// 每日配额，0 表示不限制
+	DailyLimit int64 `json:"daily_limit" yaml:"daily_limit"`
+	// 每月配额，0 表示不限制
+	MonthlyLimit int64  `json:"monthly_limit" yaml:"monthly_limit"`
+	Overage      string `json:"overage" yaml:"overage"`
+	OverageLimit int64  `json:"overage_limit" yaml:"overage_limit"`
+}
+
+type QuotaOption struct {
+	Enable bool `json:"enable" yaml:"enable"`
+	// Redis key 前缀
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// 用量持久化间隔，单位秒，默认 60
+	FlushInterval int `json:"flush_interval" yaml:"flush_interval"`
+	// 未指定套餐的租户使用的套餐，为空时不限制
+	DefaultPlan string       `json:"default_plan" yaml:"default_plan"`
+	Plans       []PlanOption `json:"plans" yaml:"plans"`
+	// 租户与套餐的对应关系，数据库中的配置优先
+	Tenants map[string]string `json:"tenants" yaml:"tenants"`
+}
+
+type QuotaResult struct {
+	Allowed bool   `json:"allowed"`
+	Plan    string `json:"plan"`
+	// 是否已超出配额（overage 为 allow 时）
+	Overage bool                `json:"overage"`
+	Usages  []*QuotaPeriodUsage `json:"usages"`
+}
+
+type QuotaPeriodUsage struct {
+	Period    string    `json:"period"`
+	PeriodId  string    `json:"period_id"`
+	Used      int64     `json:"used"`
+	Limit     int64     `json:"limit"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+type QuotaService interface {
+	// Consume 消耗租户 n 个配额
+	Consume(ctx context.Context, tenantId string, n int64) (*QuotaResult, error)
+	// Usage 返回租户当前周期的用量
+	Usage(ctx context.Context, tenantId string) (*QuotaResult, error)
+	// Start 开始定期持久化用量
+	Start()
+	// Stop 停止定期持久化，并持久化剩余用量
+	Stop(ctx context.Context) error
+}
+
+type usageKey struct {
+	tenantId string
+	period   ratelimiter.Period
+	periodId string
+}
+
+func NewQuotaService(repo repository.QuotaRepository, rdb *cache.Redis, opt QuotaOption) QuotaService {
+	if opt.Enable && rdb == nil {
+		panic("quota requires redis")
+	}
+	if opt.FlushInterval <= 0 {
+		opt.FlushInterval = 60
+	}
+	plans := make(map[string]*PlanOption, len(opt.Plans))
+	for i := range opt.Plans {
+		plans[opt.Plans[i].Name] = &opt.Plans[i]
+	}
+	return &quotaService{
+		repo:     repo,
+		counter:  ratelimiter.NewQuotaCounter(rdb, opt.Prefix, nil),
+		opt:      opt,
+		plans:    plans,
+		cache:    gocache.New(time.Minute, 10*time.Minute),
+		dirty:    make(map[usageKey]struct{}),
+		restored: make(map[usageKey]time.Time),
+		done:     make(chan struct{}),
+	}
+}
+
+type quotaService struct {
+	repo    repository.QuotaRepository
+	counter *ratelimiter.QuotaCounter
+	opt     QuotaOption
+	plans   map[string]*PlanOption
+	// 租户对应的套餐
+	cache *gocache.Cache
+
+	m sync.Mutex
+	// 待持久化的用量
+	dirty map[usageKey]struct{}
+	// 已从数据库恢复过的计数及其周期的结束时间，周期结束后清除
+	restored map[usageKey]time.Time
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *quotaService) plan(ctx context.Context, tenantId string) (*PlanOption, error) {
+	if v, ok := s.cache.Get(tenantId); ok {
+		return v.(*PlanOption), nil
+	}
+	name := s.opt.DefaultPlan
+	if n, ok := s.opt.Tenants[tenantId]; ok {
+		name = n
+	}
+	tp, err := s.repo.GetTenantPlan(ctx, tenantId)
+	if err == nil {
+		name = tp.PlanName
+	} else if err != repository.RecordNotFound {
+		return nil, err
+	}
+	var plan *PlanOption
+	if name != "" {
+		p, err := s.repo.GetPlan(ctx, name)
+		switch err {
+		case nil:
+			plan = &PlanOption{
+				Name:         p.Name,
+				DailyLimit:   p.DailyLimit,
+				MonthlyLimit: p.MonthlyLimit,
+				Overage:      p.Overage,
+				OverageLimit: p.OverageLimit,
+			}
+		case repository.RecordNotFound:
+			if plan = s.plans[name]; plan == nil {
+				logger.WithContext(ctx).Warnf("quota plan %s of tenant %s not found", name, tenantId)
+			}
+		default:
+			return nil, err
+		}
+	}
+	s.cache.SetDefault(tenantId, plan)
+	return plan, nil
+}
+
+func (s *quotaService) limits(plan *PlanOption) ([]ratelimiter.QuotaLimit, []int64) {
+	var (
+		limits []ratelimiter.QuotaLimit
+		quotas []int64
+	)
+	add := func(period ratelimiter.Period, quota int64) {
+		if quota <= 0 {
+			return
+		}
+		hard := quota
+		if plan.Overage == OverageAllow {
+			hard = 0
+			if plan.OverageLimit > 0 {
+				hard = quota + plan.OverageLimit
+			}
+		}
+		limits = append(limits, ratelimiter.QuotaLimit{Period: period, HardLimit: hard})
+		quotas = append(quotas, quota)
+	}
+	add(ratelimiter.PeriodDay, plan.DailyLimit)
+	add(ratelimiter.PeriodMonth, plan.MonthlyLimit)
+	return limits, quotas
+}
+
+// restore Redis 中的计数丢失时，以数据库中持久化的用量恢复，每个周期只恢复一次
+func (s *quotaService) restore(ctx context.Context, tenantId string, limits []ratelimiter.QuotaLimit) error {
+	now := time.Now()
+	for _, l := range limits {
+		id, end := l.Period.Window(now)
+		key := usageKey{tenantId: tenantId, period: l.Period, periodId: id}
+		s.m.Lock()
+		_, ok := s.restored[key]
+		s.m.Unlock()
+		if ok {
+			continue
+		}
+		usage, err := s.repo.GetUsage(ctx, tenantId, string(l.Period), id)
+		if err == nil {
+			if _, err := s.counter.Restore(ctx, tenantId, l.Period, id, usage.Used); err != nil {
+				return err
+			}
+		} else if err != repository.RecordNotFound {
+			return err
+		}
+		s.m.Lock()
+		s.restored[key] = end
+		s.m.Unlock()
+	}
+	return nil
+}
+
+func (s *quotaService) result(plan *PlanOption, usages []ratelimiter.QuotaUsage, quotas []int64) *QuotaResult {
+	res := &QuotaResult{Allowed: true, Plan: plan.Name}
+	for i, u := range usages {
+		remaining := quotas[i] - u.Used
+		if remaining < 0 {
+			remaining = 0
+			res.Overage = true
+		}
+		res.Usages = append(res.Usages, &QuotaPeriodUsage{
+			Period:    string(u.Period),
+			PeriodId:  u.PeriodId,
+			Used:      u.Used,
+			Limit:     quotas[i],
+			Remaining: remaining,
+			ResetAt:   u.ResetAt,
+		})
+	}
+	return res
+}
+
+func (s *quotaService) Consume(ctx context.Context, tenantId string, n int64) (*QuotaResult, error) {
+	if !s.opt.Enable {
+		return &QuotaResult{Allowed: true}, nil
+	}
+	plan, err := s.plan(ctx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return &QuotaResult{Allowed: true}, nil
+	}
+	limits, quotas := s.limits(plan)
+	if len(limits) == 0 {
+		return &QuotaResult{Allowed: true, Plan: plan.Name}, nil
+	}
+	if err := s.restore(ctx, tenantId, limits); err != nil {
+		return nil, err
+	}
+	usages, ok, err := s.counter.Consume(ctx, tenantId, n, limits...)
+	if err != nil {
+		return nil, err
+	}
+	res := s.result(plan, usages, quotas)
+	res.Allowed = ok
+	if ok {
+		s.m.Lock()
+		for _, u := range usages {
+			s.dirty[usageKey{tenantId: tenantId, period: u.Period, periodId: u.PeriodId}] = struct{}{}
+		}
+		s.m.Unlock()
+	}
+	return res, nil
+}
+
+func (s *quotaService) Usage(ctx context.Context, tenantId string) (*QuotaResult, error) {
+	if !s.opt.Enable {
+		return &QuotaResult{Allowed: true}, nil
+	}
+	plan, err := s.plan(ctx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return &QuotaResult{Allowed: true}, nil
+	}
+	limits, quotas := s.limits(plan)
+	if err := s.restore(ctx, tenantId, limits); err != nil {
+		return nil, err
+	}
+	usages := make([]ratelimiter.QuotaUsage, 0, len(limits))
+	for _, l := range limits {
+		u, err := s.counter.Usage(ctx, tenantId, l.Period)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+	res := s.result(plan, usages, quotas)
+	for i, u := range usages {
+		if limits[i].HardLimit > 0 && u.Used >= limits[i].HardLimit {
+			res.Allowed = false
+		}
+	}
+	return res, nil
+}
+
+// flush 将有变化的用量写入数据库，失败的用量在下次重试，并清除已结束周期的恢复记录
+func (s *quotaService) flush(ctx context.Context) error {
+	s.m.Lock()
+	dirty := s.dirty
+	s.dirty = make(map[usageKey]struct{})
+	now := time.Now()
+	for key, end := range s.restored {
+		if !now.Before(end) {
+			delete(s.restored, key)
+		}
+	}
+	s.m.Unlock()
+	if len(dirty) == 0 {
+		return nil
+	}
+	var (
+		usages []*model.QuotaUsage
+		failed []usageKey
+		err    error
+	)
+	for key := range dirty {
+		used, e := s.counter.Get(ctx, key.tenantId, key.period, key.periodId)
+		if e != nil {
+			err = e
+			failed = append(failed, key)
+			continue
+		}
+		usages = append(usages, &model.QuotaUsage{
+			TenantId: key.tenantId,
+			Period:   string(key.period),
+			PeriodId: key.periodId,
+			Used:     used,
+		})
+	}
+	if e := s.repo.SaveUsages(ctx, usages); e != nil {
+		err = e
+		for _, u := range usages {
+			failed = append(failed, usageKey{tenantId: u.TenantId, period: ratelimiter.Period(u.Period), periodId: u.PeriodId})
+		}
+	}
+	if len(failed) > 0 {
+		s.m.Lock()
+		for _, key := range failed {
+			s.dirty[key] = struct{}{}
+		}
+		s.m.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("flush quota usage: %w", err)
+	}
+	return nil
+}
+
+func (s *quotaService) Start() {
+	if !s.opt.Enable {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(time.Duration(s.opt.FlushInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if err := s.flush(context.Background()); err != nil {
+					logger.Errorf("%v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *quotaService) Stop(ctx context.Context) error {
+	if !s.opt.Enable {
+		return nil
+	}
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return s.flush(ctx)
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"strings"
+	"time"
+)
+
+// PermissionAll 拥有全部权限，资源:* 拥有该资源的全部权限
+const PermissionAll = "*"
+
+type RbacOption struct {
+	// 缓存 key 前缀
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// 角色权限的缓存时间，单位秒，默认 300
+	CacheTtl int `json:"cache_ttl" yaml:"cache_ttl"`
+	// 拥有全部权限的角色，用于初始化权限配置
+	SuperRoles []string `json:"super_roles" yaml:"super_roles"`
+}
+
+type RbacService interface {
+	// Authorize 判断角色是否拥有全部 permissions
+	Authorize(ctx context.Context, roles []string, permissions ...string) (bool, error)
+	UserRoles(ctx context.Context, userId int) ([]string, error)
+
+	ListRoles(ctx context.Context) ([]*model.Role, error)
+	CreateRole(ctx context.Context, name, description string) (*model.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	ListPermissions(ctx context.Context) ([]*model.Permission, error)
+	CreatePermission(ctx context.Context, name, description string) (*model.Permission, error)
+	DeletePermission(ctx context.Context, name string) error
+	RolePermissions(ctx context.Context, role string) ([]string, error)
+	Grant(ctx context.Context, role, permission string) error
+	Revoke(ctx context.Context, role, permission string) error
+	AssignRole(ctx context.Context, userId int, role string) error
+	UnassignRole(ctx context.Context, userId int, role string) error
+}
+
+func NewRbacService(repo repository.RbacRepository, rdb cache.Cache, opt RbacOption) RbacService {
+	if opt.Prefix == "" {
+		opt.Prefix = "rbac"
+	}
+	if opt.CacheTtl <= 0 {
+		opt.CacheTtl = 300
+	}
+	return &rbacService{
+		repo: repo,
+		rdb:  rdb,
+		opt:  opt,
+	}
+}
+
+type rbacService struct {
+	repo repository.RbacRepository
+	// 为 nil 时不缓存
+	rdb cache.Cache
+	opt RbacOption
+}
+
+func (s *rbacService) cacheKey(role string) string {
+	return fmt.Sprintf("%s:role:%s", s.opt.Prefix, role)
+}
+
+// permissions 返回角色的权限，优先读取缓存
+func (s *rbacService) permissions(ctx context.Context, role string) ([]string, error) {
+	if s.rdb != nil && s.rdb.IsOk() {
+		v, err := s.rdb.Get(ctx, s.cacheKey(role))
+		if err == nil {
+			var permissions []string
+			if err := json.Unmarshal([]byte(v), &permissions); err == nil {
+				return permissions, nil
+			}
+		} else if !cache.IsNotFound(err) {
+			s.rdb.OccurErr(err)
+		}
+	}
+	permissions, err := s.repo.RolePermissions(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	if s.rdb != nil && s.rdb.IsOk() {
+		b, _ := json.Marshal(permissions)
+		if err := s.rdb.SetEx(ctx, s.cacheKey(role), string(b), time.Duration(s.opt.CacheTtl)*time.Second); err != nil {
+			s.rdb.OccurErr(err)
+		}
+	}
+	return permissions, nil
+}
+
+// invalidate 删除角色权限的缓存，失败时等待缓存过期
+func (s *rbacService) invalidate(ctx context.Context, roles ...string) {
+	if s.rdb == nil || len(roles) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(roles))
+	for _, role := range roles {
+		keys = append(keys, s.cacheKey(role))
+	}
+	if _, err := s.rdb.Del(ctx, keys...); err != nil {
+		logger.WithContext(ctx).Errorf("invalidate rbac cache of %v error: %v", roles, err)
+	}
+}
+
+// matchPermission 判断 granted 是否包含 required
+func matchPermission(granted, required string) bool {
+	if granted == PermissionAll || granted == required {
+		return true
+	}
+	if strings.HasSuffix(granted, ":*") {
+		return strings.HasPrefix(required, strings.TrimSuffix(granted, "*"))
+	}
+	return false
+}
+
+func (s *rbacService) Authorize(ctx context.Context, roles []string, permissions ...string) (bool, error) {
+	var granted []string
+	for _, role := range roles {
+		for _, super := range s.opt.SuperRoles {
+			if role == super {
+				return true, nil
+			}
+		}
+		p, err := s.permissions(ctx, role)
+		if err != nil {
+			return false, err
+		}
+		granted = append(granted, p...)
+	}
+	for _, required := range permissions {
+		ok := false
+		for _, g := range granted {
+			if matchPermission(g, required) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *rbacService) UserRoles(ctx context.Context, userId int) ([]string, error) {
+	return s.repo.UserRoles(ctx, userId)
+}
+
+func (s *rbacService) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+func (s *rbacService) getRole(ctx context.Context, name string) (*model.Role, error) {
+	role, err := s.repo.GetRole(ctx, name)
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.NotFound, "role "+name)
+	}
+	return role, err
+}
+
+func (s *rbacService) getPermission(ctx context.Context, name string) (*model.Permission, error) {
+	permission, err := s.repo.GetPermission(ctx, name)
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.NotFound, "permission "+name)
+	}
+	return permission, err
+}
+
+func (s *rbacService) CreateRole(ctx context.Context, name, description string) (*model.Role, error) {
+	if _, err := s.repo.GetRole(ctx, name); err == nil {
+		return nil, errors.Wrap(errors.BadParameters, "role exists")
+	} else if err != repository.RecordNotFound {
+		return nil, err
+	}
+	role := &model.Role{Name: name, Description: description}
+	if err := s.repo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *rbacService) DeleteRole(ctx context.Context, name string) error {
+	err := s.repo.DeleteRole(ctx, name)
+	if err == repository.RecordNotFound {
+		return errors.Wrap(errors.NotFound, "role "+name)
+	}
+	if err != nil {
+		return err
+	}
+	s.invalidate(ctx, name)
+	return nil
+}
+
+func (s *rbacService) ListPermissions(ctx context.Context) ([]*model.Permission, error) {
+	return s.repo.ListPermissions(ctx)
+}
+
+func (s *rbacService) CreatePermission(ctx context.Context, name, description string) (*model.Permission, error) {
+	if _, err := s.repo.GetPermission(ctx, name); err == nil {
+		return nil, errors.Wrap(errors.BadParameters, "permission exists")
+	} else if err != repository.RecordNotFound {
+		return nil, err
+	}
+	permission := &model.Permission{Name: name, Description: description}
+	if err := s.repo.CreatePermission(ctx, permission); err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+func (s *rbacService) DeletePermission(ctx context.Context, name string) error {
+	roles, err := s.repo.DeletePermission(ctx, name)
+	if err == repository.RecordNotFound {
+		return errors.Wrap(errors.NotFound, "permission "+name)
+	}
+	if err != nil {
+		return err
+	}
+	s.invalidate(ctx, roles...)
+	return nil
+}
+
+func (s *rbacService) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	if _, err := s.getRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return s.repo.RolePermissions(ctx, role)
+}
+
+func (s *rbacService) Grant(ctx context.Context, role, permission string) error {
+	r, err := s.getRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	p, err := s.getPermission(ctx, permission)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Grant(ctx, r.Id, p.Id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, role)
+	return nil
+}
+
+func (s *rbacService) Revoke(ctx context.Context, role, permission string) error {
+	r, err := s.getRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	p, err := s.getPermission(ctx, permission)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Revoke(ctx, r.Id, p.Id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, role)
+	return nil
+}
+
+func (s *rbacService) AssignRole(ctx context.Context, userId int, role string) error {
+	r, err := s.getRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	return s.repo.AssignRole(ctx, userId, r.Id)
+}
+
+func (s *rbacService) UnassignRole(ctx context.Context, userId int, role string) error {
+	r, err := s.getRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	return s.repo.UnassignRole(ctx, userId, r.Id)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"testing"
+)
+
+// newTestRbacService 创建 editor 和 viewer 角色，editor 拥有 article:*，viewer 拥有 article:read
+func newTestRbacService(t *testing.T, opt RbacOption) (*rbacService, repository.RbacRepository) {
+	ctx := context.Background()
+	repo := repository.NewRbacRepository(testDB(t))
+	s := NewRbacService(repo, testCache(t), opt).(*rbacService)
+	for _, role := range []string{"editor", "viewer"} {
+		if _, err := s.CreateRole(ctx, role, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, permission := range []string{"article:*", "article:read", "user:read"} {
+		if _, err := s.CreatePermission(ctx, permission, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Grant(ctx, "editor", "article:*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Grant(ctx, "viewer", "article:read"); err != nil {
+		t.Fatal(err)
+	}
+	return s, repo
+}
+
+func TestRbacAuthorize(t *testing.T) {
+	s, _ := newTestRbacService(t, RbacOption{SuperRoles: []string{"root"}})
+	cases := []struct {
+		name        string
+		roles       []string
+		permissions []string
+		allowed     bool
+	}{
+		{"exact", []string{"viewer"}, []string{"article:read"}, true},
+		{"not granted", []string{"viewer"}, []string{"article:write"}, false},
+		{"resource wildcard", []string{"editor"}, []string{"article:write", "article:read"}, true},
+		{"wildcard other resource", []string{"editor"}, []string{"user:read"}, false},
+		{"all permissions required", []string{"viewer"}, []string{"article:read", "article:write"}, false},
+		{"union of roles", []string{"viewer", "editor"}, []string{"article:delete"}, true},
+		{"unknown role", []string{"guest"}, []string{"article:read"}, false},
+		{"no roles", nil, []string{"article:read"}, false},
+		{"super role", []string{"root"}, []string{"user:delete", "rbac:manage"}, true},
+		{"super role with others", []string{"viewer", "root"}, []string{"user:delete"}, true},
+	}
+	for _, c := range cases {
+		allowed, err := s.Authorize(context.Background(), c.roles, c.permissions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != c.allowed {
+			t.Errorf("%s: expect %v, got %v", c.name, c.allowed, allowed)
+		}
+	}
+}
+
+func TestRbacCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestRbacService(t, RbacOption{})
+	authorize := func(role, permission string) bool {
+		allowed, err := s.Authorize(ctx, []string{role}, permission)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+	if authorize("viewer", "user:read") {
+		t.Fatal("permission not granted yet")
+	}
+	// 绕过服务修改的权限在缓存过期前不生效
+	role, _ := repo.GetRole(ctx, "viewer")
+	permission, _ := repo.GetPermission(ctx, "user:read")
+	if err := repo.Grant(ctx, role.Id, permission.Id); err != nil {
+		t.Fatal(err)
+	}
+	if authorize("viewer", "user:read") {
+		t.Fatal("role permissions not cached")
+	}
+	// 通过服务授权和撤销时删除缓存
+	if err := s.Grant(ctx, "viewer", "user:read"); err != nil {
+		t.Fatal(err)
+	}
+	if !authorize("viewer", "user:read") {
+		t.Fatal("cache not invalidated after grant")
+	}
+	if err := s.Revoke(ctx, "viewer", "user:read"); err != nil {
+		t.Fatal(err)
+	}
+	if authorize("viewer", "user:read") {
+		t.Fatal("cache not invalidated after revoke")
+	}
+	// 删除权限时删除拥有该权限的角色的缓存
+	if !authorize("editor", "article:write") {
+		t.Fatal("editor should have article:*")
+	}
+	if err := s.DeletePermission(ctx, "article:*"); err != nil {
+		t.Fatal(err)
+	}
+	if authorize("editor", "article:write") {
+		t.Fatal("cache not invalidated after permission deleted")
+	}
+	// 删除角色时删除该角色的缓存
+	if !authorize("viewer", "article:read") {
+		t.Fatal("viewer should have article:read")
+	}
+	if err := s.DeleteRole(ctx, "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if authorize("viewer", "article:read") {
+		t.Fatal("cache not invalidated after role deleted")
+	}
+}
+
+func TestRbacUserRoles(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestRbacService(t, RbacOption{})
+	if err := s.AssignRole(ctx, 1, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AssignRole(ctx, 1, "guest"); !errors.Is(err, errors.NotFound) {
+		t.Fatalf("expect not found, got %v", err)
+	}
+	roles, err := s.UserRoles(ctx, 1)
+	if err != nil || len(roles) != 1 || roles[0] != "editor" {
+		t.Fatalf("unexpected roles %v, error %v", roles, err)
+	}
+	if err := s.UnassignRole(ctx, 1, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if roles, _ := s.UserRoles(ctx, 1); len(roles) != 0 {
+		t.Fatalf("role not unassigned: %v", roles)
+	}
+}
@@ -3,16 +3,49 @@ package service
 import (
 	"service_template/internal/repository"
 	"service_template/pkg/cache"
+	"service_template/pkg/ipsearch"
+	"service_template/pkg/jwt"
+	"service_template/pkg/lock"
+	"service_template/pkg/policy"
 )
 
-func NewService(repo *repository.Repository, cache cache.Cache) *Service {
+func NewService(repo *repository.Repository, rdb cache.Cache, locker lock.Lock, quota QuotaOption, rbac RbacOption, apiKey ApiKeyOption, user UserOption, twoFactor TwoFactorOption, oidc OidcOption, session SessionOption, engine *policy.Engine, refreshStore jwt.RefreshStore, revoker *jwt.Revoker, locate ipsearch.Locator) *Service {
+	redis, _ := rdb.(*cache.Redis)
+	rbacService := NewRbacService(repo.RbacRepository, rdb, rbac)
+	sessionService := NewSessionService(repo.SessionRepository, rdb, jwt.Default(), refreshStore, locate, session)
+	userService := NewUserService(repo.UserRepository, redis, revoker, sessionService, user)
+	twoFactorService := NewTwoFactorService(repo.TwoFactorRepository, userService, rdb, redis, twoFactor)
+	oidcService := NewOidcService(repo.IdentityRepository, userService, rdb, oidc)
 	return &Service{
-		ExampleService: NewExampleService(repo),
+		Locker:           locker,
+		Revoker:          revoker,
+		Policy:           engine,
+		ExampleService:   NewExampleService(repo),
+		QuotaService:     NewQuotaService(repo.QuotaRepository, redis, quota),
+		RbacService:      rbacService,
+		UserService:      userService,
+		TwoFactorService: twoFactorService,
+		OidcService:      oidcService,
+		SessionService:   sessionService,
+		ApiKeyService:    NewApiKeyService(repo.ApiKeyRepository, rbacService, apiKey),
+		AuthService:      NewAuthService(jwt.Default(), refreshStore, revoker, rbacService, userService, twoFactorService, oidcService, sessionService),
 	}
 }
 
 type Service struct {
-	ExampleService ExampleService
+	Locker  lock.Lock
+	Revoker *jwt.Revoker
+	// 服务中按资源属性鉴权时使用，见 Authorize
+	Policy           *policy.Engine
+	ExampleService   ExampleService
+	QuotaService     QuotaService
+	RbacService      RbacService
+	UserService      UserService
+	TwoFactorService TwoFactorService
+	OidcService      OidcService
+	SessionService   SessionService
+	ApiKeyService    ApiKeyService
+	AuthService      AuthService
 }
 
 type ExampleService interface {
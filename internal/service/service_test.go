@@ -0,0 +1,45 @@
+package service
+
+import (
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/cache"
+	"service_template/pkg/db"
+	"service_template/pkg/jwt"
+	"testing"
+)
+
+func testDB(t *testing.T) *db.DB {
+	database, err := db.NewDB(db.Option{Driver: db.Sqlite, DbName: t.TempDir() + "/service.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+	if err := database.AutoMigrate(model.Tables...); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func testCache(t *testing.T) cache.Cache {
+	c, err := cache.NewInmemory(cache.Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testManager(t *testing.T) *jwt.Manager {
+	m, err := jwt.NewManager(jwt.Option{Keys: []jwt.KeyOption{{Kid: "hs", Algorithm: jwt.HS256, Secret: "0123456789abcdef0123456789abcdef"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func newTestSessionService(t *testing.T, database *db.DB, opt SessionOption) *sessionService {
+	store := repository.NewRefreshTokenRepository(database)
+	return NewSessionService(repository.NewSessionRepository(database), testCache(t), testManager(t), store, nil, opt).(*sessionService)
+}
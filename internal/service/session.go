@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/cache"
+	"service_template/pkg/ipsearch"
+	"service_template/pkg/jwt"
+	"service_template/pkg/logger"
+	"strings"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+type SessionOption struct {
+	// 每个用户同时有效的会话数，超出时吊销最久未活跃的会话，0 为不限制
+	MaxSessions int `json:"max_sessions" yaml:"max_sessions"`
+	// 记录最后活跃时间的最小间隔，单位秒，默认 60
+	TouchInterval int `json:"touch_interval" yaml:"touch_interval"`
+	// 会话吊销检查结果的本地缓存时间，单位秒，默认 5，其他实例上的吊销最多延迟该时间生效
+	RevocationCacheTtl int `json:"revocation_cache_ttl" yaml:"revocation_cache_ttl"`
+}
+
+// Device 登录请求的设备信息
+type Device struct {
+	// 客户端上报的设备名称，见 common.DeviceHeader
+	Name      string
+	UserAgent string
+	Ip        string
+}
+
+type SessionService interface {
+	// Create 登录后记录会话，超出数量限制时吊销最久未活跃的会话
+	Create(ctx context.Context, userId int, sessionId string, device Device) error
+	List(ctx context.Context, userId int) ([]*model.Session, error)
+	// Revoke 吊销用户的会话，会话的 refresh token 和 access token 随即失效
+	Revoke(ctx context.Context, userId int, sessionId string) error
+	// RevokeOthers 吊销用户除 current 外的所有会话，current 为空时吊销全部会话
+	RevokeOthers(ctx context.Context, userId int, current string) error
+	// Validate 校验会话未被吊销，并按间隔记录最后活跃时间和 IP。
+	// 缓存不可用时放行，与 token 吊销检查一致，会话的 refresh token 已在数据库中吊销，access token 到期后无法续期
+	Validate(ctx context.Context, userId int, sessionId, ip string) error
+}
+
+// NewSessionService locate 为 nil 时不记录会话的地理位置
+func NewSessionService(repo repository.SessionRepository, rdb cache.Cache, m *jwt.Manager, store jwt.RefreshStore, locate ipsearch.Locator, opt SessionOption) SessionService {
+	if opt.TouchInterval <= 0 {
+		opt.TouchInterval = 60
+	}
+	if opt.RevocationCacheTtl <= 0 {
+		opt.RevocationCacheTtl = 5
+	}
+	s := &sessionService{
+		repo:    repo,
+		rdb:     rdb,
+		m:       m,
+		store:   store,
+		opt:     opt,
+		touched: gocache.New(time.Duration(opt.TouchInterval)*time.Second, 10*time.Minute),
+		revoked: gocache.New(time.Duration(opt.RevocationCacheTtl)*time.Second, time.Minute),
+		locate:  locate,
+		now:     time.Now,
+	}
+	return s
+}
+
+type sessionService struct {
+	repo  repository.SessionRepository
+	rdb   cache.Cache
+	m     *jwt.Manager
+	store jwt.RefreshStore
+	opt   SessionOption
+	// 会话 ID 到最后记录的 IP
+	touched *gocache.Cache
+	// 会话 ID 到是否已吊销，避免每次请求都访问缓存
+	revoked *gocache.Cache
+	// 未配置 IP 库时为 nil
+	locate ipsearch.Locator
+	now    func() time.Time
+}
+
+func revokedSessionKey(id string) string {
+	return "session_revoked:" + id
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func (s *sessionService) location(ip string) string {
+	if s.locate == nil {
+		return ""
+	}
+	addr, ok := s.locate(ip)
+	if !ok {
+		return ""
+	}
+	parts := make([]string, 0, 3)
+	for _, p := range []string{addr.Country, addr.Province, addr.City} {
+		if p != "" && (len(parts) == 0 || parts[len(parts)-1] != p) {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *sessionService) Create(ctx context.Context, userId int, sessionId string, device Device) error {
+	now := s.now()
+	err := s.repo.Create(ctx, &model.Session{
+		Id:         sessionId,
+		UserId:     userId,
+		Device:     truncate(device.Name, 128),
+		UserAgent:  truncate(device.UserAgent, 512),
+		Ip:         device.Ip,
+		Location:   s.location(device.Ip),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.m.RefreshTtl()),
+	})
+	if err != nil {
+		return err
+	}
+	s.touched.SetDefault(sessionId, device.Ip)
+	if s.opt.MaxSessions <= 0 {
+		return nil
+	}
+	sessions, err := s.repo.ListActive(ctx, userId, now)
+	if err != nil {
+		return err
+	}
+	if len(sessions) <= s.opt.MaxSessions {
+		return nil
+	}
+	// 新会话的最后活跃时间最新，不会被吊销
+	ids := make([]string, 0, len(sessions)-s.opt.MaxSessions)
+	for _, session := range sessions[s.opt.MaxSessions:] {
+		ids = append(ids, session.Id)
+	}
+	logger.WithContext(ctx).Infof("user %d exceeds %d sessions, revoke %d oldest", userId, s.opt.MaxSessions, len(ids))
+	return s.revoke(ctx, ids)
+}
+
+func (s *sessionService) List(ctx context.Context, userId int) ([]*model.Session, error) {
+	return s.repo.ListActive(ctx, userId, s.now())
+}
+
+// revoke 吊销 refresh token 族，并在 access token 的有效期内拒绝会话中的 access token
+func (s *sessionService) revoke(ctx context.Context, ids []string) error {
+	if _, err := s.repo.Revoke(ctx, ids, s.now()); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.store.RevokeFamily(ctx, id); err != nil {
+			return err
+		}
+		if err := s.rdb.SetEx(ctx, revokedSessionKey(id), "1", s.m.AccessTtl()); err != nil {
+			return err
+		}
+		s.revoked.SetDefault(id, true)
+		s.touched.Delete(id)
+	}
+	return nil
+}
+
+func (s *sessionService) Revoke(ctx context.Context, userId int, sessionId string) error {
+	session, err := s.repo.Get(ctx, sessionId)
+	if err == repository.RecordNotFound || (err == nil && session.UserId != userId) {
+		return errors.Wrap(errors.NotFound, "session "+sessionId)
+	}
+	if err != nil {
+		return err
+	}
+	return s.revoke(ctx, []string{sessionId})
+}
+
+func (s *sessionService) RevokeOthers(ctx context.Context, userId int, current string) error {
+	sessions, err := s.repo.ListActive(ctx, userId, s.now())
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if session.Id != current {
+			ids = append(ids, session.Id)
+		}
+	}
+	return s.revoke(ctx, ids)
+}
+
+func (s *sessionService) isRevoked(ctx context.Context, sessionId string) (bool, error) {
+	if v, ok := s.revoked.Get(sessionId); ok {
+		return v.(bool), nil
+	}
+	revoked, err := s.rdb.Exists(ctx, revokedSessionKey(sessionId))
+	if err != nil {
+		return false, err
+	}
+	s.revoked.SetDefault(sessionId, revoked)
+	return revoked, nil
+}
+
+func (s *sessionService) Validate(ctx context.Context, userId int, sessionId, ip string) error {
+	if revoked, err := s.isRevoked(ctx, sessionId); err != nil {
+		// 缓存不可用时放行，不缓存检查结果
+		logger.WithContext(ctx).Errorf("check session revocation error: %v", err)
+	} else if revoked {
+		return errors.Wrap(errors.Unauthorized, "session revoked")
+	}
+	if v, ok := s.touched.Get(sessionId); ok && v.(string) == ip {
+		return nil
+	}
+	now := s.now()
+	if err := s.repo.Touch(ctx, sessionId, now, ip, s.location(ip), now.Add(s.m.RefreshTtl())); err != nil {
+		logger.WithContext(ctx).Errorf("touch session %s of user %d error: %v", sessionId, userId, err)
+		return nil
+	}
+	s.touched.SetDefault(sessionId, ip)
+	return nil
+}
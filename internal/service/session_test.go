@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"testing"
+	"time"
+)
+
+// clock 返回可手动推进的时间
+func clock(s *sessionService) func(d time.Duration) {
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestSessionMaxSessions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSessionService(t, testDB(t), SessionOption{MaxSessions: 2})
+	advance := clock(s)
+	for _, id := range []string{"s1", "s2"} {
+		if err := s.Create(ctx, 1, id, Device{Ip: "10.0.0.1"}); err != nil {
+			t.Fatal(err)
+		}
+		advance(time.Minute)
+	}
+	// s1 最近活跃，超出数量时吊销 s2
+	if err := s.Validate(ctx, 1, "s1", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Minute)
+	if err := s.Create(ctx, 1, "s3", Device{Ip: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := s.List(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].Id != "s3" || sessions[1].Id != "s1" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	if err := s.Validate(ctx, 1, "s2", "10.0.0.1"); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect s2 revoked, got %v", err)
+	}
+	// 其他用户的会话不受影响
+	if err := s.Create(ctx, 2, "s4", Device{}); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := s.List(ctx, 1); len(sessions) != 2 {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+}
+
+func TestSessionTouchInterval(t *testing.T) {
+	ctx := context.Background()
+	database := testDB(t)
+	s := newTestSessionService(t, database, SessionOption{TouchInterval: 1})
+	advance := clock(s)
+	repo := repository.NewSessionRepository(database)
+	if err := s.Create(ctx, 1, "s1", Device{Ip: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	created, _ := repo.Get(ctx, "s1")
+	lastSeen := func() (time.Time, string) {
+		session, err := repo.Get(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session.LastSeenAt, session.Ip
+	}
+
+	// 间隔内 IP 不变时不记录
+	advance(10 * time.Second)
+	if err := s.Validate(ctx, 1, "s1", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if at, _ := lastSeen(); !at.Equal(created.LastSeenAt) {
+		t.Fatalf("touched within interval: %v", at)
+	}
+	// IP 变化时立即记录
+	if err := s.Validate(ctx, 1, "s1", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	at, ip := lastSeen()
+	if !at.Equal(s.now()) || ip != "10.0.0.2" {
+		t.Fatalf("not touched after ip changed: %v %s", at, ip)
+	}
+	// 间隔结束后再次记录
+	time.Sleep(1100 * time.Millisecond)
+	advance(10 * time.Second)
+	if err := s.Validate(ctx, 1, "s1", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if at, _ := lastSeen(); !at.Equal(s.now()) {
+		t.Fatalf("not touched after interval: %v", at)
+	}
+}
+
+func TestSessionRevocationCache(t *testing.T) {
+	ctx := context.Background()
+	database := testDB(t)
+	opt := SessionOption{RevocationCacheTtl: 1}
+	a := newTestSessionService(t, database, opt)
+	// 共享数据库和缓存的另一个实例
+	b := NewSessionService(repository.NewSessionRepository(database), a.rdb, a.m, a.store, nil, opt).(*sessionService)
+	if err := a.Create(ctx, 1, "s1", Device{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Validate(ctx, 1, "s1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Revoke(ctx, 1, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	// 吊销的实例立即拒绝，其他实例在本地缓存过期后拒绝
+	if err := b.Validate(ctx, 1, "s1", ""); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect revoked on b, got %v", err)
+	}
+	if err := a.Validate(ctx, 1, "s1", ""); err != nil {
+		t.Fatalf("expect cached result on a, got %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if err := a.Validate(ctx, 1, "s1", ""); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect revoked on a after cache expired, got %v", err)
+	}
+	// 只能吊销自己的会话
+	if err := b.Revoke(ctx, 2, "s1"); !errors.Is(err, errors.NotFound) {
+		t.Fatalf("expect not found, got %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/aesgcm"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"service_template/pkg/ratelimiter"
+	"service_template/pkg/totp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TwoFactorOption struct {
+	// 验证器应用中显示的服务名称
+	Issuer string      `json:"issuer" yaml:"issuer"`
+	Totp   totp.Option `json:"totp" yaml:"totp"`
+	// 加密 TOTP 密钥的 key，第一个用于加密，轮换时保留旧 key 用于解密；为空时不能开启二次验证
+	EncryptionKeys []aesgcm.KeyOption `json:"encryption_keys" yaml:"encryption_keys"`
+	// 恢复码数量，默认 10
+	RecoveryCodes int `json:"recovery_codes" yaml:"recovery_codes"`
+	// 密码验证通过后完成二次验证的期限，单位秒，默认 300
+	ChallengeTtl int `json:"challenge_ttl" yaml:"challenge_ttl"`
+	// 每个用户的验证次数限制，默认本地计数、5 分钟内 5 次
+	RateLimit ratelimiter.Option `json:"rate_limit" yaml:"rate_limit"`
+}
+
+// Enrollment 绑定验证器所需的信息，Uri 为二维码内容
+type Enrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// 剩余可用的恢复码数量
+	RecoveryCodes int64 `json:"recovery_codes"`
+}
+
+type TwoFactorService interface {
+	Status(ctx context.Context, userId int) (*TwoFactorStatus, error)
+	Enabled(ctx context.Context, userId int) (bool, error)
+	// Enroll 生成新的密钥，确认前不生效
+	Enroll(ctx context.Context, userId int) (*Enrollment, error)
+	// Confirm 校验验证码后开启二次验证，返回恢复码明文，恢复码只返回这一次
+	Confirm(ctx context.Context, userId int, code string) ([]string, error)
+	// Disable 校验验证码或恢复码后关闭二次验证
+	Disable(ctx context.Context, userId int, code string) error
+	// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧恢复码失效
+	RegenerateRecoveryCodes(ctx context.Context, userId int, code string) ([]string, error)
+	// Verify 校验验证码或恢复码，恢复码使用后失效
+	Verify(ctx context.Context, userId int, code string) error
+	// NewChallenge 密码验证通过后生成二次验证的 challenge
+	NewChallenge(ctx context.Context, userId int) (string, error)
+	// VerifyChallenge 校验 challenge 和验证码，成功后 challenge 失效，返回用户 ID
+	VerifyChallenge(ctx context.Context, challenge, code string) (int, error)
+}
+
+func NewTwoFactorService(repo repository.TwoFactorRepository, users UserService, rdb cache.Cache, redis *cache.Redis, opt TwoFactorOption) TwoFactorService {
+	t, err := totp.New(opt.Totp)
+	if err != nil {
+		panic(err)
+	}
+	var c *aesgcm.Cipher
+	if len(opt.EncryptionKeys) > 0 {
+		if c, err = aesgcm.NewCipher(opt.EncryptionKeys); err != nil {
+			panic(err)
+		}
+	}
+	if opt.RecoveryCodes <= 0 {
+		opt.RecoveryCodes = 10
+	}
+	if opt.ChallengeTtl <= 0 {
+		opt.ChallengeTtl = 300
+	}
+	if opt.RateLimit.Max <= 0 {
+		opt.RateLimit.Max = 5
+	}
+	if opt.RateLimit.Interval <= 0 {
+		opt.RateLimit.Interval = 300
+	}
+	limiter, err := ratelimiter.NewRateLimiter(opt.RateLimit, redis)
+	if err != nil {
+		panic(err)
+	}
+	return &twoFactorService{
+		repo:    repo,
+		users:   users,
+		rdb:     rdb,
+		opt:     opt,
+		totp:    t,
+		cipher:  c,
+		limiter: limiter,
+		now:     time.Now,
+	}
+}
+
+type twoFactorService struct {
+	repo    repository.TwoFactorRepository
+	users   UserService
+	rdb     cache.Cache
+	opt     TwoFactorOption
+	totp    *totp.TOTP
+	cipher  *aesgcm.Cipher
+	limiter ratelimiter.RateLimiter
+	now     func() time.Time
+}
+
+func secretAad(userId int) []byte {
+	return []byte(fmt.Sprintf("user_totp:%d", userId))
+}
+
+// normalizeRecoveryCode 忽略大小写、空格和分隔符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// generateRecoveryCodes 返回恢复码明文和哈希
+func (s *twoFactorService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, s.opt.RecoveryCodes)
+	hashes := make([]string, 0, s.opt.RecoveryCodes)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < s.opt.RecoveryCodes; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b)[:10])
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func (s *twoFactorService) get(ctx context.Context, userId int) (*model.UserTotp, error) {
+	t, err := s.repo.GetTotp(ctx, userId)
+	if err == repository.RecordNotFound {
+		return nil, nil
+	}
+	return t, err
+}
+
+func (s *twoFactorService) Status(ctx context.Context, userId int) (*TwoFactorStatus, error) {
+	t, err := s.get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Enabled: t != nil && t.ConfirmedAt != nil}
+	if status.Enabled {
+		if status.RecoveryCodes, err = s.repo.CountRecoveryCodes(ctx, userId); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+func (s *twoFactorService) Enabled(ctx context.Context, userId int) (bool, error) {
+	t, err := s.get(ctx, userId)
+	return t != nil && t.ConfirmedAt != nil, err
+}
+
+func (s *twoFactorService) Enroll(ctx context.Context, userId int) (*Enrollment, error) {
+	if s.cipher == nil {
+		return nil, errors.Wrap(errors.ServiceUnavailable, "two factor encryption keys not configured")
+	}
+	user, err := s.users.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil && t.ConfirmedAt != nil {
+		return nil, errors.Wrap(errors.BadParameters, "two factor already enabled")
+	}
+	secret, err := s.totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.cipher.Encrypt([]byte(secret), secretAad(userId))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveTotp(ctx, &model.UserTotp{UserId: userId, Secret: encrypted}); err != nil {
+		return nil, err
+	}
+	return &Enrollment{Secret: secret, Uri: s.totp.URI(s.opt.Issuer, user.Username, secret)}, nil
+}
+
+// allow 限制每个用户的验证次数，成功的验证同样计数
+func (s *twoFactorService) allow(userId int) error {
+	d, err := s.limiter.Allow(fmt.Sprintf("two_factor:%d", userId))
+	if err != nil {
+		return err
+	}
+	if !d.Allowed {
+		return errors.Wrap(errors.TooManyRequests, fmt.Sprintf("retry after %ds", int(d.RetryAfter.Seconds())+1))
+	}
+	return nil
+}
+
+// validate 校验 TOTP 验证码，返回匹配的时间步
+func (s *twoFactorService) validate(t *model.UserTotp, code string) (int64, error) {
+	if s.cipher == nil {
+		return 0, errors.Wrap(errors.ServiceUnavailable, "two factor encryption keys not configured")
+	}
+	secret, err := s.cipher.Decrypt(t.Secret, secretAad(t.UserId))
+	if err != nil {
+		return 0, err
+	}
+	step, ok := s.totp.Validate(string(secret), strings.TrimSpace(code), s.now())
+	if !ok {
+		return 0, errors.Wrap(errors.Unauthorized, "invalid two factor code")
+	}
+	return step, nil
+}
+
+func (s *twoFactorService) Confirm(ctx context.Context, userId int, code string) ([]string, error) {
+	if err := s.allow(userId); err != nil {
+		return nil, err
+	}
+	t, err := s.get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.ConfirmedAt != nil {
+		return nil, errors.Wrap(errors.BadParameters, "no pending two factor enrollment")
+	}
+	step, err := s.validate(t, code)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.ConfirmTotp(ctx, userId, step, s.now(), hashes)
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.BadParameters, "no pending two factor enrollment")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Verify(ctx context.Context, userId int, code string) error {
+	if err := s.allow(userId); err != nil {
+		return err
+	}
+	t, err := s.get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.ConfirmedAt == nil {
+		return errors.Wrap(errors.BadParameters, "two factor not enabled")
+	}
+	code = strings.TrimSpace(code)
+	if _, err := strconv.Atoi(code); err == nil {
+		step, err := s.validate(t, code)
+		if err == nil {
+			// 同一验证码只能使用一次
+			ok, err := s.repo.UseStep(ctx, userId, step)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.Wrap(errors.Unauthorized, "two factor code already used")
+			}
+			return nil
+		}
+		if !errors.Is(err, errors.Unauthorized) {
+			return err
+		}
+	}
+	ok, err := s.repo.ConsumeRecoveryCode(ctx, userId, hashToken(normalizeRecoveryCode(code)), s.now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrap(errors.Unauthorized, "invalid two factor code")
+	}
+	logger.WithContext(ctx).Infof("user %d used a recovery code", userId)
+	return nil
+}
+
+func (s *twoFactorService) Disable(ctx context.Context, userId int, code string) error {
+	if err := s.Verify(ctx, userId, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteTotp(ctx, userId)
+}
+
+func (s *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userId int, code string) ([]string, error) {
+	if err := s.Verify(ctx, userId, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func challengeKey(challenge string) string {
+	return "two_factor_challenge:" + hashToken(challenge)
+}
+
+func (s *twoFactorService) NewChallenge(ctx context.Context, userId int) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+	ttl := time.Duration(s.opt.ChallengeTtl) * time.Second
+	if err := s.rdb.SetEx(ctx, challengeKey(challenge), strconv.Itoa(userId), ttl); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+func (s *twoFactorService) VerifyChallenge(ctx context.Context, challenge, code string) (int, error) {
+	invalid := errors.Wrap(errors.Unauthorized, "invalid or expired two factor challenge")
+	key := challengeKey(challenge)
+	value, err := s.rdb.Get(ctx, key)
+	if err != nil {
+		if cache.IsNotFound(err) {
+			return 0, invalid
+		}
+		return 0, err
+	}
+	userId, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalid
+	}
+	// 验证失败时 challenge 仍然有效，尝试次数由限流控制
+	if err := s.Verify(ctx, userId, code); err != nil {
+		return 0, err
+	}
+	n, err := s.rdb.Del(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, invalid
+	}
+	return userId, nil
+}
@@ -0,0 +1,451 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/cache"
+	"service_template/pkg/jwt"
+	"service_template/pkg/logger"
+	"service_template/pkg/password"
+	"service_template/pkg/ratelimiter"
+	"strings"
+	"time"
+)
+
+type UserOption struct {
+	Password password.Option `json:"password" yaml:"password"`
+	// 密码最小长度，默认 8
+	MinPasswordLength int `json:"min_password_length" yaml:"min_password_length"`
+	// 为 true 时邮箱验证后才能登录
+	RequireVerifiedEmail bool `json:"require_verified_email" yaml:"require_verified_email"`
+	// 邮箱验证 token 的有效期，单位秒，默认 86400
+	VerifyEmailTtl int `json:"verify_email_ttl" yaml:"verify_email_ttl"`
+	// 重置密码 token 的有效期，单位秒，默认 1800
+	ResetPasswordTtl int `json:"reset_password_ttl" yaml:"reset_password_ttl"`
+	// 登录失败的计数，窗口内失败次数超过 max 后锁定账号，默认本地计数、15 分钟内 5 次
+	Lockout ratelimiter.Option `json:"lockout" yaml:"lockout"`
+	// 锁定时长，单位秒，默认 900
+	LockoutDuration int `json:"lockout_duration" yaml:"lockout_duration"`
+	// 为 nil 时只记录日志，不发送邮件
+	Mailer Mailer `json:"-" yaml:"-"`
+}
+
+// Mailer 发送账号相关的邮件，token 为明文，需拼接为前端页面的链接
+type Mailer interface {
+	SendVerifyEmail(ctx context.Context, user *model.User, token string) error
+	SendResetPassword(ctx context.Context, user *model.User, token string) error
+}
+
+type logMailer struct{}
+
+func (logMailer) SendVerifyEmail(ctx context.Context, user *model.User, _ string) error {
+	logger.WithContext(ctx).Warnf("mailer not configured, verify email to user %d not sent", user.Id)
+	return nil
+}
+
+func (logMailer) SendResetPassword(ctx context.Context, user *model.User, _ string) error {
+	logger.WithContext(ctx).Warnf("mailer not configured, reset password email to user %d not sent", user.Id)
+	return nil
+}
+
+type UserService interface {
+	// Register 注册用户并发送验证邮件
+	Register(ctx context.Context, username, email, password string) (*model.User, error)
+	// RegisterExternal 为外部身份创建没有密码的用户，用户名冲突时追加随机后缀
+	RegisterExternal(ctx context.Context, username, email string, emailVerified bool) (*model.User, error)
+	Get(ctx context.Context, id int) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// Verify 使用用户名或邮箱和密码登录，连续失败后锁定账号
+	Verify(ctx context.Context, login, password string) (*model.User, error)
+	// CheckLogin 检查不使用密码登录的用户，账号须未锁定，开启 require_verified_email 时邮箱须已验证
+	CheckLogin(ctx context.Context, user *model.User) error
+	VerifyEmail(ctx context.Context, token string) error
+	// ResendVerifyEmail 邮箱不存在或已验证时同样返回成功，避免枚举用户
+	ResendVerifyEmail(ctx context.Context, email string) error
+	// ForgotPassword 发送重置密码邮件，邮箱不存在时同样返回成功
+	ForgotPassword(ctx context.Context, email string) error
+	// ResetPassword 重置密码，解除锁定并吊销用户已签发的 token
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+// NewUserService revoker 和 sessions 为 nil 时重置密码后不吊销已登录的 token 和会话
+func NewUserService(repo repository.UserRepository, rdb *cache.Redis, revoker *jwt.Revoker, sessions SessionService, opt UserOption) UserService {
+	hasher, err := password.NewHasher(opt.Password)
+	if err != nil {
+		panic(err)
+	}
+	if opt.MinPasswordLength <= 0 {
+		opt.MinPasswordLength = 8
+	}
+	if opt.VerifyEmailTtl <= 0 {
+		opt.VerifyEmailTtl = 86400
+	}
+	if opt.ResetPasswordTtl <= 0 {
+		opt.ResetPasswordTtl = 1800
+	}
+	if opt.Lockout.Max <= 0 {
+		opt.Lockout.Max = 5
+	}
+	if opt.Lockout.Interval <= 0 {
+		opt.Lockout.Interval = 900
+	}
+	if opt.LockoutDuration <= 0 {
+		opt.LockoutDuration = 900
+	}
+	if opt.Mailer == nil {
+		opt.Mailer = logMailer{}
+	}
+	// 用户不存在时使用，使响应时间与密码错误时一致
+	dummy, err := hasher.Hash("dummy password")
+	if err != nil {
+		panic(err)
+	}
+	lockout, err := ratelimiter.NewRateLimiter(opt.Lockout, rdb)
+	if err != nil {
+		panic(err)
+	}
+	return &userService{
+		repo:     repo,
+		revoker:  revoker,
+		sessions: sessions,
+		opt:      opt,
+		hasher:   hasher,
+		lockout:  lockout,
+		dummy:    dummy,
+		now:      time.Now,
+	}
+}
+
+type userService struct {
+	repo     repository.UserRepository
+	revoker  *jwt.Revoker
+	sessions SessionService
+	opt      UserOption
+	hasher   *password.Hasher
+	lockout  ratelimiter.RateLimiter
+	dummy    string
+	now      func() time.Time
+}
+
+func (s *userService) checkPassword(password string) error {
+	if len(password) < s.opt.MinPasswordLength {
+		return errors.Wrap(errors.BadParameters, fmt.Sprintf("password must be at least %d characters", s.opt.MinPasswordLength))
+	}
+	return nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Address != strings.TrimSpace(email) {
+		return "", errors.Wrap(errors.BadParameters, "invalid email")
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken 生成一次性 token，返回明文
+func (s *userService) issueToken(ctx context.Context, userId int, purpose string, ttl int) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	err := s.repo.CreateToken(ctx, &model.UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		Hash:      hashToken(token),
+		ExpiresAt: s.now().Add(time.Duration(ttl) * time.Second),
+	})
+	return token, err
+}
+
+func (s *userService) sendVerifyEmail(ctx context.Context, user *model.User) error {
+	token, err := s.issueToken(ctx, user.Id, model.UserTokenVerifyEmail, s.opt.VerifyEmailTtl)
+	if err != nil {
+		return err
+	}
+	return s.opt.Mailer.SendVerifyEmail(ctx, user, token)
+}
+
+func (s *userService) Register(ctx context.Context, username, email, password string) (*model.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || len(username) > 64 || strings.Contains(username, "@") {
+		return nil, errors.Wrap(errors.BadParameters, "invalid username")
+	}
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPassword(password); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByUsername(ctx, username); err == nil {
+		return nil, errors.Wrap(errors.BadParameters, "username exists")
+	} else if err != repository.RecordNotFound {
+		return nil, err
+	}
+	if _, err := s.repo.GetByEmail(ctx, email); err == nil {
+		return nil, errors.Wrap(errors.BadParameters, "email exists")
+	} else if err != repository.RecordNotFound {
+		return nil, err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{Username: username, Email: email, PasswordHash: hash}
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.sendVerifyEmail(ctx, user); err != nil {
+		// 用户可重新发送验证邮件
+		logger.WithContext(ctx).Errorf("send verify email to user %d error: %v", user.Id, err)
+	}
+	return user, nil
+}
+
+func (s *userService) RegisterExternal(ctx context.Context, username, email string, emailVerified bool) (*model.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByEmail(ctx, email); err == nil {
+		return nil, errors.Wrap(errors.BadParameters, "email exists")
+	} else if err != repository.RecordNotFound {
+		return nil, err
+	}
+	username = strings.NewReplacer("@", "_", " ", "_").Replace(strings.TrimSpace(username))
+	if username == "" {
+		username = strings.SplitN(email, "@", 2)[0]
+	}
+	if len(username) > 55 {
+		username = username[:55]
+	}
+	user := &model.User{Email: email}
+	if emailVerified {
+		now := s.now()
+		user.EmailVerifiedAt = &now
+	}
+	for i := 0; i < 5 && user.Username == ""; i++ {
+		candidate := username
+		if i > 0 {
+			b := make([]byte, 4)
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+			candidate += "_" + hex.EncodeToString(b)
+		}
+		if _, err := s.repo.GetByUsername(ctx, candidate); err == repository.RecordNotFound {
+			user.Username = candidate
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if user.Username == "" {
+		return nil, errors.Wrap(errors.BadParameters, "username exists")
+	}
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	if !emailVerified {
+		if err := s.sendVerifyEmail(ctx, user); err != nil {
+			logger.WithContext(ctx).Errorf("send verify email to user %d error: %v", user.Id, err)
+		}
+	}
+	return user, nil
+}
+
+func (s *userService) Get(ctx context.Context, id int) (*model.User, error) {
+	user, err := s.repo.Get(ctx, id)
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.NotFound, fmt.Sprintf("user %d", id))
+	}
+	return user, err
+}
+
+func (s *userService) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := s.repo.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.NotFound, "user not found")
+	}
+	return user, err
+}
+
+func (s *userService) find(ctx context.Context, login string) (*model.User, error) {
+	if strings.Contains(login, "@") {
+		return s.repo.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(login)))
+	}
+	return s.repo.GetByUsername(ctx, strings.TrimSpace(login))
+}
+
+func lockoutKey(userId int) string {
+	return fmt.Sprintf("login_failure:%d", userId)
+}
+
+// fail 记录一次登录失败，超过次数后锁定账号并清零计数，解锁后重新计数
+func (s *userService) fail(ctx context.Context, user *model.User, now time.Time) error {
+	d, err := s.lockout.Allow(lockoutKey(user.Id))
+	if err != nil {
+		// 计数不可用时不锁定账号
+		logger.WithContext(ctx).Errorf("count login failure of user %d error: %v", user.Id, err)
+		return errors.Unauthorized
+	}
+	if d.Allowed {
+		return errors.Unauthorized
+	}
+	until := now.Add(time.Duration(s.opt.LockoutDuration) * time.Second)
+	if err := s.repo.SetLockedUntil(ctx, user.Id, &until); err != nil {
+		return err
+	}
+	s.resetFailures(ctx, user.Id)
+	logger.WithContext(ctx).Warnf("user %d locked until %s after too many login failures", user.Id, until.Format(time.RFC3339))
+	return errors.AccountLocked
+}
+
+// resetFailures 清零登录失败次数，失败时只记录日志，计数会在窗口结束后自然过期
+func (s *userService) resetFailures(ctx context.Context, userId int) {
+	if err := s.lockout.Reset(lockoutKey(userId)); err != nil {
+		logger.WithContext(ctx).Errorf("reset login failures of user %d error: %v", userId, err)
+	}
+}
+
+func (s *userService) CheckLogin(ctx context.Context, user *model.User) error {
+	if user.LockedUntil != nil && user.LockedUntil.After(s.now()) {
+		return errors.AccountLocked
+	}
+	if s.opt.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return errors.Wrap(errors.Forbidden, "email not verified")
+	}
+	return nil
+}
+
+func (s *userService) Verify(ctx context.Context, login, password string) (*model.User, error) {
+	user, err := s.find(ctx, login)
+	// 只使用外部身份登录的用户没有密码
+	if err == repository.RecordNotFound || (err == nil && user.PasswordHash == "") {
+		_, _ = s.hasher.Verify(password, s.dummy)
+		return nil, errors.Unauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return nil, errors.AccountLocked
+	}
+	ok, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.fail(ctx, user, now)
+	}
+	s.resetFailures(ctx, user.Id)
+	if s.opt.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, errors.Wrap(errors.Forbidden, "email not verified")
+	}
+	if user.LockedUntil != nil {
+		if err := s.repo.SetLockedUntil(ctx, user.Id, nil); err != nil {
+			return nil, err
+		}
+	}
+	// 哈希算法或参数调整后，在用户登录时升级
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if hash, err := s.hasher.Hash(password); err == nil {
+			if err := s.repo.UpdatePassword(ctx, user.Id, hash); err != nil {
+				logger.WithContext(ctx).Errorf("rehash password of user %d error: %v", user.Id, err)
+			}
+		}
+	}
+	return user, nil
+}
+
+func (s *userService) consume(ctx context.Context, purpose, token string) (*model.UserToken, error) {
+	t, err := s.repo.ConsumeToken(ctx, purpose, hashToken(token), s.now())
+	if err == repository.RecordNotFound {
+		return nil, errors.Wrap(errors.BadParameters, "invalid or expired token")
+	}
+	return t, err
+}
+
+func (s *userService) VerifyEmail(ctx context.Context, token string) error {
+	t, err := s.consume(ctx, model.UserTokenVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	return s.repo.MarkEmailVerified(ctx, t.UserId, s.now())
+}
+
+func (s *userService) ResendVerifyEmail(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err == repository.RecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendVerifyEmail(ctx, user)
+}
+
+func (s *userService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err == repository.RecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, err := s.issueToken(ctx, user.Id, model.UserTokenResetPassword, s.opt.ResetPasswordTtl)
+	if err != nil {
+		return err
+	}
+	return s.opt.Mailer.SendResetPassword(ctx, user, token)
+}
+
+func (s *userService) ResetPassword(ctx context.Context, token, password string) error {
+	if err := s.checkPassword(password); err != nil {
+		return err
+	}
+	t, err := s.consume(ctx, model.UserTokenResetPassword, token)
+	if err != nil {
+		return err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, t.UserId, hash); err != nil {
+		return err
+	}
+	if err := s.repo.SetLockedUntil(ctx, t.UserId, nil); err != nil {
+		return err
+	}
+	s.resetFailures(ctx, t.UserId)
+	// 密码可能已泄露，吊销已登录的 token 和会话
+	if s.revoker != nil {
+		if err := s.revoker.RevokeUser(ctx, t.UserId); err != nil {
+			logger.WithContext(ctx).Errorf("revoke tokens of user %d error: %v", t.UserId, err)
+		}
+	}
+	if s.sessions != nil {
+		if err := s.sessions.RevokeOthers(ctx, t.UserId, ""); err != nil {
+			logger.WithContext(ctx).Errorf("revoke sessions of user %d error: %v", t.UserId, err)
+		}
+	}
+	return nil
+}
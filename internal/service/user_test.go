@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"service_template/internal/errors"
+	"service_template/internal/repository"
+	"service_template/internal/repository/model"
+	"service_template/pkg/db"
+	"service_template/pkg/password"
+	"service_template/pkg/ratelimiter"
+	"testing"
+	"time"
+)
+
+// captureMailer 记录最近一次发送的 token
+type captureMailer struct {
+	token string
+}
+
+func (m *captureMailer) SendVerifyEmail(ctx context.Context, user *model.User, token string) error {
+	m.token = token
+	return nil
+}
+
+func (m *captureMailer) SendResetPassword(ctx context.Context, user *model.User, token string) error {
+	m.token = token
+	return nil
+}
+
+func newTestUserService(t *testing.T, database *db.DB) (*userService, *sessionService, *captureMailer) {
+	sessions := newTestSessionService(t, database, SessionOption{})
+	mailer := &captureMailer{}
+	s := NewUserService(repository.NewUserRepository(database), nil, nil, sessions, UserOption{
+		Password: password.Option{Algorithm: password.Bcrypt, Cost: 4},
+		Lockout:  ratelimiter.Option{Store: ratelimiter.StoreLocal, Max: 3, Interval: 900},
+		Mailer:   mailer,
+	}).(*userService)
+	if _, err := s.Register(context.Background(), "alice", "alice@example.com", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	return s, sessions, mailer
+}
+
+// failLogin 使用错误的密码登录 n 次，返回最后一次的错误
+func failLogin(s *userService, n int) error {
+	var err error
+	for i := 0; i < n; i++ {
+		_, err = s.Verify(context.Background(), "alice", "wrong password")
+	}
+	return err
+}
+
+func TestUserLockout(t *testing.T) {
+	s, _, _ := newTestUserService(t, testDB(t))
+	ctx := context.Background()
+	if err := failLogin(s, 3); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect unauthorized, got %v", err)
+	}
+	if err := failLogin(s, 1); !errors.Is(err, errors.AccountLocked) {
+		t.Fatalf("expect account locked, got %v", err)
+	}
+	// 锁定期间密码正确也不能登录
+	if _, err := s.Verify(ctx, "alice", "password1"); !errors.Is(err, errors.AccountLocked) {
+		t.Fatalf("expect account locked, got %v", err)
+	}
+	// 锁定到期后重新计数
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if err := failLogin(s, 3); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect failures counted from zero after lock expired, got %v", err)
+	}
+	if _, err := s.Verify(ctx, "alice", "password1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserLoginResetsFailures(t *testing.T) {
+	s, _, _ := newTestUserService(t, testDB(t))
+	failLogin(s, 3)
+	if _, err := s.Verify(context.Background(), "alice", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := failLogin(s, 3); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect failures cleared after login, got %v", err)
+	}
+}
+
+func TestUserResetPassword(t *testing.T) {
+	s, sessions, mailer := newTestUserService(t, testDB(t))
+	ctx := context.Background()
+	user, _ := s.GetByEmail(ctx, "alice@example.com")
+	if err := sessions.Create(ctx, user.Id, "session", Device{Ip: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	failLogin(s, 3)
+	if err := s.ForgotPassword(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ResetPassword(ctx, mailer.token, "password2"); err != nil {
+		t.Fatal(err)
+	}
+	// 重置后解除锁定并清零失败次数
+	if err := failLogin(s, 3); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect failures cleared after reset, got %v", err)
+	}
+	if _, err := s.Verify(ctx, "alice", "password2"); err != nil {
+		t.Fatal(err)
+	}
+	// 已登录的会话全部吊销
+	if list, _ := sessions.List(ctx, user.Id); len(list) != 0 {
+		t.Fatalf("expect sessions revoked, got %d", len(list))
+	}
+	if err := sessions.Validate(ctx, user.Id, "session", "127.0.0.1"); !errors.Is(err, errors.Unauthorized) {
+		t.Fatalf("expect revoked session rejected, got %v", err)
+	}
+}
+
+func TestUserCheckLogin(t *testing.T) {
+	s, _, mailer := newTestUserService(t, testDB(t))
+	ctx := context.Background()
+	user, _ := s.GetByEmail(ctx, "alice@example.com")
+	if err := s.CheckLogin(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	s.opt.RequireVerifiedEmail = true
+	if err := s.CheckLogin(ctx, user); !errors.Is(err, errors.Forbidden) {
+		t.Fatalf("expect forbidden before email verified, got %v", err)
+	}
+	if err := s.VerifyEmail(ctx, mailer.token); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = s.GetByEmail(ctx, "alice@example.com")
+	if err := s.CheckLogin(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	// 密码连续错误锁定后，外部身份也不能登录
+	failLogin(s, 4)
+	user, _ = s.GetByEmail(ctx, "alice@example.com")
+	if err := s.CheckLogin(ctx, user); !errors.Is(err, errors.AccountLocked) {
+		t.Fatalf("expect account locked, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package aesgcm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrDecrypt = errors.New("decrypt failed")
+
+type KeyOption struct {
+	// 写入密文，解密时据此选择 key，不能包含 "."
+	Kid string `json:"kid" yaml:"kid"`
+	// base64 编码的 16、24 或 32 字节 key
+	Secret string `json:"secret" yaml:"secret"`
+}
+
+// Cipher 使用 AES-GCM 加密数据，第一个 key 用于加密，其余 key 只用于解密已有数据，以便轮换
+type Cipher struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+func NewCipher(keys []KeyOption) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("aesgcm requires at least one key")
+	}
+	c := &Cipher{primary: keys[0].Kid, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for _, k := range keys {
+		if k.Kid == "" || strings.Contains(k.Kid, ".") {
+			return nil, fmt.Errorf("invalid aesgcm kid %q", k.Kid)
+		}
+		if _, ok := c.aeads[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate aesgcm kid %s", k.Kid)
+		}
+		secret, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("decode aesgcm key %s: %w", k.Kid, err)
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("aesgcm key %s: %w", k.Kid, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads[k.Kid] = aead
+	}
+	return c, nil
+}
+
+// Encrypt 返回 kid.base64(nonce|密文)，aad 为绑定的上下文，如用户 ID，解密时须一致
+func (c *Cipher) Encrypt(plaintext, aad []byte) (string, error) {
+	aead := c.aeads[c.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, aad)
+	return c.primary + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(ciphertext string, aad []byte) ([]byte, error) {
+	kid, data, ok := strings.Cut(ciphertext, ".")
+	if !ok {
+		return nil, ErrDecrypt
+	}
+	aead, ok := c.aeads[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown kid %s", ErrDecrypt, kid)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// NeedsRotate 密文不是由当前 key 加密时返回 true
+func (c *Cipher) NeedsRotate(ciphertext string) bool {
+	return !strings.HasPrefix(ciphertext, c.primary+".")
+}
@@ -0,0 +1,77 @@
+package aesgcm
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func key(b byte, n int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), n)))
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	c, err := NewCipher([]KeyOption{{Kid: "k1", Secret: key('a', 32)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := c.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("user:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ciphertext, "k1.") || strings.Contains(ciphertext, "JBSWY3DP") {
+		t.Fatalf("unexpected ciphertext %s", ciphertext)
+	}
+	plaintext, err := c.Decrypt(ciphertext, []byte("user:1"))
+	if err != nil || string(plaintext) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	// aad 不一致时无法解密，避免密文被复制到其他用户
+	if _, err := c.Decrypt(ciphertext, []byte("user:2")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected decrypt error, got %v", err)
+	}
+	tampered := ciphertext[:len(ciphertext)-2] + "AA"
+	if _, err := c.Decrypt(tampered, []byte("user:1")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected decrypt error, got %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	old, _ := NewCipher([]KeyOption{{Kid: "k1", Secret: key('a', 32)}})
+	ciphertext, _ := old.Encrypt([]byte("secret"), nil)
+	c, err := NewCipher([]KeyOption{{Kid: "k2", Secret: key('b', 16)}, {Kid: "k1", Secret: key('a', 32)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.NeedsRotate(ciphertext) {
+		t.Fatal("expected rotate")
+	}
+	plaintext, err := c.Decrypt(ciphertext, nil)
+	if err != nil || string(plaintext) != "secret" {
+		t.Fatalf("decrypt with old key failed: %v", err)
+	}
+	rotated, _ := c.Encrypt(plaintext, nil)
+	if c.NeedsRotate(rotated) {
+		t.Fatal("new ciphertext should use primary key")
+	}
+	if _, err := old.Decrypt(rotated, nil); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected unknown kid, got %v", err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	cases := [][]KeyOption{
+		nil,
+		{{Kid: "", Secret: key('a', 32)}},
+		{{Kid: "a.b", Secret: key('a', 32)}},
+		{{Kid: "k1", Secret: key('a', 20)}},
+		{{Kid: "k1", Secret: "not base64"}},
+		{{Kid: "k1", Secret: key('a', 32)}, {Kid: "k1", Secret: key('b', 32)}},
+	}
+	for i, keys := range cases {
+		if _, err := NewCipher(keys); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
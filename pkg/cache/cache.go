@@ -31,6 +31,8 @@ type Cache interface {
 	MGet(ctx context.Context, key ...string) ([]string, error)
 	Del(ctx context.Context, key ...string) (int64, error)
 	SetEx(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	// SetNX key 不存在时写入，返回是否写入成功
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
 	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
 	Close() error
 	Exists(ctx context.Context, key string) (bool, error)
@@ -38,6 +38,11 @@ func (im *InMemory) SetEx(_ context.Context, key string, value interface{}, expi
 	return nil
 }
 
+func (im *InMemory) SetNX(_ context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	// Add 在 key 已存在时返回错误
+	return im.Cache.Add(key, value, expiration) == nil, nil
+}
+
 func (im *InMemory) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
 	value, _ := im.Get(ctx, key)
 	im.Cache.Set(key, value, expiration)
@@ -62,14 +67,14 @@ func (im *InMemory) Exists(ctx context.Context, key string) (bool, error) {
 	return ok, nil
 }
 
+// IsOk 本地缓存始终可用
 func (im *InMemory) IsOk() bool {
-	panic("not implemented") // TODO: Implement
+	return true
 }
 
 func (im *InMemory) OccurErr(_ error) {
-	panic("not implemented") // TODO: Implement
 }
 
 func (im *InMemory) Error() error {
-	panic("not implemented") // TODO: Implement
+	return nil
 }
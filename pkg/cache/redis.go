@@ -83,6 +83,10 @@ func (r *Redis) SetEx(ctx context.Context, key string, value interface{}, expira
 	return r.Client.SetEx(ctx, key, value, expiration).Err()
 }
 
+func (r *Redis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return r.Client.SetNX(ctx, key, value, expiration).Result()
+}
+
 func (r *Redis) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
 	return r.Client.Expire(ctx, key, expiration).Result()
 }
@@ -88,3 +88,8 @@ func NewDB(opt Option) (*DB, error) {
 func (db *DB) Close() error {
 	return db.sqlDB.Close()
 }
+
+// Stats 连接池状态
+func (db *DB) Stats() sql.DBStats {
+	return db.sqlDB.Stats()
+}
@@ -2,6 +2,7 @@ package ipsearch
 
 import (
 	"log"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -21,6 +22,18 @@ type IPAddress struct {
 	Latitude    float64
 }
 
+// Locator 查询 IP 所在地，无法查询的地址返回 false
+type Locator func(ip string) (IPAddress, bool)
+
+// Locate 查询 IPv4 地址所在地，IP 库只支持 IPv4，其他地址和未初始化 IP 库时返回 false
+func Locate(ip string) (IPAddress, bool) {
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil || ips == nil {
+		return IPAddress{IP: ip}, false
+	}
+	return GetIPAddress(v4.String()), true
+}
+
 func GetIPAddress(ip string) IPAddress {
 	if ip == "" {
 		return IPAddress{IP: ip}
@@ -5,6 +5,15 @@ import (
 	"testing"
 )
 
+func TestLocate(t *testing.T) {
+	// IPv6 地址不查询 IP 库
+	for _, ip := range []string{"", "::1", "2001:db8::1", "invalid"} {
+		if _, ok := Locate(ip); ok {
+			t.Errorf("expected %q to be unknown", ip)
+		}
+	}
+}
+
 func TestGetIPLocation(t *testing.T) {
 	InitIpDatabase("C:\\Users\\1\\Documents\\国内精华版-202404-354425\\qqzeng-ip-china-utf8.dat")
 	ipaddress := GetIPAddress("203.72.97.75")
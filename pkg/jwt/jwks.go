@@ -0,0 +1,187 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyStatusActive 当前用于签名的 key
+	KeyStatusActive = "active"
+	// KeyStatusRetired 已停止签名、仍用于验证的 key，其签发的 token 过期后移除
+	KeyStatusRetired = "retired"
+)
+
+// JWK RFC 7517 定义的公钥，Status 为轮换状态，标准客户端会忽略该字段
+type JWK struct {
+	Kty    string `json:"kty"`
+	Kid    string `json:"kid"`
+	Use    string `json:"use,omitempty"`
+	Alg    string `json:"alg,omitempty"`
+	N      string `json:"n,omitempty"`
+	E      string `json:"e,omitempty"`
+	Crv    string `json:"crv,omitempty"`
+	X      string `json:"x,omitempty"`
+	Y      string `json:"y,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Discovery OpenID Connect 发现文档中与验证 token 相关的字段
+type Discovery struct {
+	Issuer                           string   `json:"issuer"`
+	JwksUri                          string   `json:"jwks_uri"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+func encodeInt(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// padded 按曲线长度补齐坐标，RFC 7518 要求定长编码
+func padded(n *big.Int, size int) []byte {
+	b := make([]byte, size)
+	return n.FillBytes(b)
+}
+
+// toJWK 转换为 JWK，HS256 没有公钥，返回 false
+func (k *Key) toJWK() (JWK, bool) {
+	jwk := JWK{Kid: k.Kid, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeInt(pub.N.Bytes())
+		jwk.E = encodeInt(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeInt(padded(pub.X, size))
+		jwk.Y = encodeInt(padded(pub.Y, size))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeInt(pub)
+	default:
+		return jwk, false
+	}
+	return jwk, true
+}
+
+// JWKS 返回所有非对称 key 的公钥，当前签名的 key 排在最前
+func (m *Manager) JWKS() *JWKS {
+	jwks := &JWKS{Keys: []JWK{}}
+	if jwk, ok := m.signing.toJWK(); ok {
+		jwk.Status = KeyStatusActive
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	for _, k := range m.Keys() {
+		if k == m.signing {
+			continue
+		}
+		if jwk, ok := k.toJWK(); ok {
+			jwk.Status = KeyStatusRetired
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// Discovery 返回发现文档，jwksUri 为 JWKS 的完整地址
+func (m *Manager) Discovery(jwksUri string) *Discovery {
+	d := &Discovery{
+		Issuer:                           m.opt.Issuer,
+		JwksUri:                          jwksUri,
+		ResponseTypesSupported:           []string{"token"},
+		SubjectTypesSupported:            []string{"public"},
+		IdTokenSigningAlgValuesSupported: []string{},
+	}
+	for _, alg := range m.methods {
+		if alg != HS256 {
+			d.IdTokenSigningAlgValuesSupported = append(d.IdTokenSigningAlgValuesSupported, alg)
+		}
+	}
+	return d
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// parseJWK 将 JWK 转换为验证用的 Key，未声明 alg 时按密钥类型推断
+func parseJWK(jwk JWK) (*Key, error) {
+	k := &Key{Kid: jwk.Kid, Algorithm: jwk.Alg}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		k.verifyKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if k.Algorithm == "" {
+			k.Algorithm = RS256
+		}
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("invalid ec public key")
+		}
+		k.verifyKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if k.Algorithm == "" {
+			k.Algorithm = ES256
+		}
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key")
+		}
+		k.verifyKey = ed25519.PublicKey(x)
+		if k.Algorithm == "" {
+			k.Algorithm = EdDSA
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+	switch k.Algorithm {
+	case RS256, ES256, EdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", k.Algorithm)
+	}
+	return k, nil
+}
@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"service_template/pkg/logger"
+	"service_template/pkg/requestid"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+type JWKSClientOption struct {
+	// 远程 JWKS 地址
+	Url string `json:"url" yaml:"url"`
+	// 为空时不校验 iss
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// 为空时不校验 aud，否则 token 的 aud 须包含其中之一
+	Audience []string `json:"audience" yaml:"audience"`
+	// 允许的时钟偏差，单位秒
+	Leeway int `json:"leeway" yaml:"leeway"`
+	// 定期刷新 key 集合的间隔，单位秒，默认 3600
+	RefreshInterval int `json:"refresh_interval" yaml:"refresh_interval"`
+	// 遇到未知 kid 时强制刷新的最小间隔，单位秒，默认 60，避免伪造的 kid 频繁触发请求
+	MinRefreshInterval int          `json:"min_refresh_interval" yaml:"min_refresh_interval"`
+	HttpClient         *http.Client `json:"-" yaml:"-"`
+}
+
+// JWKSClient 使用远程 JWKS 验证外部 IdP 签发的 token，缓存 key 集合并按需刷新
+type JWKSClient struct {
+	opt JWKSClientOption
+	now func() time.Time
+
+	m         sync.RWMutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+	// 串行化刷新，并发请求只触发一次拉取
+	refreshing sync.Mutex
+}
+
+func NewJWKSClient(opt JWKSClientOption) *JWKSClient {
+	if opt.RefreshInterval <= 0 {
+		opt.RefreshInterval = 3600
+	}
+	if opt.MinRefreshInterval <= 0 {
+		opt.MinRefreshInterval = 60
+	}
+	if opt.HttpClient == nil {
+		opt.HttpClient = &http.Client{Timeout: 10 * time.Second, Transport: requestid.RoundTripper(nil)}
+	}
+	return &JWKSClient{opt: opt, now: time.Now}
+}
+
+func (c *JWKSClient) fetch(ctx context.Context) (map[string]*Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.opt.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.opt.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+	jwks := &JWKS{}
+	if err := json.NewDecoder(resp.Body).Decode(jwks); err != nil {
+		return nil, errors.Wrap(err, "decode jwks")
+	}
+	keys := make(map[string]*Key, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(jwk)
+		if err != nil {
+			// 忽略不支持的 key，不影响其他 key 的使用
+			logger.Warnf("skip jwk %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[k.Kid] = k
+	}
+	return keys, nil
+}
+
+// refresh 距上次拉取超过 interval 时重新拉取，拉取失败时继续使用已缓存的 key
+func (c *JWKSClient) refresh(ctx context.Context, interval time.Duration) error {
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+	c.m.RLock()
+	fresh := c.keys != nil && c.now().Sub(c.fetchedAt) < interval
+	c.m.RUnlock()
+	if fresh {
+		return nil
+	}
+	keys, err := c.fetch(ctx)
+	c.m.Lock()
+	defer c.m.Unlock()
+	// 失败时同样记录时间，避免远程不可用时每个请求都去拉取
+	c.fetchedAt = c.now()
+	if err != nil {
+		return err
+	}
+	c.keys = keys
+	return nil
+}
+
+func (c *JWKSClient) key(ctx context.Context, kid string) (*Key, error) {
+	if err := c.refresh(ctx, time.Duration(c.opt.RefreshInterval)*time.Second); err != nil {
+		logger.Warnf("refresh jwks from %s error: %v", c.opt.Url, err)
+	}
+	c.m.RLock()
+	k, ok := c.keys[kid]
+	c.m.RUnlock()
+	if ok {
+		return k, nil
+	}
+	// 未知 kid 可能是远程刚轮换了 key
+	if err := c.refresh(ctx, time.Duration(c.opt.MinRefreshInterval)*time.Second); err != nil {
+		return nil, err
+	}
+	c.m.RLock()
+	defer c.m.RUnlock()
+	if k, ok = c.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+	return k, nil
+}
+
+// Parse 验证 token 并解析到 claims 中
+func (c *JWKSClient) Parse(ctx context.Context, token string, claims jwt.Claims) error {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{RS256, ES256, EdDSA}),
+		jwt.WithLeeway(time.Duration(c.opt.Leeway) * time.Second),
+		jwt.WithTimeFunc(c.now),
+		jwt.WithExpirationRequired(),
+	}
+	if c.opt.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(c.opt.Issuer))
+	}
+	t, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, err := c.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != k.Algorithm {
+			return nil, errors.New("unexpected method")
+		}
+		return k.verifyKey, nil
+	}, opts...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !t.Valid {
+		return ErrInvalidToken
+	}
+	if len(c.opt.Audience) > 0 {
+		aud, err := claims.GetAudience()
+		if err != nil {
+			return err
+		}
+		if !containsAny(aud, c.opt.Audience) {
+			return ErrInvalidToken
+		}
+	}
+	return nil
+}
+
+func containsAny(values, expected []string) bool {
+	for _, v := range values {
+		for _, e := range expected {
+			if v == e {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer 以 Manager 的公钥提供 JWKS，可在测试中切换 Manager 模拟轮换
+type jwksServer struct {
+	*httptest.Server
+	m        sync.Mutex
+	manager  *Manager
+	requests atomic.Int32
+	fail     atomic.Bool
+}
+
+func newJWKSServer(t *testing.T, m *Manager) *jwksServer {
+	s := &jwksServer{manager: m}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.m.Lock()
+		defer s.m.Unlock()
+		_ = json.NewEncoder(w).Encode(s.manager.JWKS())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) rotate(m *Manager) {
+	s.m.Lock()
+	s.manager = m
+	s.m.Unlock()
+}
+
+func TestJWKS(t *testing.T) {
+	keys := testKeys(t)
+	m, err := NewManager(Option{Issuer: "https://idp", SigningKey: "es", Keys: []KeyOption{keys[HS256], keys[RS256], keys[ES256], keys[EdDSA]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := m.JWKS()
+	// HS256 不公开
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("expect 3 public keys, got %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kid != "es" || jwks.Keys[0].Status != KeyStatusActive {
+		t.Fatalf("signing key should be listed first as active, got %+v", jwks.Keys[0])
+	}
+	for _, jwk := range jwks.Keys[1:] {
+		if jwk.Status != KeyStatusRetired {
+			t.Fatalf("expect retired key, got %+v", jwk)
+		}
+	}
+	for _, jwk := range jwks.Keys {
+		if _, err := parseJWK(jwk); err != nil {
+			t.Fatalf("%s: %v", jwk.Kid, err)
+		}
+	}
+	d := m.Discovery("https://idp/.well-known/jwks.json")
+	if d.Issuer != "https://idp" || len(d.IdTokenSigningAlgValuesSupported) != 3 {
+		t.Fatalf("unexpected discovery %+v", d)
+	}
+}
+
+func TestJWKSClient(t *testing.T) {
+	keys := testKeys(t)
+	ctx := context.Background()
+	for _, alg := range []string{RS256, ES256, EdDSA} {
+		m, _ := NewManager(Option{Issuer: "https://idp", Audience: []string{"api"}, Keys: []KeyOption{keys[alg]}})
+		server := newJWKSServer(t, m)
+		client := NewJWKSClient(JWKSClientOption{Url: server.URL, Issuer: "https://idp", Audience: []string{"api"}})
+		token, _ := m.NewToken(5)
+		claims := &UserClaims{}
+		if err := client.Parse(ctx, token, claims); err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if claims.UserId != 5 {
+			t.Fatalf("%s: unexpected claims %+v", alg, claims)
+		}
+		// key 集合已缓存
+		_ = client.Parse(ctx, token, &UserClaims{})
+		if n := server.requests.Load(); n != 1 {
+			t.Fatalf("%s: expect 1 request, got %d", alg, n)
+		}
+	}
+}
+
+func TestJWKSClientValidation(t *testing.T) {
+	keys := testKeys(t)
+	m, _ := NewManager(Option{Issuer: "https://other", Audience: []string{"web"}, Keys: []KeyOption{keys[RS256]}})
+	server := newJWKSServer(t, m)
+	token, _ := m.NewToken(1)
+	ctx := context.Background()
+	if err := NewJWKSClient(JWKSClientOption{Url: server.URL, Issuer: "https://idp"}).Parse(ctx, token, &UserClaims{}); err == nil {
+		t.Fatal("token with wrong issuer accepted")
+	}
+	if err := NewJWKSClient(JWKSClientOption{Url: server.URL, Audience: []string{"api"}}).Parse(ctx, token, &UserClaims{}); err == nil {
+		t.Fatal("token with wrong audience accepted")
+	}
+	// 对称密钥签名的 token 不能通过 JWKS 验证
+	hs, _ := NewManager(Option{Keys: []KeyOption{keys[HS256]}})
+	token, _ = hs.NewToken(1)
+	if err := NewJWKSClient(JWKSClientOption{Url: server.URL}).Parse(ctx, token, &UserClaims{}); err == nil {
+		t.Fatal("hmac token accepted")
+	}
+}
+
+func TestJWKSClientRotation(t *testing.T) {
+	keys := testKeys(t)
+	ctx := context.Background()
+	old, _ := NewManager(Option{Keys: []KeyOption{keys[RS256]}})
+	server := newJWKSServer(t, old)
+	client := NewJWKSClient(JWKSClientOption{Url: server.URL, RefreshInterval: 600, MinRefreshInterval: 60})
+	now := time.Now()
+	client.now = func() time.Time {
+		return now
+	}
+	token, _ := old.NewToken(1)
+	if err := client.Parse(ctx, token, &UserClaims{}); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := NewManager(Option{SigningKey: "ed", Keys: []KeyOption{keys[RS256], keys[EdDSA]}})
+	server.rotate(rotated)
+	token, _ = rotated.NewToken(1)
+	// 刚拉取过，未知 kid 不会立即触发刷新
+	if err := client.Parse(ctx, token, &UserClaims{}); err == nil {
+		t.Fatal("token with unknown kid accepted")
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Fatalf("expect 1 request, got %d", n)
+	}
+	now = now.Add(61 * time.Second)
+	if err := client.Parse(ctx, token, &UserClaims{}); err != nil {
+		t.Fatalf("rotated key not fetched: %v", err)
+	}
+	// 远程不可用时继续使用已缓存的 key
+	server.fail.Store(true)
+	now = now.Add(11 * time.Minute)
+	if err := client.Parse(ctx, token, &UserClaims{}); err != nil {
+		t.Fatalf("cached keys not used when jwks unavailable: %v", err)
+	}
+	if n := server.requests.Load(); n != 3 {
+		t.Fatalf("expect 3 requests, got %d", n)
+	}
+}
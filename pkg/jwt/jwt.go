@@ -1,47 +1,250 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 )
 
+var (
+	ErrNotInitialized = errors.New("jwt not initialized")
+	ErrInvalidToken   = errors.New("token已失效")
+)
+
 type UserClaims struct {
 	jwt.RegisteredClaims
-	UserId int `json:"user_id"`
+	UserId   int    `json:"user_id"`
+	TenantId string `json:"tenant_id,omitempty"`
+	// 签发该 token 的登录会话，即 refresh token 族
+	SessionId string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	// 业务自定义的扩展字段
+	Extensions map[string]interface{} `json:"ext,omitempty"`
 }
 
-func NewToken(userId int) (string, error) {
-	now := time.Now().Local()
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 24 * 7)),
-			NotBefore: jwt.NewNumericDate(now),
-		},
-		UserId: userId,
-	})
-	return claims.SignedString([]byte(""))
+type Option struct {
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// 签发时写入 aud，验证时 token 的 aud 须包含其中之一
+	Audience []string `json:"audience" yaml:"audience"`
+	// 签名使用的 kid，默认为 Keys 中第一个可签名的 key
+	SigningKey string `json:"signing_key" yaml:"signing_key"`
+	// 所有可用于验证的 key，轮换时旧 key 保留至其签发的 token 全部过期
+	Keys []KeyOption `json:"keys" yaml:"keys"`
+	// 允许的时钟偏差，单位秒
+	Leeway int `json:"leeway" yaml:"leeway"`
+	// access token 有效期，单位秒，默认 2 小时
+	AccessTtl int `json:"access_ttl" yaml:"access_ttl"`
+	// refresh token 有效期，单位秒，默认 7 天
+	RefreshTtl int `json:"refresh_ttl" yaml:"refresh_ttl"`
+	// refresh token 的存储：redis / db
+	RefreshStore string `json:"refresh_store" yaml:"refresh_store"`
+	// 吊销检查结果的本地缓存时间，单位秒，默认 5
+	RevocationCacheTtl int `json:"revocation_cache_ttl" yaml:"revocation_cache_ttl"`
+	// 公开的 JWKS 允许被缓存的时间，单位秒，默认 300。
+	// 轮换时新 key 须先发布超过该时间，再切换为签名 key
+	JwksMaxAge int `json:"jwks_max_age" yaml:"jwks_max_age"`
 }
 
-func ParseToken(token string) (int, error) {
+// Manager 按配置签发和验证 token
+type Manager struct {
+	opt     Option
+	signing *Key
+	keys    map[string]*Key
+	methods []string
+	now     func() time.Time
+}
+
+func NewManager(opt Option) (*Manager, error) {
+	if len(opt.Keys) == 0 {
+		return nil, errors.New("jwt keys are required")
+	}
+	if opt.AccessTtl <= 0 {
+		opt.AccessTtl = 2 * 60 * 60
+	}
+	if opt.RefreshTtl <= 0 {
+		opt.RefreshTtl = 7 * 24 * 60 * 60
+	}
+	if opt.JwksMaxAge <= 0 {
+		opt.JwksMaxAge = 300
+	}
+	m := &Manager{opt: opt, keys: make(map[string]*Key, len(opt.Keys)), now: time.Now}
+	algs := make(map[string]struct{})
+	for _, ko := range opt.Keys {
+		k, err := loadKey(ko)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate jwt key %s", k.Kid)
+		}
+		m.keys[k.Kid] = k
+		if _, ok := algs[k.Algorithm]; !ok {
+			algs[k.Algorithm] = struct{}{}
+			m.methods = append(m.methods, k.Algorithm)
+		}
+		if m.signing == nil && k.CanSign() && (opt.SigningKey == "" || opt.SigningKey == k.Kid) {
+			m.signing = k
+		}
+	}
+	if m.signing == nil {
+		return nil, fmt.Errorf("jwt signing key %s not found", opt.SigningKey)
+	}
+	return m, nil
+}
+
+// Keys 所有可用于验证的 key
+func (m *Manager) Keys() []*Key {
+	keys := make([]*Key, 0, len(m.opt.Keys))
+	for _, ko := range m.opt.Keys {
+		keys = append(keys, m.keys[ko.Kid])
+	}
+	return keys
+}
+
+func (m *Manager) Issuer() string {
+	return m.opt.Issuer
+}
+
+func (m *Manager) AccessTtl() time.Duration {
+	return time.Duration(m.opt.AccessTtl) * time.Second
+}
+
+func (m *Manager) RefreshTtl() time.Duration {
+	return time.Duration(m.opt.RefreshTtl) * time.Second
+}
+
+func (m *Manager) JwksMaxAge() time.Duration {
+	return time.Duration(m.opt.JwksMaxAge) * time.Second
+}
+
+func newJti() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign 补全 claims 中的 iss/aud/iat/nbf/exp/jti 后签名，claims 中已设置的值保持不变
+func (m *Manager) Sign(claims *UserClaims, ttl time.Duration) (string, error) {
+	now := m.now()
+	rc := &claims.RegisteredClaims
+	if rc.Issuer == "" {
+		rc.Issuer = m.opt.Issuer
+	}
+	if len(rc.Audience) == 0 {
+		rc.Audience = m.opt.Audience
+	}
+	if rc.IssuedAt == nil {
+		rc.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if rc.NotBefore == nil {
+		rc.NotBefore = jwt.NewNumericDate(now)
+	}
+	if rc.ExpiresAt == nil {
+		rc.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	}
+	if rc.ID == "" {
+		rc.ID = newJti()
+	}
+	t := jwt.NewWithClaims(m.signing.method, claims)
+	t.Header["kid"] = m.signing.Kid
+	return t.SignedString(m.signing.signKey)
+}
+
+// NewToken 签发 access token
+func (m *Manager) NewToken(userId int) (string, error) {
+	return m.Sign(&UserClaims{UserId: userId}, m.AccessTtl())
+}
+
+// Parse 验证 token 并返回 claims
+func (m *Manager) Parse(token string) (*UserClaims, error) {
 	if token == "" {
-		return 0, errors.New("token为空")
+		return nil, errors.New("token为空")
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(m.methods),
+		jwt.WithLeeway(time.Duration(m.opt.Leeway) * time.Second),
+		jwt.WithTimeFunc(m.now),
+		jwt.WithExpirationRequired(),
+	}
+	if m.opt.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.opt.Issuer))
+	}
+	claims := &UserClaims{}
+	t, err := jwt.ParseWithClaims(token, claims, m.keyFunc, opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !t.Valid || !m.validAudience(claims.Audience) {
+		return nil, ErrInvalidToken
 	}
-	t, err := jwt.ParseWithClaims(token, &UserClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return 0, errors.New("unexpected method")
+	return claims, nil
+}
+
+func (m *Manager) keyFunc(t *jwt.Token) (interface{}, error) {
+	k := m.signing
+	if kid, ok := t.Header["kid"].(string); ok {
+		if k, ok = m.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown kid %s", kid)
 		}
-		return []byte(""), nil
-	})
+	}
+	if t.Method.Alg() != k.Algorithm {
+		return nil, errors.New("unexpected method")
+	}
+	return k.verifyKey, nil
+}
+
+func (m *Manager) validAudience(aud jwt.ClaimStrings) bool {
+	return len(m.opt.Audience) == 0 || containsAny(aud, m.opt.Audience)
+}
+
+// ParseToken 验证 token 并返回用户 ID
+func (m *Manager) ParseToken(token string) (int, error) {
+	claims, err := m.Parse(token)
 	if err != nil {
-		return 0, errors.WithStack(err)
+		return 0, err
 	}
-	if !t.Valid {
-		return 0, errors.New("token已失效")
+	return claims.UserId, nil
+}
+
+var defaultManager *Manager
+
+// Init 按配置初始化 NewToken/ParseToken 使用的 Manager
+func Init(opt Option) error {
+	m, err := NewManager(opt)
+	if err != nil {
+		return err
 	}
-	if c, ok := t.Claims.(*UserClaims); ok {
-		return c.UserId, nil
+	defaultManager = m
+	return nil
+}
+
+// Default 返回 Init 初始化的 Manager
+func Default() *Manager {
+	return defaultManager
+}
+
+func NewToken(userId int) (string, error) {
+	if defaultManager == nil {
+		return "", ErrNotInitialized
+	}
+	return defaultManager.NewToken(userId)
+}
+
+func Parse(token string) (*UserClaims, error) {
+	if defaultManager == nil {
+		return nil, ErrNotInitialized
+	}
+	return defaultManager.Parse(token)
+}
+
+func ParseToken(token string) (int, error) {
+	if defaultManager == nil {
+		return 0, ErrNotInitialized
 	}
-	return 0, errors.New("token已失效")
+	return defaultManager.ParseToken(token)
 }
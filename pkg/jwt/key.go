@@ -0,0 +1,134 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// MinSecretLength HS256 密钥的最小长度，与 SHA-256 的输出长度一致
+const MinSecretLength = 32
+
+type KeyOption struct {
+	// 写入 token 头部的 kid
+	Kid       string `json:"kid" yaml:"kid"`
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// HS256 使用的密钥，至少 32 字节
+	Secret string `json:"secret" yaml:"secret"`
+	// 非对称算法的私钥，PEM 内容或文件路径，只用于验证的 key 可以为空
+	PrivateKey string `json:"private_key" yaml:"private_key"`
+	// 非对称算法的公钥，PEM 内容或文件路径，为空时由私钥导出
+	PublicKey string `json:"public_key" yaml:"public_key"`
+}
+
+// Key 签名和验证 token 使用的密钥
+type Key struct {
+	Kid       string
+	Algorithm string
+	method    jwt.SigningMethod
+	// 签名使用的密钥，只用于验证时为 nil
+	signKey interface{}
+	// 验证使用的密钥，非对称算法为公钥
+	verifyKey interface{}
+}
+
+// PublicKey 非对称算法的公钥，HS256 返回 nil
+func (k *Key) PublicKey() crypto.PublicKey {
+	if k.Algorithm == HS256 {
+		return nil
+	}
+	return k.verifyKey
+}
+
+// CanSign 是否可用于签名
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// readPEM 配置以 -----BEGIN 开头时视为 PEM 内容，否则视为文件路径
+func readPEM(v string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(v), "-----BEGIN") {
+		return []byte(v), nil
+	}
+	return os.ReadFile(v)
+}
+
+func loadKey(opt KeyOption) (*Key, error) {
+	if opt.Kid == "" {
+		return nil, errors.New("jwt key kid is required")
+	}
+	k := &Key{Kid: opt.Kid, Algorithm: opt.Algorithm}
+	if opt.Algorithm == HS256 {
+		if opt.Secret == "" {
+			return nil, fmt.Errorf("jwt key %s: secret is required", opt.Kid)
+		}
+		if len(opt.Secret) < MinSecretLength {
+			return nil, fmt.Errorf("jwt key %s: secret must be at least %d bytes", opt.Kid, MinSecretLength)
+		}
+		k.method = jwt.SigningMethodHS256
+		k.signKey = []byte(opt.Secret)
+		k.verifyKey = []byte(opt.Secret)
+		return k, nil
+	}
+	var (
+		parsePrivate func([]byte) (interface{}, error)
+		parsePublic  func([]byte) (interface{}, error)
+		public       func(interface{}) interface{}
+	)
+	switch opt.Algorithm {
+	case RS256:
+		k.method = jwt.SigningMethodRS256
+		parsePrivate = func(b []byte) (interface{}, error) { return jwt.ParseRSAPrivateKeyFromPEM(b) }
+		parsePublic = func(b []byte) (interface{}, error) { return jwt.ParseRSAPublicKeyFromPEM(b) }
+		public = func(k interface{}) interface{} { return &k.(*rsa.PrivateKey).PublicKey }
+	case ES256:
+		k.method = jwt.SigningMethodES256
+		parsePrivate = func(b []byte) (interface{}, error) { return jwt.ParseECPrivateKeyFromPEM(b) }
+		parsePublic = func(b []byte) (interface{}, error) { return jwt.ParseECPublicKeyFromPEM(b) }
+		public = func(k interface{}) interface{} { return &k.(*ecdsa.PrivateKey).PublicKey }
+	case EdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		parsePrivate = func(b []byte) (interface{}, error) { return jwt.ParseEdPrivateKeyFromPEM(b) }
+		parsePublic = func(b []byte) (interface{}, error) { return jwt.ParseEdPublicKeyFromPEM(b) }
+		public = func(k interface{}) interface{} { return k.(ed25519.PrivateKey).Public() }
+	default:
+		return nil, fmt.Errorf("jwt key %s: unsupported algorithm %s", opt.Kid, opt.Algorithm)
+	}
+	if opt.PrivateKey != "" {
+		b, err := readPEM(opt.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "jwt key %s", opt.Kid)
+		}
+		if k.signKey, err = parsePrivate(b); err != nil {
+			return nil, errors.Wrapf(err, "jwt key %s", opt.Kid)
+		}
+		k.verifyKey = public(k.signKey)
+	}
+	if opt.PublicKey != "" {
+		b, err := readPEM(opt.PublicKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "jwt key %s", opt.Kid)
+		}
+		if k.verifyKey, err = parsePublic(b); err != nil {
+			return nil, errors.Wrapf(err, "jwt key %s", opt.Kid)
+		}
+	}
+	if k.verifyKey == nil {
+		return nil, fmt.Errorf("jwt key %s: private key or public key is required", opt.Kid)
+	}
+	return k, nil
+}
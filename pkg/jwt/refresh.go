@@ -0,0 +1,181 @@
+package jwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrInvalidRefreshToken  = errors.New("refresh token已失效")
+	// ErrRefreshTokenReused 已轮换的 refresh token 被再次使用，整个 token 族已被吊销
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshToken 保存的 refresh token，只保存 token 的哈希
+type RefreshToken struct {
+	Hash string
+	// 同一次登录中轮换出的 token 属于同一族
+	Family    string
+	UserId    int
+	Used      bool
+	Revoked   bool
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type RefreshStore interface {
+	Save(ctx context.Context, t *RefreshToken) error
+	// Get 不存在时返回 ErrRefreshTokenNotFound
+	Get(ctx context.Context, hash string) (*RefreshToken, error)
+	// MarkUsed 原子地将 token 标记为已使用，已使用过时返回 false
+	MarkUsed(ctx context.Context, hash string) (bool, error)
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// access token 有效期，单位秒
+	ExpiresIn int64 `json:"expires_in"`
+	// refresh token 有效期，单位秒
+	RefreshExpiresIn int64 `json:"refresh_expires_in"`
+	// 登录会话 ID，即 token 族，刷新后不变
+	SessionId string `json:"session_id"`
+}
+
+// ClaimsLoader 签发 access token 前加载用户当前的角色、权限等信息，
+// 登录和每次刷新时都会重新加载，使变更在下次刷新后生效
+type ClaimsLoader func(ctx context.Context, userId int) (*UserClaims, error)
+
+// Refresher 签发 access/refresh token 对，refresh token 每次使用后轮换
+type Refresher struct {
+	m     *Manager
+	store RefreshStore
+	// 为 nil 时不检查用户的吊销时间
+	revoker *Revoker
+	// 为 nil 时 access token 中只有用户 ID
+	loader ClaimsLoader
+}
+
+func NewRefresher(m *Manager, store RefreshStore, revoker *Revoker, loader ClaimsLoader) *Refresher {
+	return &Refresher{m: m, store: store, revoker: revoker, loader: loader}
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Refresher) issue(ctx context.Context, userId int, family string) (*TokenPair, error) {
+	claims := &UserClaims{}
+	if r.loader != nil {
+		c, err := r.loader(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		claims = c
+	}
+	claims.UserId = userId
+	claims.SessionId = family
+	access, err := r.m.Sign(claims, r.m.AccessTtl())
+	if err != nil {
+		return nil, err
+	}
+	refresh := randomToken()
+	now := r.m.now()
+	err = r.store.Save(ctx, &RefreshToken{
+		Hash:      hashToken(refresh),
+		Family:    family,
+		UserId:    userId,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(r.m.RefreshTtl()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		ExpiresIn:        int64(r.m.AccessTtl().Seconds()),
+		RefreshExpiresIn: int64(r.m.RefreshTtl().Seconds()),
+		SessionId:        family,
+	}, nil
+}
+
+// Issue 登录时签发新的 token 族
+func (r *Refresher) Issue(ctx context.Context, userId int) (*TokenPair, error) {
+	return r.issue(ctx, userId, newJti())
+}
+
+// Refresh 使用 refresh token 换取新的 token 对，旧 refresh token 随即失效。
+// 已失效的 refresh token 被再次使用时，视为泄露并吊销整个 token 族。
+func (r *Refresher) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+	t, err := r.store.Get(ctx, hash)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if t.Revoked || !t.ExpiresAt.After(r.m.now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if r.revoker != nil {
+		watermark, err := r.revoker.revokedBefore(ctx, t.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if issuedBefore(t.IssuedAt, watermark) {
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+	ok, err := r.store.MarkUsed(ctx, hash)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if !ok {
+		if err := r.store.RevokeFamily(ctx, t.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return r.issue(ctx, t.UserId, t.Family)
+}
+
+// Lookup 查询 refresh token 的信息，不存在时返回 ErrInvalidRefreshToken
+func (r *Refresher) Lookup(ctx context.Context, refreshToken string) (*RefreshToken, error) {
+	t, err := r.store.Get(ctx, hashToken(refreshToken))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	return t, err
+}
+
+// Revoke 吊销 refresh token 所在的 token 族，用于登出
+func (r *Refresher) Revoke(ctx context.Context, refreshToken string) error {
+	t, err := r.store.Get(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+	return r.store.RevokeFamily(ctx, t.Family)
+}
@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"context"
+	"service_template/pkg/cache"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RefreshStoreRedis = "redis"
+	RefreshStoreDB    = "db"
+)
+
+// NewRefreshStore 按类型创建 refresh token 存储，默认使用 Redis。
+// dbStore 为类型为 db 时使用的存储，由使用方基于自己迁移的表实现
+func NewRefreshStore(typ string, rdb *cache.Redis, dbStore RefreshStore) (RefreshStore, error) {
+	switch typ {
+	case RefreshStoreRedis, "":
+		if rdb == nil {
+			return nil, errors.New("refresh store requires redis")
+		}
+		return NewRedisRefreshStore(rdb), nil
+	case RefreshStoreDB:
+		if dbStore == nil {
+			return nil, errors.New("refresh store requires database")
+		}
+		return dbStore, nil
+	default:
+		return nil, errors.New("unsupported refresh store")
+	}
+}
+
+type redisRefreshStore struct {
+	rdb *cache.Redis
+}
+
+func NewRedisRefreshStore(rdb *cache.Redis) RefreshStore {
+	return &redisRefreshStore{rdb: rdb}
+}
+
+func refreshKey(hash string) string {
+	return "refresh_token:" + hash
+}
+
+func familyKey(family string) string {
+	return "refresh_family:" + family
+}
+
+func (s *redisRefreshStore) do(fn func() error) error {
+	if !s.rdb.IsOk() {
+		return s.rdb.Error()
+	}
+	err := fn()
+	if err != nil {
+		s.rdb.OccurErr(err)
+	}
+	return err
+}
+
+func (s *redisRefreshStore) Save(ctx context.Context, t *RefreshToken) error {
+	// 族内 token 的过期时间随轮换向后推移，族的集合与最新的 token 同时过期
+	script := `
+redis.call('HSET', KEYS[1], 'family', ARGV[1], 'user_id', ARGV[2], 'used', 0, 'revoked', 0, 'issued_at', ARGV[5], 'expires_at', ARGV[3])
+redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+redis.call('SADD', KEYS[2], ARGV[4])
+redis.call('PEXPIREAT', KEYS[2], ARGV[3])
+return 1
+`
+	return s.do(func() error {
+		return s.rdb.Eval(ctx, script, []string{refreshKey(t.Hash), familyKey(t.Family)},
+			t.Family, t.UserId, t.ExpiresAt.UnixMilli(), t.Hash, t.IssuedAt.UnixMilli()).Err()
+	})
+}
+
+func (s *redisRefreshStore) Get(ctx context.Context, hash string) (*RefreshToken, error) {
+	var values map[string]string
+	err := s.do(func() (err error) {
+		values, err = s.rdb.HGetAll(ctx, refreshKey(hash)).Result()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrRefreshTokenNotFound
+	}
+	userId, _ := strconv.Atoi(values["user_id"])
+	issuedAt, _ := strconv.ParseInt(values["issued_at"], 10, 64)
+	expiresAt, _ := strconv.ParseInt(values["expires_at"], 10, 64)
+	return &RefreshToken{
+		Hash:      hash,
+		Family:    values["family"],
+		UserId:    userId,
+		Used:      values["used"] != "0",
+		Revoked:   values["revoked"] != "0",
+		IssuedAt:  time.UnixMilli(issuedAt),
+		ExpiresAt: time.UnixMilli(expiresAt),
+	}, nil
+}
+
+func (s *redisRefreshStore) MarkUsed(ctx context.Context, hash string) (bool, error) {
+	script := `
+if redis.call('EXISTS', KEYS[1]) == 0
+then
+	return -1
+end
+return redis.call('HINCRBY', KEYS[1], 'used', 1)
+`
+	var used int64
+	err := s.do(func() (err error) {
+		used, err = s.rdb.Eval(ctx, script, []string{refreshKey(hash)}).Int64()
+		return
+	})
+	if err != nil {
+		return false, err
+	}
+	if used < 0 {
+		return false, ErrRefreshTokenNotFound
+	}
+	return used == 1, nil
+}
+
+func (s *redisRefreshStore) RevokeFamily(ctx context.Context, family string) error {
+	script := `
+for _, hash in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	local key = 'refresh_token:' .. hash
+	if redis.call('EXISTS', key) == 1
+	then
+		redis.call('HSET', key, 'revoked', 1)
+	end
+end
+return 1
+`
+	return s.do(func() error {
+		return s.rdb.Eval(ctx, script, []string{familyKey(family)}).Err()
+	})
+}
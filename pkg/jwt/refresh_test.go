@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"context"
+	"service_template/pkg/cache"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// memoryRefreshStore 测试用的内存存储，数据库存储的测试见 internal/repository
+type memoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]*RefreshToken
+}
+
+func newMemoryRefreshStore() *memoryRefreshStore {
+	return &memoryRefreshStore{tokens: map[string]*RefreshToken{}}
+}
+
+func (s *memoryRefreshStore) Save(ctx context.Context, t *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *t
+	s.tokens[t.Hash] = &saved
+	return nil
+}
+
+func (s *memoryRefreshStore) Get(ctx context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	got := *t
+	return &got, nil
+}
+
+func (s *memoryRefreshStore) MarkUsed(ctx context.Context, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return false, ErrRefreshTokenNotFound
+	}
+	if t.Used {
+		return false, nil
+	}
+	t.Used = true
+	return true, nil
+}
+
+func (s *memoryRefreshStore) RevokeFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.Family == family {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+func refreshStores(t *testing.T) map[string]RefreshStore {
+	stores := map[string]RefreshStore{"memory": newMemoryRefreshStore()}
+	rdb, err := cache.NewRedis(cache.Option{
+		Host: "192.168.92.153",
+		Port: 6379,
+	})
+	if err != nil {
+		t.Logf("redis unavailable, only memory store is tested: %v", err)
+		return stores
+	}
+	t.Cleanup(func() {
+		_ = rdb.Close()
+	})
+	stores[RefreshStoreRedis] = NewRedisRefreshStore(rdb.(*cache.Redis))
+	return stores
+}
+
+func newTestRefresher(t *testing.T, store RefreshStore) (*Refresher, *Manager) {
+	m, err := NewManager(Option{Keys: []KeyOption{{Kid: "hs", Algorithm: HS256, Secret: testSecret}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRefresher(m, store, nil, nil), m
+}
+
+func TestRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range refreshStores(t) {
+		r, m := newTestRefresher(t, store)
+		pair, err := r.Issue(ctx, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		claims, err := m.Parse(pair.AccessToken)
+		if err != nil || claims.UserId != 3 || claims.SessionId == "" || claims.SessionId != pair.SessionId {
+			t.Fatalf("%s: unexpected claims %+v, err: %v", name, claims, err)
+		}
+		if rt, err := r.Lookup(ctx, pair.RefreshToken); err != nil || rt.Family != pair.SessionId || rt.UserId != 3 {
+			t.Fatalf("%s: unexpected lookup %+v, err: %v", name, rt, err)
+		}
+		if _, err := r.Lookup(ctx, "unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("%s: expect ErrInvalidRefreshToken, got %v", name, err)
+		}
+		next, err := r.Refresh(ctx, pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if next.RefreshToken == pair.RefreshToken {
+			t.Fatalf("%s: refresh token not rotated", name)
+		}
+		if c, _ := m.Parse(next.AccessToken); c == nil || c.SessionId != claims.SessionId || next.SessionId != pair.SessionId {
+			t.Fatalf("%s: rotated token should stay in the same session", name)
+		}
+		// 旧 token 被再次使用，整个族被吊销
+		if _, err := r.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("%s: expect ErrRefreshTokenReused, got %v", name, err)
+		}
+		if _, err := r.Refresh(ctx, next.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("%s: expect family revoked, got %v", name, err)
+		}
+	}
+}
+
+func TestRefreshRevoke(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range refreshStores(t) {
+		r, _ := newTestRefresher(t, store)
+		pair, _ := r.Issue(ctx, 1)
+		other, _ := r.Issue(ctx, 1)
+		if err := r.Revoke(ctx, pair.RefreshToken); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := r.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("%s: expect ErrInvalidRefreshToken, got %v", name, err)
+		}
+		// 其他登录会话不受影响
+		if _, err := r.Refresh(ctx, other.RefreshToken); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := r.Refresh(ctx, "unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("%s: expect ErrInvalidRefreshToken, got %v", name, err)
+		}
+		if err := r.Revoke(ctx, "unknown"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestRefreshExpired(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range refreshStores(t) {
+		r, m := newTestRefresher(t, store)
+		pair, _ := r.Issue(ctx, 1)
+		m.now = func() time.Time {
+			return time.Now().Add(m.RefreshTtl() + time.Second)
+		}
+		if _, err := r.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("%s: expect ErrInvalidRefreshToken, got %v", name, err)
+		}
+	}
+}
+
+func TestRefreshClaimsLoader(t *testing.T) {
+	ctx := context.Background()
+	m, _ := NewManager(Option{Keys: []KeyOption{{Kid: "hs", Algorithm: HS256, Secret: testSecret}}})
+	roles := []string{"admin"}
+	r := NewRefresher(m, newMemoryRefreshStore(), nil, func(ctx context.Context, userId int) (*UserClaims, error) {
+		return &UserClaims{TenantId: "t1", Roles: roles, Scopes: []string{"read"}, Extensions: map[string]interface{}{"plan": "pro"}}, nil
+	})
+	pair, err := r.Issue(ctx, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := m.Parse(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserId != 9 || claims.TenantId != "t1" || claims.Roles[0] != "admin" || claims.Scopes[0] != "read" || claims.Extensions["plan"] != "pro" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	// 刷新时重新加载
+	roles = []string{"viewer"}
+	pair, _ = r.Refresh(ctx, pair.RefreshToken)
+	claims, _ = m.Parse(pair.AccessToken)
+	if claims.Roles[0] != "viewer" || claims.SessionId == "" {
+		t.Fatalf("claims not reloaded on refresh: %+v", claims)
+	}
+}
@@ -0,0 +1,147 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"service_template/pkg/cache"
+	"strconv"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Revoker 吊销尚未过期的 token。
+// 单个 token 按 jti 加入黑名单，黑名单的过期时间与 token 一致；
+// 按用户记录吊销时间，此前签发的 token 全部失效，用于在所有设备上登出。
+// 检查结果在本地缓存一段时间，其他实例上的吊销最多延迟该时间生效。
+type Revoker struct {
+	rdb   *cache.Redis
+	local *gocache.Cache
+	// 用户吊销时间的保留时间，不短于 token 的最长有效期
+	watermarkTtl time.Duration
+	now          func() time.Time
+}
+
+func NewRevoker(rdb *cache.Redis, m *Manager) *Revoker {
+	ttl := m.opt.RevocationCacheTtl
+	if ttl <= 0 {
+		ttl = 5
+	}
+	watermarkTtl := m.RefreshTtl()
+	if m.AccessTtl() > watermarkTtl {
+		watermarkTtl = m.AccessTtl()
+	}
+	return &Revoker{
+		rdb:          rdb,
+		local:        gocache.New(time.Duration(ttl)*time.Second, time.Minute),
+		watermarkTtl: watermarkTtl,
+		now:          m.now,
+	}
+}
+
+func denyKey(jti string) string {
+	return "jwt_deny:" + jti
+}
+
+func watermarkKey(userId int) string {
+	return fmt.Sprintf("jwt_watermark:%d", userId)
+}
+
+// RevokeToken 吊销单个 token
+func (r *Revoker) RevokeToken(ctx context.Context, claims *UserClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	ttl := claims.ExpiresAt.Sub(r.now())
+	if ttl <= 0 {
+		return nil
+	}
+	if !r.rdb.IsOk() {
+		return r.rdb.Error()
+	}
+	if err := r.rdb.SetEx(ctx, denyKey(claims.ID), 1, ttl); err != nil {
+		r.rdb.OccurErr(err)
+		return err
+	}
+	r.local.Set(denyKey(claims.ID), true, gocache.DefaultExpiration)
+	return nil
+}
+
+// RevokeUser 吊销用户此前签发的所有 token
+func (r *Revoker) RevokeUser(ctx context.Context, userId int) error {
+	if !r.rdb.IsOk() {
+		return r.rdb.Error()
+	}
+	now := r.now()
+	if err := r.rdb.SetEx(ctx, watermarkKey(userId), now.UnixMilli(), r.watermarkTtl); err != nil {
+		r.rdb.OccurErr(err)
+		return err
+	}
+	r.local.Set(watermarkKey(userId), now.UnixMilli(), gocache.DefaultExpiration)
+	return nil
+}
+
+// revokedBefore 返回用户的吊销时间，未吊销时为 0
+func (r *Revoker) revokedBefore(ctx context.Context, userId int) (int64, error) {
+	if v, ok := r.local.Get(watermarkKey(userId)); ok {
+		return v.(int64), nil
+	}
+	if !r.rdb.IsOk() {
+		return 0, r.rdb.Error()
+	}
+	v, err := r.rdb.Get(ctx, watermarkKey(userId))
+	if err != nil && !cache.IsNotFound(err) {
+		r.rdb.OccurErr(err)
+		return 0, err
+	}
+	watermark, _ := strconv.ParseInt(v, 10, 64)
+	r.local.Set(watermarkKey(userId), watermark, gocache.DefaultExpiration)
+	return watermark, nil
+}
+
+// IsRevoked 检查 token 是否已被吊销
+func (r *Revoker) IsRevoked(ctx context.Context, claims *UserClaims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return r.IsTokenRevoked(ctx, claims.UserId, claims.ID, issuedAt)
+}
+
+// IsTokenRevoked 按 jti 和签发时间检查 token 是否已被吊销
+func (r *Revoker) IsTokenRevoked(ctx context.Context, userId int, jti string, issuedAt time.Time) (bool, error) {
+	deny, okDeny := r.local.Get(denyKey(jti))
+	watermark, okWatermark := r.local.Get(watermarkKey(userId))
+	if !okDeny || !okWatermark {
+		if !r.rdb.IsOk() {
+			return false, r.rdb.Error()
+		}
+		// 一次请求同时读取黑名单和吊销时间
+		values, err := r.rdb.Client.MGet(ctx, denyKey(jti), watermarkKey(userId)).Result()
+		if err != nil {
+			r.rdb.OccurErr(err)
+			return false, err
+		}
+		deny = values[0] != nil
+		var wm int64
+		if s, ok := values[1].(string); ok {
+			wm, _ = strconv.ParseInt(s, 10, 64)
+		}
+		watermark = wm
+		r.local.Set(denyKey(jti), deny, gocache.DefaultExpiration)
+		r.local.Set(watermarkKey(userId), wm, gocache.DefaultExpiration)
+	}
+	if deny.(bool) {
+		return true, nil
+	}
+	return issuedBefore(issuedAt, watermark.(int64)), nil
+}
+
+func issuedBefore(iat time.Time, watermark int64) bool {
+	if watermark == 0 {
+		return false
+	}
+	// iat 只精确到秒，吊销时间也按秒比较：与吊销同一秒签发的 token 视为吊销后签发，
+	// 否则吊销后立即重新登录得到的 token 也会失效
+	return iat.IsZero() || iat.Unix() < watermark/1000
+}
@@ -0,0 +1,128 @@
+package jwt
+
+import (
+	"context"
+	"service_template/pkg/cache"
+	"testing"
+	"time"
+)
+
+func newTestRevoker(t *testing.T) (*Revoker, *Manager) {
+	rdb, err := cache.NewRedis(cache.Option{
+		Host: "192.168.92.153",
+		Port: 6379,
+	})
+	if err != nil {
+		t.Skipf("redis unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = rdb.Close()
+	})
+	m, err := NewManager(Option{Keys: []KeyOption{{Kid: "hs", Algorithm: HS256, Secret: testSecret}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRevoker(rdb.(*cache.Redis), m), m
+}
+
+func TestIssuedBefore(t *testing.T) {
+	iat := time.Unix(1000, 0)
+	if issuedBefore(iat, 0) {
+		t.Fatal("token revoked without watermark")
+	}
+	if !issuedBefore(iat, 1001000) {
+		t.Fatal("token issued before watermark not revoked")
+	}
+	if issuedBefore(iat, 1000500) {
+		t.Fatal("token issued in the same second as watermark revoked")
+	}
+	if issuedBefore(iat, 999999) {
+		t.Fatal("token issued after watermark revoked")
+	}
+}
+
+func TestIssuedAfterRevokeUser(t *testing.T) {
+	m, err := NewManager(Option{Keys: []KeyOption{{Kid: "hs", Algorithm: HS256, Secret: testSecret}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 300*int64(time.Millisecond))
+	m.now = func() time.Time { return now }
+	r := NewRevoker(&cache.Redis{}, m)
+	// 吊销后同一秒内重新登录
+	r.local.SetDefault(watermarkKey(1), now.UnixMilli())
+	now = now.Add(200 * time.Millisecond)
+	token, _ := m.NewToken(1)
+	claims, err := m.Parse(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.local.SetDefault(denyKey(claims.ID), false)
+	if revoked, err := r.IsRevoked(context.Background(), claims); err != nil || revoked {
+		t.Fatalf("token issued right after revoke is revoked, err: %v", err)
+	}
+}
+
+func TestRevokerRedisDown(t *testing.T) {
+	m, _ := NewManager(Option{Keys: []KeyOption{{Kid: "hs", Algorithm: HS256, Secret: testSecret}}})
+	r := NewRevoker(&cache.Redis{}, m)
+	token, _ := m.NewToken(1)
+	claims, _ := m.Parse(token)
+	if revoked, _ := r.IsRevoked(context.Background(), claims); revoked {
+		t.Fatal("token revoked while redis is down")
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	r, m := newTestRevoker(t)
+	ctx := context.Background()
+	a, _ := m.NewToken(1)
+	b, _ := m.NewToken(1)
+	ca, _ := m.Parse(a)
+	cb, _ := m.Parse(b)
+	if revoked, err := r.IsRevoked(ctx, ca); err != nil || revoked {
+		t.Fatalf("unexpected revoked %v, err: %v", revoked, err)
+	}
+	if err := r.RevokeToken(ctx, ca); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := r.IsRevoked(ctx, ca); !revoked {
+		t.Fatal("revoked token still valid")
+	}
+	if revoked, _ := r.IsRevoked(ctx, cb); revoked {
+		t.Fatal("other token revoked")
+	}
+	// 其他实例在本地缓存过期后可见
+	other := NewRevoker(r.rdb, m)
+	if revoked, _ := other.IsRevoked(ctx, ca); !revoked {
+		t.Fatal("revocation not visible to other instances")
+	}
+}
+
+func TestRevokeUser(t *testing.T) {
+	r, m := newTestRevoker(t)
+	ctx := context.Background()
+	userId := int(time.Now().UnixNano() % 1000000)
+	old, _ := m.NewToken(userId)
+	claims, _ := m.Parse(old)
+	refresher := NewRefresher(m, newMemoryRefreshStore(), r, nil)
+	pair, _ := refresher.Issue(ctx, userId)
+	if err := r.RevokeUser(ctx, userId); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := r.IsRevoked(ctx, claims); !revoked {
+		t.Fatal("token issued before logout everywhere still valid")
+	}
+	if _, err := refresher.Refresh(ctx, pair.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Fatalf("expect ErrInvalidRefreshToken, got %v", err)
+	}
+	// 之后签发的 token 不受影响
+	m.now = func() time.Time {
+		return time.Now().Add(time.Second)
+	}
+	fresh, _ := m.NewToken(userId)
+	claims, _ = m.Parse(fresh)
+	if revoked, _ := r.IsRevoked(ctx, claims); revoked {
+		t.Fatal("token issued after logout everywhere revoked")
+	}
+}
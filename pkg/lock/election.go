@@ -0,0 +1,240 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 仅当 value 与自身标识一致时续约
+	renewScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1]
+then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+	// 仅当 value 与自身标识一致时删除
+	releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1]
+then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+type ElectionOption struct {
+	Enable   bool   `json:"enable" yaml:"enable"`
+	Key      string `json:"key" yaml:"key"`
+	Identity string `json:"identity" yaml:"identity"`
+	// 租约时长，单位秒
+	Ttl int `json:"ttl" yaml:"ttl"`
+}
+
+type ElectionCallbacks struct {
+	// 当选后在独立协程中调用，失去领导权时 ctx 会被取消
+	OnElected func(ctx context.Context)
+	// 失去领导权时同步调用，应尽快返回
+	OnRevoked func()
+}
+
+type LeaderElection struct {
+	rdb       *cache.Redis
+	key       string
+	identity  string
+	ttl       time.Duration
+	callbacks ElectionCallbacks
+
+	m         sync.Mutex
+	isLeader  atomic.Bool
+	renewedAt time.Time
+	cancel    context.CancelFunc
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewLeaderElection(rdb *cache.Redis, opt ElectionOption, callbacks ElectionCallbacks) *LeaderElection {
+	if opt.Key == "" {
+		opt.Key = "leader_election"
+	}
+	if opt.Identity == "" {
+		hostname, _ := os.Hostname()
+		opt.Identity = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if opt.Ttl <= 0 {
+		opt.Ttl = 15
+	}
+	return &LeaderElection{
+		rdb:       rdb,
+		key:       opt.Key,
+		identity:  opt.Identity,
+		ttl:       time.Duration(opt.Ttl) * time.Second,
+		callbacks: callbacks,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 开始竞选，租约以 ttl/3 的间隔续约
+func (e *LeaderElection) Start() {
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		e.tick()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				e.tick()
+			}
+		}
+	}()
+}
+
+func (e *LeaderElection) IsLeader() bool {
+	return e.isLeader.Load()
+}
+
+func (e *LeaderElection) Identity() string {
+	return e.identity
+}
+
+// Leader 返回当前持有租约的实例标识，没有 leader 时返回空字符串
+func (e *LeaderElection) Leader() (string, error) {
+	if e.IsLeader() {
+		return e.identity, nil
+	}
+	if !e.rdb.IsOk() {
+		return "", redisError(e.rdb)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	leader, err := e.rdb.Get(ctx, e.key)
+	if err != nil {
+		if cache.IsNotFound(err) {
+			return "", nil
+		}
+		e.rdb.OccurErr(err)
+		return "", err
+	}
+	return leader, nil
+}
+
+// Resign 停止竞选并主动释放租约，用于优雅退出
+func (e *LeaderElection) Resign(ctx context.Context) error {
+	e.once.Do(func() {
+		close(e.stop)
+	})
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if !e.IsLeader() {
+		return nil
+	}
+	e.revoke()
+	if !e.rdb.IsOk() {
+		return redisError(e.rdb)
+	}
+	err := e.rdb.Eval(ctx, releaseScript, []string{e.key}, e.identity).Err()
+	if err != nil {
+		e.rdb.OccurErr(err)
+	}
+	return err
+}
+
+func (e *LeaderElection) tick() {
+	if !e.rdb.IsOk() {
+		e.revoke()
+		return
+	}
+	if e.IsLeader() {
+		e.renew()
+		return
+	}
+	e.campaign()
+}
+
+func (e *LeaderElection) campaign() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ok, err := e.rdb.SetNX(ctx, e.key, e.identity, e.ttl)
+	if err != nil {
+		e.rdb.OccurErr(err)
+		return
+	}
+	if ok {
+		e.elect()
+	}
+}
+
+func (e *LeaderElection) renew() {
+	// 续约长时间未成功时，租约可能已被他人持有
+	e.m.Lock()
+	expired := time.Since(e.renewedAt) >= e.ttl
+	e.m.Unlock()
+	if expired {
+		e.revoke()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ok, err := e.rdb.Eval(ctx, renewScript, []string{e.key}, e.identity, e.ttl.Milliseconds()).Int64()
+	if err != nil {
+		e.rdb.OccurErr(err)
+		e.revoke()
+		return
+	}
+	if ok == 0 {
+		e.revoke()
+		return
+	}
+	e.m.Lock()
+	e.renewedAt = time.Now()
+	e.m.Unlock()
+}
+
+func (e *LeaderElection) elect() {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.renewedAt = time.Now()
+	if e.isLeader.Load() {
+		return
+	}
+	e.isLeader.Store(true)
+	logger.Infof("leader election: %s elected as leader of %s", e.identity, e.key)
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	if e.callbacks.OnElected != nil {
+		go e.callbacks.OnElected(ctx)
+	}
+}
+
+func (e *LeaderElection) revoke() {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if !e.isLeader.Load() {
+		return
+	}
+	e.isLeader.Store(false)
+	logger.Warnf("leader election: %s lost leadership of %s", e.identity, e.key)
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	if e.callbacks.OnRevoked != nil {
+		e.callbacks.OnRevoked()
+	}
+}
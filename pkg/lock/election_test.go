@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"context"
+	"service_template/pkg/cache"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) *cache.Redis {
+	rdb, err := cache.NewRedis(cache.Option{
+		Host: "192.168.92.142",
+		Port: 6379,
+	})
+	if err != nil {
+		t.Skipf("redis unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = rdb.Close()
+	})
+	return rdb.(*cache.Redis)
+}
+
+func TestLeaderElectionRedisDown(t *testing.T) {
+	elected := false
+	e := NewLeaderElection(&cache.Redis{}, ElectionOption{Key: "test_election", Ttl: 3}, ElectionCallbacks{
+		OnElected: func(ctx context.Context) {
+			elected = true
+		},
+	})
+	e.Start()
+	time.Sleep(100 * time.Millisecond)
+	if e.IsLeader() || elected {
+		t.Fatal("elected without redis")
+	}
+	if err := e.Resign(context.Background()); err != nil {
+		t.Fatalf("resign failed: %v", err)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	rdb := newTestRedis(t)
+	electedCh := make(chan struct{}, 1)
+	revokedCh := make(chan struct{}, 1)
+	e1 := NewLeaderElection(rdb, ElectionOption{Key: "test_election", Identity: "e1", Ttl: 3}, ElectionCallbacks{
+		OnElected: func(ctx context.Context) {
+			electedCh <- struct{}{}
+		},
+		OnRevoked: func() {
+			revokedCh <- struct{}{}
+		},
+	})
+	e1.Start()
+	select {
+	case <-electedCh:
+	case <-time.After(3 * time.Second):
+		t.Fatal("e1 not elected")
+	}
+
+	e2 := NewLeaderElection(rdb, ElectionOption{Key: "test_election", Identity: "e2", Ttl: 3}, ElectionCallbacks{})
+	e2.Start()
+	time.Sleep(5 * time.Second)
+	if e2.IsLeader() {
+		t.Fatal("two leaders at the same time")
+	}
+	leader, err := e2.Leader()
+	if err != nil || leader != "e1" {
+		t.Fatalf("unexpected leader %q, err: %v", leader, err)
+	}
+
+	if err := e1.Resign(context.Background()); err != nil {
+		t.Fatalf("resign failed: %v", err)
+	}
+	select {
+	case <-revokedCh:
+	default:
+		t.Fatal("OnRevoked not called after resign")
+	}
+	time.Sleep(2 * time.Second)
+	if !e2.IsLeader() {
+		t.Fatal("e2 not elected after e1 resigned")
+	}
+	_ = e2.Resign(context.Background())
+}
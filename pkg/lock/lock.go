@@ -2,21 +2,141 @@ package lock
 
 import (
 	"context"
+	"errors"
 	"service_template/pkg/cache"
+	"service_template/pkg/logger"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	LockTypeLocal       = "local"
+	LockTypeRedis       = "redis"
+	LockTypeCombination = "combination"
+	LockTypeRedLock     = "redlock"
+)
+
+type Option struct {
+	Type string `json:"type" yaml:"type"`
+	// 锁过期时间，单位秒
+	Ttl int `json:"ttl" yaml:"ttl"`
+	// redlock 使用的独立 Redis 节点
+	Nodes []cache.Option `json:"nodes" yaml:"nodes"`
+	// combination 锁在 Redis 不可用时的降级策略
+	Degrade  DegradePolicy `json:"degrade" yaml:"degrade"`
+	Listener EventListener `json:"-" yaml:"-"`
+}
+
+func NewLock(opt Option, rdb *cache.Redis) (Lock, error) {
+	if opt.Ttl <= 0 {
+		opt.Ttl = 30
+	}
+	switch opt.Type {
+	case LockTypeLocal:
+		return NewLocalLock(), nil
+	case LockTypeRedis:
+		return NewRedisLock(rdb, opt.Ttl), nil
+	case LockTypeCombination, "":
+		return NewCombinationLockWithPolicy(rdb, opt.Ttl, opt.Degrade, opt.Listener), nil
+	case LockTypeRedLock:
+		if len(opt.Nodes) < 3 {
+			return nil, errors.New("redlock needs at least 3 nodes")
+		}
+		nodes := make([]*cache.Redis, 0, len(opt.Nodes))
+		for _, nodeOpt := range opt.Nodes {
+			node, err := cache.NewRedis(nodeOpt)
+			if err != nil {
+				for _, n := range nodes {
+					_ = n.Close()
+				}
+				return nil, err
+			}
+			nodes = append(nodes, node.(*cache.Redis))
+		}
+		return NewRedLock(nodes, opt.Ttl), nil
+	default:
+		return nil, errors.New("unsupported lock type")
+	}
+}
+
 type Lock interface {
 	TryLock(key string) (bool, *LockEntry, error)
 	UnLock(*LockEntry) error
 }
 
+// Backend 授予锁的后端
+type Backend int
+
+const (
+	BackendLocal Backend = iota + 1
+	BackendRedis
+	BackendRedLock
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendLocal:
+		return "local"
+	case BackendRedis:
+		return "redis"
+	case BackendRedLock:
+		return "redlock"
+	default:
+		return "unknown"
+	}
+}
+
 type LockEntry struct {
+	m         sync.Mutex
 	timer     *time.Timer
 	done      bool
 	key       string
+	value     string
+	backend   Backend
 	expiredAt time.Time
+	lost      chan struct{}
+}
+
+func (e *LockEntry) Key() string {
+	return e.key
+}
+
+func (e *LockEntry) Backend() Backend {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.backend
+}
+
+// Lost 锁已丢失时关闭，如 redlock 续约失败、combination 锁重新写入 Redis 时已被其他实例持有，
+// 持有者应停止访问受保护的资源
+func (e *LockEntry) Lost() <-chan struct{} {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.lost == nil {
+		e.lost = make(chan struct{})
+	}
+	return e.lost
+}
+
+func (e *LockEntry) lose() {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.lost == nil {
+		e.lost = make(chan struct{})
+	}
+	select {
+	case <-e.lost:
+	default:
+		close(e.lost)
+	}
+}
+
+func redisError(rdb *cache.Redis) error {
+	if err := rdb.Error(); err != nil {
+		return err
+	}
+	return errors.New("redis unavailable")
 }
 
 func NewLocalLock() Lock {
@@ -31,7 +151,7 @@ type localLock struct {
 
 func (l *localLock) TryLock(key string) (bool, *LockEntry, error) {
 	_, loaded := l.entries.LoadOrStore(key, struct{}{})
-	return !loaded, &LockEntry{key: key}, nil
+	return !loaded, &LockEntry{key: key, backend: BackendLocal}, nil
 }
 
 func (l *localLock) UnLock(entry *LockEntry) error {
@@ -42,7 +162,22 @@ func (l *localLock) UnLock(entry *LockEntry) error {
 	return nil
 }
 
+// lock 以 entry 为持有者加锁
+func (l *localLock) lock(entry *LockEntry) bool {
+	_, loaded := l.entries.LoadOrStore(entry.key, entry)
+	return !loaded
+}
+
+// unlock 只释放 entry 自己持有的锁
+func (l *localLock) unlock(entry *LockEntry) {
+	l.entries.CompareAndDelete(entry.key, entry)
+}
+
 func NewRedisLock(rdb *cache.Redis, defaultTtl int) Lock {
+	return newRedisLock(rdb, defaultTtl)
+}
+
+func newRedisLock(rdb *cache.Redis, defaultTtl int) *redisLock {
 	if defaultTtl <= 0 {
 		panic("lock ttl must be positive")
 	}
@@ -146,25 +281,35 @@ func (r *redisLock) renewLock() {
 }
 
 func (r *redisLock) TryLock(key string) (bool, *LockEntry, error) {
+	entry := &LockEntry{key: key}
+	ok, err := r.acquire(entry)
+	if !ok {
+		return false, nil, err
+	}
+	return true, entry, nil
+}
+
+// acquire 在 Redis 中为 entry 加锁并开始续约
+func (r *redisLock) acquire(entry *LockEntry) (bool, error) {
 	if !r.IsOk() {
-		return false, nil, r.Error()
+		return false, redisError(r.Redis)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	ok, err := r.SetNX(ctx, key, "", time.Duration(r.ttl)*time.Second).Result()
+	ok, err := r.SetNX(ctx, entry.key, "", time.Duration(r.ttl)*time.Second)
 	if err != nil {
 		r.OccurErr(err)
-		return false, nil, err
+		return false, err
 	}
 	if !ok {
-		return false, nil, nil
-	}
-	entry := &LockEntry{
-		key:       key,
-		expiredAt: time.Now().Add(time.Second * time.Duration(r.ttl/2)),
+		return false, nil
 	}
+	entry.m.Lock()
+	entry.backend = BackendRedis
+	entry.expiredAt = time.Now().Add(time.Second * time.Duration(r.ttl/2))
+	entry.m.Unlock()
 	r.renewCh <- entry
-	return true, entry, nil
+	return true, nil
 }
 
 func (r *redisLock) UnLock(entry *LockEntry) error {
@@ -187,43 +332,187 @@ func (r *redisLock) UnLock(entry *LockEntry) error {
 	return err
 }
 
+// DegradePolicy Redis 不可用时 combination 锁的处理策略
+type DegradePolicy string
+
+const (
+	// DegradeFailClosed 直接返回错误，不授予锁
+	DegradeFailClosed DegradePolicy = "fail_closed"
+	// DegradeLocal 降级为进程内锁，互斥范围仅限本实例
+	DegradeLocal DegradePolicy = "local"
+	// DegradeReconcile 降级为进程内锁，Redis 恢复后将仍持有的锁重新写入 Redis，已被其他实例持有时关闭 LockEntry.Lost
+	DegradeReconcile DegradePolicy = "reconcile"
+)
+
+type EventType string
+
+const (
+	// EventDegraded Redis 不可用，互斥范围退化为单实例
+	EventDegraded EventType = "degraded"
+	// EventLocalGranted 锁由本地后端授予
+	EventLocalGranted EventType = "local_granted"
+	// EventRejected fail_closed 策略下拒绝加锁
+	EventRejected EventType = "rejected"
+	// EventReconciled 本地持有的锁已重新写入 Redis
+	EventReconciled EventType = "reconciled"
+	// EventConflict 重新写入 Redis 时发现锁已被其他实例持有，本地的锁作废并关闭 LockEntry.Lost
+	EventConflict EventType = "conflict"
+	// EventRecovered Redis 恢复，重新由 Redis 授予锁
+	EventRecovered EventType = "recovered"
+)
+
+type Event struct {
+	Type EventType
+	Key  string
+	Err  error
+	Time time.Time
+}
+
+type EventListener func(Event)
+
 func NewCombinationLock(rdb *cache.Redis, defaultTtl int) Lock {
+	return NewCombinationLockWithPolicy(rdb, defaultTtl, DegradeLocal, nil)
+}
+
+func NewCombinationLockWithPolicy(rdb *cache.Redis, defaultTtl int, policy DegradePolicy, listener EventListener) Lock {
+	if policy == "" {
+		policy = DegradeLocal
+	}
 	return &combinationLock{
 		rdb:       rdb,
-		redisLock: NewRedisLock(rdb, defaultTtl),
-		localLock: NewLocalLock(),
+		redisLock: newRedisLock(rdb, defaultTtl),
+		localLock: &localLock{},
+		policy:    policy,
+		listener:  listener,
+		pending:   make(map[*LockEntry]struct{}),
 	}
 }
 
 type combinationLock struct {
 	rdb       *cache.Redis
-	redisLock Lock
-	localLock Lock
+	redisLock *redisLock
+	localLock *localLock
+	policy    DegradePolicy
+	listener  EventListener
+	degraded  atomic.Bool
+
+	m           sync.Mutex
+	pending     map[*LockEntry]struct{}
+	reconciling bool
 }
 
+// TryLock 先在本地加锁再向 Redis 申请，本实例持有的锁（包括降级期间授予、尚未写入 Redis 的锁）不会再由 Redis 授予
 func (c *combinationLock) TryLock(key string) (bool, *LockEntry, error) {
-	ok, entry, err := c.redisLock.TryLock(key)
-	if err != nil {
-		return c.localLock.TryLock(key)
+	entry := &LockEntry{key: key}
+	if !c.localLock.lock(entry) {
+		return false, nil, nil
+	}
+	ok, err := c.redisLock.acquire(entry)
+	if err == nil {
+		if c.degraded.CompareAndSwap(true, false) {
+			logger.Infof("combination lock: redis recovered, locks are granted by redis again")
+			c.emit(EventRecovered, key, nil)
+		}
+		if !ok {
+			c.localLock.unlock(entry)
+			return false, nil, nil
+		}
+		return true, entry, nil
+	}
+	if c.degraded.CompareAndSwap(false, true) {
+		logger.Warnf("combination lock: redis unavailable (%v), policy: %s, mutual exclusion is per-node now", err, c.policy)
+		c.emit(EventDegraded, key, err)
 	}
-	return ok, entry, nil
+	if c.policy == DegradeFailClosed {
+		c.localLock.unlock(entry)
+		c.emit(EventRejected, key, err)
+		return false, nil, err
+	}
+	entry.m.Lock()
+	entry.backend = BackendLocal
+	entry.m.Unlock()
+	c.emit(EventLocalGranted, key, err)
+	if c.policy == DegradeReconcile {
+		c.m.Lock()
+		c.pending[entry] = struct{}{}
+		if !c.reconciling {
+			c.reconciling = true
+			go c.reconcile()
+		}
+		c.m.Unlock()
+	}
+	return true, entry, nil
 }
 
 func (c *combinationLock) UnLock(entry *LockEntry) error {
 	if entry == nil {
 		return nil
 	}
-	if c.rdb.IsOk() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		i, err := c.rdb.Del(ctx, entry.key)
-		if i != 0 {
-			return nil
+	var err error
+	if entry.Backend() == BackendRedis {
+		err = c.redisLock.UnLock(entry)
+	}
+	c.m.Lock()
+	delete(c.pending, entry)
+	c.m.Unlock()
+	c.localLock.unlock(entry)
+	return err
+}
+
+// reconcile 等待 Redis 恢复后，将本地授予且未释放的锁写入 Redis
+func (c *combinationLock) reconcile() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !c.rdb.IsOk() {
+			continue
+		}
+		c.m.Lock()
+		entries := make([]*LockEntry, 0, len(c.pending))
+		for e := range c.pending {
+			entries = append(entries, e)
+		}
+		c.m.Unlock()
+		for _, e := range entries {
+			c.reconcileEntry(e)
 		}
-		if err != nil {
-			c.rdb.OccurErr(err)
+		c.m.Lock()
+		if len(c.pending) == 0 {
+			c.reconciling = false
+			c.m.Unlock()
+			return
 		}
+		c.m.Unlock()
 	}
-	_ = c.localLock.UnLock(entry)
-	return nil
+}
+
+func (c *combinationLock) reconcileEntry(e *LockEntry) {
+	// 持有 c.m 期间完成迁移，避免与 UnLock 并发
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.pending[e]; !ok {
+		return
+	}
+	ok, err := c.redisLock.acquire(e)
+	if err != nil {
+		return
+	}
+	delete(c.pending, e)
+	if !ok {
+		// 本地的锁作废，通过 Lost 通知持有者
+		c.localLock.unlock(e)
+		e.lose()
+		logger.Errorf("combination lock: %s is held by another instance after redis recovered, mutual exclusion was violated, the local lock is cancelled", e.key)
+		c.emit(EventConflict, e.key, nil)
+		return
+	}
+	logger.Infof("combination lock: %s reconciled to redis", e.key)
+	c.emit(EventReconciled, e.key, nil)
+}
+
+func (c *combinationLock) emit(t EventType, key string, err error) {
+	if c.listener == nil {
+		return
+	}
+	c.listener(Event{Type: t, Key: key, Err: err, Time: time.Now()})
 }
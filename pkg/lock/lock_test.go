@@ -1,6 +1,7 @@
 package lock
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"service_template/pkg/cache"
@@ -126,3 +127,129 @@ func TestRedisLock(t *testing.T) {
 		t.Fatal("解锁失败")
 	}
 }
+
+func TestCombinationLockFailClosed(t *testing.T) {
+	var events []EventType
+	lock := NewCombinationLockWithPolicy(&cache.Redis{}, 10, DegradeFailClosed, func(e Event) {
+		events = append(events, e.Type)
+	})
+	ok, entry, err := lock.TryLock("test")
+	if ok || entry != nil || err == nil {
+		t.Fatal("fail closed lock granted without redis")
+	}
+	if len(events) != 2 || events[0] != EventDegraded || events[1] != EventRejected {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
+
+func TestCombinationLockDegradeLocal(t *testing.T) {
+	var events []EventType
+	lock := NewCombinationLockWithPolicy(&cache.Redis{}, 10, DegradeLocal, func(e Event) {
+		events = append(events, e.Type)
+	})
+	ok, entry, err := lock.TryLock("test")
+	if !ok || err != nil {
+		t.Fatalf("degrade lock failed, error: %v", err)
+	}
+	if entry.Backend() != BackendLocal {
+		t.Fatalf("unexpected backend: %s", entry.Backend())
+	}
+	ok2, _, _ := lock.TryLock("test")
+	if ok2 {
+		t.Fatal("get the same lock")
+	}
+	_ = lock.UnLock(entry)
+	ok3, _, _ := lock.TryLock("test")
+	if !ok3 {
+		t.Fatal("can't lock after unlock")
+	}
+	if events[0] != EventDegraded || events[1] != EventLocalGranted {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	for _, e := range events[2:] {
+		if e == EventDegraded {
+			t.Fatal("degraded event emitted more than once")
+		}
+	}
+}
+
+func TestCombinationLockReconcile(t *testing.T) {
+	rdb := newTestRedis(t)
+	reconciled := make(chan struct{}, 1)
+	lock := NewCombinationLockWithPolicy(rdb, 10, DegradeReconcile, func(e Event) {
+		if e.Type == EventReconciled {
+			reconciled <- struct{}{}
+		}
+	})
+	rdb.OccurErr(fmt.Errorf("mock error"))
+	ok, entry, err := lock.TryLock("test_reconcile")
+	if !ok {
+		t.Fatalf("degrade lock failed, error: %v", err)
+	}
+	select {
+	case <-reconciled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not reconciled after redis recovered")
+	}
+	if entry.Backend() != BackendRedis {
+		t.Fatalf("unexpected backend after reconcile: %s", entry.Backend())
+	}
+	_ = lock.UnLock(entry)
+}
+
+func TestCombinationLockLocalHeld(t *testing.T) {
+	rdb := newTestRedis(t)
+	lock := NewCombinationLockWithPolicy(rdb, 10, DegradeLocal, nil)
+	rdb.OccurErr(fmt.Errorf("mock error"))
+	ok, entry, _ := lock.TryLock("test_local_held")
+	if !ok || entry.Backend() != BackendLocal {
+		t.Fatal("degrade lock failed")
+	}
+	for !rdb.IsOk() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	// Redis 恢复后，本地仍持有的锁不能再由 Redis 授予
+	ok2, _, _ := lock.TryLock("test_local_held")
+	if ok2 {
+		t.Fatal("get the same lock from redis while held locally")
+	}
+	_ = lock.UnLock(entry)
+	ok3, entry3, err := lock.TryLock("test_local_held")
+	if !ok3 || entry3.Backend() != BackendRedis {
+		t.Fatalf("can't lock after unlock, error: %v", err)
+	}
+	_ = lock.UnLock(entry3)
+}
+
+func TestCombinationLockConflict(t *testing.T) {
+	rdb := newTestRedis(t)
+	conflict := make(chan struct{}, 1)
+	lock := NewCombinationLockWithPolicy(rdb, 10, DegradeReconcile, func(e Event) {
+		if e.Type == EventConflict {
+			conflict <- struct{}{}
+		}
+	})
+	rdb.OccurErr(fmt.Errorf("mock error"))
+	ok, entry, err := lock.TryLock("test_conflict")
+	if !ok {
+		t.Fatalf("degrade lock failed, error: %v", err)
+	}
+	// 降级期间其他实例在 Redis 中持有了同一个锁
+	rdb.Client.Set(context.Background(), "test_conflict", "", 10*time.Second)
+	defer rdb.Client.Del(context.Background(), "test_conflict")
+	select {
+	case <-entry.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("conflicting lock not cancelled after redis recovered")
+	}
+	<-conflict
+	ok2, _, _ := lock.TryLock("test_conflict")
+	if ok2 {
+		t.Fatal("get the lock held by another instance")
+	}
+	// 作废的锁释放时不影响其他持有者
+	_ = lock.UnLock(entry)
+	if n, _ := rdb.Client.Exists(context.Background(), "test_conflict").Result(); n != 1 {
+		t.Fatal("lock of another instance released")
+	}
+}
@@ -0,0 +1,182 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"sync"
+	"time"
+)
+
+// 时钟漂移系数，参考 Redlock 算法
+const clockDriftFactor = 0.01
+
+func NewRedLock(nodes []*cache.Redis, defaultTtl int) Lock {
+	if defaultTtl <= 0 {
+		panic("lock ttl must be positive")
+	}
+	if len(nodes) == 0 {
+		panic("redlock needs at least one node")
+	}
+	ttl := time.Duration(defaultTtl) * time.Second
+	timeout := ttl / 10
+	if timeout > 2*time.Second {
+		timeout = 2 * time.Second
+	}
+	return &redLock{
+		nodes:   nodes,
+		ttl:     ttl,
+		quorum:  quorum(len(nodes)),
+		timeout: timeout,
+	}
+}
+
+// redLock 在 N 个相互独立的 Redis 节点上获取多数派锁
+type redLock struct {
+	nodes   []*cache.Redis
+	ttl     time.Duration
+	quorum  int
+	timeout time.Duration
+}
+
+func quorum(n int) int {
+	return n/2 + 1
+}
+
+// validity 锁的剩余有效时间，扣除获取耗时及时钟漂移
+func validity(ttl, elapsed time.Duration) time.Duration {
+	drift := time.Duration(float64(ttl)*clockDriftFactor) + 2*time.Millisecond
+	return ttl - elapsed - drift
+}
+
+func (r *redLock) TryLock(key string) (bool, *LockEntry, error) {
+	value, err := randomValue()
+	if err != nil {
+		return false, nil, err
+	}
+	start := time.Now()
+	acquired, failed := r.eachNode(func(ctx context.Context, node *cache.Redis) (bool, error) {
+		return node.SetNX(ctx, key, value, r.ttl)
+	})
+	valid := validity(r.ttl, time.Since(start))
+	if acquired >= r.quorum && valid > 0 {
+		entry := &LockEntry{
+			key:       key,
+			value:     value,
+			backend:   BackendRedLock,
+			expiredAt: start.Add(valid),
+		}
+		r.scheduleRenew(entry, valid/2)
+		return true, entry, nil
+	}
+	r.release(key, value)
+	if len(failed) > len(r.nodes)-r.quorum {
+		return false, nil, errors.Join(failed...)
+	}
+	return false, nil, nil
+}
+
+func (r *redLock) UnLock(entry *LockEntry) error {
+	if entry == nil {
+		return nil
+	}
+	entry.m.Lock()
+	entry.done = true
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	entry.m.Unlock()
+	failed := r.release(entry.key, entry.value)
+	if len(failed) > len(r.nodes)-r.quorum {
+		return errors.Join(failed...)
+	}
+	return nil
+}
+
+// release 在所有节点上释放锁，包括获取失败的节点
+func (r *redLock) release(key, value string) []error {
+	_, failed := r.eachNode(func(ctx context.Context, node *cache.Redis) (bool, error) {
+		n, err := node.Eval(ctx, releaseScript, []string{key}, value).Int64()
+		return n > 0, err
+	})
+	return failed
+}
+
+func (r *redLock) scheduleRenew(entry *LockEntry, after time.Duration) {
+	entry.m.Lock()
+	defer entry.m.Unlock()
+	if entry.done {
+		return
+	}
+	entry.timer = time.AfterFunc(after, func() {
+		entry.m.Lock()
+		done := entry.done
+		entry.m.Unlock()
+		if done {
+			return
+		}
+		start := time.Now()
+		renewed, _ := r.eachNode(func(ctx context.Context, node *cache.Redis) (bool, error) {
+			n, err := node.Eval(ctx, renewScript, []string{entry.key}, entry.value, r.ttl.Milliseconds()).Int64()
+			return n > 0, err
+		})
+		valid := validity(r.ttl, time.Since(start))
+		if renewed < r.quorum || valid <= 0 {
+			logger.Warnf("redlock: renew %s failed on majority of nodes, lock lost", entry.key)
+			entry.lose()
+			return
+		}
+		entry.m.Lock()
+		entry.expiredAt = start.Add(valid)
+		entry.m.Unlock()
+		r.scheduleRenew(entry, valid/2)
+	})
+}
+
+// eachNode 并发地在每个节点上执行 fn，返回成功的节点数及失败原因
+func (r *redLock) eachNode(fn func(ctx context.Context, node *cache.Redis) (bool, error)) (int, []error) {
+	var (
+		wg     sync.WaitGroup
+		m      sync.Mutex
+		ok     int
+		failed []error
+	)
+	for _, node := range r.nodes {
+		wg.Add(1)
+		go func(node *cache.Redis) {
+			defer wg.Done()
+			if !node.IsOk() {
+				m.Lock()
+				failed = append(failed, redisError(node))
+				m.Unlock()
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			defer cancel()
+			success, err := fn(ctx, node)
+			if err != nil {
+				node.OccurErr(err)
+			}
+			m.Lock()
+			if err != nil {
+				failed = append(failed, err)
+			} else if success {
+				ok++
+			}
+			m.Unlock()
+		}(node)
+	}
+	wg.Wait()
+	return ok, failed
+}
+
+func randomValue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
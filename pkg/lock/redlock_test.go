@@ -0,0 +1,76 @@
+package lock
+
+import (
+	"service_template/pkg/cache"
+	"testing"
+	"time"
+)
+
+func TestQuorum(t *testing.T) {
+	cases := map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 3}
+	for n, want := range cases {
+		if got := quorum(n); got != want {
+			t.Fatalf("quorum(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestValidity(t *testing.T) {
+	ttl := 10 * time.Second
+	if got := validity(ttl, time.Second); got != 10*time.Second-time.Second-100*time.Millisecond-2*time.Millisecond {
+		t.Fatalf("unexpected validity %v", got)
+	}
+	if got := validity(ttl, ttl); got > 0 {
+		t.Fatalf("validity should be negative when acquiring takes the whole ttl, got %v", got)
+	}
+}
+
+func TestRedLockNodesDown(t *testing.T) {
+	l := NewRedLock([]*cache.Redis{{}, {}, {}}, 10)
+	ok, entry, err := l.TryLock("test")
+	if ok || entry != nil {
+		t.Fatal("locked without any available node")
+	}
+	if err == nil {
+		t.Fatal("expected error when majority of nodes are down")
+	}
+}
+
+func TestRedLockRenewFailed(t *testing.T) {
+	l := NewRedLock([]*cache.Redis{{}, {}, {}}, 10).(*redLock)
+	entry := &LockEntry{key: "test", value: "value", backend: BackendRedLock}
+	// 多数节点续约失败时通知持有者
+	l.scheduleRenew(entry, 0)
+	select {
+	case <-entry.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost not closed after renew failed")
+	}
+}
+
+func TestRedLock(t *testing.T) {
+	rdb := newTestRedis(t)
+	l := NewRedLock([]*cache.Redis{rdb}, 2)
+	ok, entry, err := l.TryLock("test_redlock")
+	if !ok {
+		t.Fatalf("lock failed, error: %v", err)
+	}
+	ok2, _, _ := l.TryLock("test_redlock")
+	if ok2 {
+		t.Fatal("get the same lock")
+	}
+	// 超过 ttl 后仍被续约持有
+	time.Sleep(3 * time.Second)
+	ok3, _, _ := l.TryLock("test_redlock")
+	if ok3 {
+		t.Fatal("lock not renewed")
+	}
+	if err := l.UnLock(entry); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	ok4, entry2, _ := l.TryLock("test_redlock")
+	if !ok4 {
+		t.Fatal("can't lock after unlock")
+	}
+	_ = l.UnLock(entry2)
+}
@@ -1,8 +1,10 @@
 package logger
 
 import (
+	"context"
 	"io"
 	"os"
+	"service_template/pkg/requestid"
 	"time"
 
 	"go.uber.org/zap"
@@ -56,6 +58,11 @@ func Fatalf(msg string, args ...interface{}) {
 	logger.Fatalf(msg, args)
 }
 
+// WithContext 返回附带 ctx 中请求 ID 的 logger
+func WithContext(ctx context.Context) *Logger {
+	return logger.WithContext(ctx)
+}
+
 type Option struct {
 	Lumberjack LumberjackOption `json:"lumberjack" yaml:"lumberjack"`
 	Output     []io.Writer
@@ -73,6 +80,8 @@ type LumberjackOption struct {
 type Logger struct {
 	*zap.SugaredLogger
 	output io.Writer
+	// 直接调用方法时使用，不跳过包级函数的调用栈
+	direct *zap.SugaredLogger
 }
 
 func InitLogger(opt Option) *Logger {
@@ -100,10 +109,20 @@ func InitLogger(opt Option) *Logger {
 	logger = &Logger{
 		output:        zapcore.NewMultiWriteSyncer(syncers...),
 		SugaredLogger: zapLogger.Sugar(),
+		direct:        zapLogger.WithOptions(zap.AddCallerSkip(-1)).Sugar(),
 	}
 	return logger
 }
 
+// WithContext 返回附带 request_id 字段的 logger，ctx 中没有请求 ID 时不附带
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	direct := l.direct
+	if id := requestid.FromContext(ctx); id != "" {
+		direct = direct.With("request_id", id)
+	}
+	return &Logger{SugaredLogger: direct, output: l.output, direct: direct}
+}
+
 func (l *Logger) GetOutput() io.Writer {
 	return l.output
 }
@@ -1,8 +1,13 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"os"
+	"service_template/pkg/requestid"
+	"strings"
 	"testing"
 )
 
@@ -23,3 +28,25 @@ func TestLogger(t *testing.T) {
 	log.Warn("this is warn")
 	log.Error("this is error")
 }
+
+func TestWithContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	InitLogger(Option{Output: []io.Writer{buf}})
+	defer InitLogger(Option{})
+
+	WithContext(requestid.NewContext(context.Background(), "abc")).Infof("with %s", "id")
+	WithContext(context.Background()).Info("without id")
+	dec := json.NewDecoder(buf)
+	for _, want := range []string{"abc", ""} {
+		entry := map[string]interface{}{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		if id, _ := entry["request_id"].(string); id != want {
+			t.Fatalf("expected request_id %q, got %v", want, entry)
+		}
+		if caller, _ := entry["caller"].(string); !strings.Contains(caller, "logger_test.go") {
+			t.Fatalf("unexpected caller %v", entry["caller"])
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"service_template/pkg/cache"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown oidc provider")
+	ErrInvalidState    = errors.New("invalid or expired oidc state")
+	ErrExchange        = errors.New("oidc code exchange failed")
+	ErrInvalidIdToken  = errors.New("invalid id token")
+)
+
+type Option struct {
+	// 授权请求的有效期，单位秒，默认 600
+	StateTtl  int              `json:"state_ttl" yaml:"state_ttl"`
+	Providers []ProviderOption `json:"providers" yaml:"providers"`
+}
+
+// State 授权请求的状态，保存在缓存中，回调时一次性取出
+type State struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// 调用方附带的数据，如关联身份时的用户 ID
+	Data string `json:"data,omitempty"`
+}
+
+// Result 回调处理结果
+type Result struct {
+	Claims *Claims
+	Token  *Token
+	// 发起授权时附带的数据
+	Data string
+}
+
+// Client 使用授权码流程和 PKCE 登录多个 OIDC 提供方
+type Client struct {
+	opt       Option
+	store     cache.Cache
+	providers map[string]*Provider
+}
+
+func NewClient(opt Option, store cache.Cache) (*Client, error) {
+	if opt.StateTtl <= 0 {
+		opt.StateTtl = 600
+	}
+	c := &Client{opt: opt, store: store, providers: make(map[string]*Provider, len(opt.Providers))}
+	for _, po := range opt.Providers {
+		if _, ok := c.providers[po.Name]; ok {
+			return nil, fmt.Errorf("duplicate oidc provider %s", po.Name)
+		}
+		p, err := NewProvider(po)
+		if err != nil {
+			return nil, err
+		}
+		c.providers[po.Name] = p
+	}
+	return c, nil
+}
+
+// Providers 返回已配置的提供方名称
+func (c *Client) Providers() []string {
+	names := make([]string, 0, len(c.providers))
+	for name := range c.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Client) provider(name string) (*Provider, error) {
+	p, ok := c.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func stateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+// AuthURL 生成 state、nonce 和 code_verifier 并保存，返回跳转到提供方的授权地址
+func (c *Client) AuthURL(ctx context.Context, provider, data string) (string, error) {
+	p, err := c.provider(provider)
+	if err != nil {
+		return "", err
+	}
+	state, err := random()
+	if err != nil {
+		return "", err
+	}
+	s := State{Provider: provider, Data: data}
+	if s.Nonce, err = random(); err != nil {
+		return "", err
+	}
+	if s.Verifier, err = random(); err != nil {
+		return "", err
+	}
+	u, err := p.AuthCodeURL(ctx, state, s.Nonce, s.Verifier)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	if err := c.store.SetEx(ctx, stateKey(state), string(b), time.Duration(c.opt.StateTtl)*time.Second); err != nil {
+		return "", err
+	}
+	return u, nil
+}
+
+// takeState 取出并删除 state，同一 state 只能使用一次
+func (c *Client) takeState(ctx context.Context, state string) (*State, error) {
+	if state == "" {
+		return nil, ErrInvalidState
+	}
+	key := stateKey(state)
+	v, err := c.store.Get(ctx, key)
+	if err != nil {
+		if cache.IsNotFound(err) {
+			return nil, ErrInvalidState
+		}
+		return nil, err
+	}
+	n, err := c.store.Del(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrInvalidState
+	}
+	s := &State{}
+	if err := json.Unmarshal([]byte(v), s); err != nil {
+		return nil, ErrInvalidState
+	}
+	return s, nil
+}
+
+// Callback 校验回调中的 state，使用授权码换取 token 并验证 ID token
+func (c *Client) Callback(ctx context.Context, provider, state, code string) (*Result, error) {
+	p, err := c.provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.takeState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if s.Provider != provider {
+		return nil, ErrInvalidState
+	}
+	token, err := p.Exchange(ctx, code, s.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.VerifyIdToken(ctx, token.IdToken, s.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Claims: claims, Token: token, Data: s.Data}, nil
+}
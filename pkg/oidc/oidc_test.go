@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"service_template/pkg/cache"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+// fakeIdP 本地的 OIDC 提供方，authorize 模拟用户在提供方完成登录后返回授权码
+type fakeIdP struct {
+	*httptest.Server
+	t      *testing.T
+	key    *ecdsa.PrivateKey
+	m      sync.Mutex
+	codes  map[string]authorization
+	claims func(c gojwt.MapClaims)
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, codes: map[string]authorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JwksUri:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "EC", "kid": "idp", "use": "sig", "alg": "ES256", "crv": "P-256",
+			"x": enc(key.X.FillBytes(make([]byte, 32))),
+			"y": enc(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) tokenError(w http.ResponseWriter, e string) {
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": e})
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+		idp.tokenError(w, "invalid_client")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != "https://app/callback" {
+		idp.tokenError(w, "invalid_request")
+		return
+	}
+	idp.m.Lock()
+	a, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.m.Unlock()
+	if !ok || codeChallenge(r.PostFormValue("code_verifier")) != a.challenge {
+		idp.tokenError(w, "invalid_grant")
+		return
+	}
+	now := time.Now()
+	claims := gojwt.MapClaims{
+		"iss":            idp.URL,
+		"aud":            "client",
+		"sub":            "user-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          a.nonce,
+		"email":          "bob@example.com",
+		"email_verified": true,
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	t := gojwt.NewWithClaims(gojwt.SigningMethodES256, claims)
+	t.Header["kid"] = "idp"
+	raw, err := t.SignedString(idp.key)
+	if err != nil {
+		idp.t.Error(err)
+	}
+	_ = json.NewEncoder(w).Encode(Token{AccessToken: "at", TokenType: "Bearer", IdToken: raw, ExpiresIn: 60})
+}
+
+// authorize 校验授权地址的参数并签发授权码，返回回调中的 state 和 code
+func (idp *fakeIdP) authorize(authUrl string) (string, string) {
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != "client" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" ||
+		q.Get("scope") != "openid email profile" {
+		idp.t.Fatalf("unexpected authorization request %s", authUrl)
+	}
+	code, _ := random()
+	idp.m.Lock()
+	idp.codes[code] = authorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	idp.m.Unlock()
+	return q.Get("state"), code
+}
+
+func newTestClient(t *testing.T, idp *fakeIdP) *Client {
+	store, _ := cache.NewInmemory(cache.Option{})
+	c, err := NewClient(Option{Providers: []ProviderOption{{
+		Name:         "fake",
+		Issuer:       idp.URL,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		RedirectUrl:  "https://app/callback",
+	}}}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+	c := newTestClient(t, idp)
+	u, err := c.AuthURL(ctx, "fake", "link:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := idp.authorize(u)
+	res, err := c.Callback(ctx, "fake", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Claims.Subject != "user-1" || res.Claims.Email != "bob@example.com" || !res.Claims.EmailVerified || res.Data != "link:1" {
+		t.Fatalf("unexpected result %+v", res.Claims)
+	}
+	// state 只能使用一次
+	if _, err := c.Callback(ctx, "fake", state, code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected invalid state, got %v", err)
+	}
+	if _, err := c.AuthURL(ctx, "other", ""); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected unknown provider, got %v", err)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+	c := newTestClient(t, idp)
+	u, _ := c.AuthURL(ctx, "fake", "")
+	_, code := idp.authorize(u)
+	// 截获的授权码没有对应的 code_verifier 无法使用
+	other, _ := c.AuthURL(ctx, "fake", "")
+	state, _ := idp.authorize(other)
+	if _, err := c.Callback(ctx, "fake", state, code); !errors.Is(err, ErrExchange) {
+		t.Fatalf("expected exchange error, got %v", err)
+	}
+}
+
+func TestInvalidIdToken(t *testing.T) {
+	cases := map[string]func(c gojwt.MapClaims){
+		"nonce":   func(c gojwt.MapClaims) { c["nonce"] = "other" },
+		"aud":     func(c gojwt.MapClaims) { c["aud"] = "other" },
+		"iss":     func(c gojwt.MapClaims) { c["iss"] = "https://evil" },
+		"expired": func(c gojwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"azp":     func(c gojwt.MapClaims) { c["aud"] = []string{"client", "other"} },
+		"sub":     func(c gojwt.MapClaims) { delete(c, "sub") },
+	}
+	ctx := context.Background()
+	for name, fn := range cases {
+		idp := newFakeIdP(t)
+		idp.claims = fn
+		c := newTestClient(t, idp)
+		u, _ := c.AuthURL(ctx, "fake", "")
+		state, code := idp.authorize(u)
+		if _, err := c.Callback(ctx, "fake", state, code); !errors.Is(err, ErrInvalidIdToken) {
+			t.Errorf("%s: expected invalid id token, got %v", name, err)
+		}
+	}
+}
+
+func TestInvalidProvider(t *testing.T) {
+	store, _ := cache.NewInmemory(cache.Option{})
+	if _, err := NewClient(Option{Providers: []ProviderOption{{Name: "x"}}}, store); err == nil {
+		t.Fatal("expected error for incomplete provider")
+	}
+	p := ProviderOption{Name: "x", Issuer: "https://idp", ClientId: "c", RedirectUrl: "https://app"}
+	if _, err := NewClient(Option{Providers: []ProviderOption{p, p}}, store); err == nil {
+		t.Fatal("expected error for duplicate provider")
+	}
+}
@@ -0,0 +1,227 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"service_template/pkg/jwt"
+	"service_template/pkg/requestid"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+type ProviderOption struct {
+	// 提供方名称，用于路由和关联外部身份，如 google
+	Name string `json:"name" yaml:"name"`
+	// 从 <issuer>/.well-known/openid-configuration 获取各端点，ID token 的 iss 须与之一致
+	Issuer       string `json:"issuer" yaml:"issuer"`
+	ClientId     string `json:"client_id" yaml:"client_id"`
+	ClientSecret string `json:"client_secret" yaml:"client_secret"`
+	// 授权后跳转的地址，须在提供方登记
+	RedirectUrl string `json:"redirect_url" yaml:"redirect_url"`
+	// 默认 openid email profile
+	Scopes []string `json:"scopes" yaml:"scopes"`
+	// 允许的时钟偏差，单位秒
+	Leeway     int          `json:"leeway" yaml:"leeway"`
+	HttpClient *http.Client `json:"-" yaml:"-"`
+}
+
+// Discovery OpenID Connect 发现文档中使用的字段
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// Token 授权码换取的 token
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IdToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// Claims ID token 中的用户信息
+type Claims struct {
+	gojwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// Provider OIDC 提供方，首次使用时获取发现文档
+type Provider struct {
+	opt ProviderOption
+
+	m         sync.Mutex
+	discovery *Discovery
+	jwks      *jwt.JWKSClient
+}
+
+func NewProvider(opt ProviderOption) (*Provider, error) {
+	if opt.Name == "" || opt.Issuer == "" || opt.ClientId == "" || opt.RedirectUrl == "" {
+		return nil, fmt.Errorf("oidc provider %q requires name, issuer, client_id and redirect_url", opt.Name)
+	}
+	if len(opt.Scopes) == 0 {
+		opt.Scopes = []string{"openid", "email", "profile"}
+	}
+	if opt.HttpClient == nil {
+		opt.HttpClient = &http.Client{Timeout: 10 * time.Second, Transport: requestid.RoundTripper(nil)}
+	}
+	return &Provider{opt: opt}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.opt.Name
+}
+
+// discover 获取发现文档，失败时下次调用重试
+func (p *Provider) discover(ctx context.Context) (*Discovery, *jwt.JWKSClient, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.discovery != nil {
+		return p.discovery, p.jwks, nil
+	}
+	u := strings.TrimSuffix(p.opt.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := p.opt.HttpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetch oidc discovery: unexpected status %d", resp.StatusCode)
+	}
+	d := &Discovery{}
+	if err := json.NewDecoder(resp.Body).Decode(d); err != nil {
+		return nil, nil, fmt.Errorf("decode oidc discovery: %w", err)
+	}
+	if d.Issuer != p.opt.Issuer {
+		return nil, nil, fmt.Errorf("oidc discovery issuer %s does not match %s", d.Issuer, p.opt.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksUri == "" {
+		return nil, nil, fmt.Errorf("oidc discovery of %s is incomplete", p.opt.Issuer)
+	}
+	p.discovery = d
+	p.jwks = jwt.NewJWKSClient(jwt.JWKSClientOption{
+		Url:        d.JwksUri,
+		Issuer:     d.Issuer,
+		Audience:   []string{p.opt.ClientId},
+		Leeway:     p.opt.Leeway,
+		HttpClient: p.opt.HttpClient,
+	})
+	return p.discovery, p.jwks, nil
+}
+
+// codeChallenge PKCE S256
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 返回授权地址，verifier 为 PKCE 的 code_verifier
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.opt.ClientId)
+	v.Set("redirect_uri", p.opt.RedirectUrl)
+	v.Set("scope", strings.Join(p.opt.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange 使用授权码换取 token，配置了 client_secret 时使用 client_secret_basic 认证
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.opt.RedirectUrl)
+	v.Set("code_verifier", verifier)
+	if p.opt.ClientSecret == "" {
+		v.Set("client_id", p.opt.ClientId)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opt.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.opt.ClientId), url.QueryEscape(p.opt.ClientSecret))
+	}
+	resp, err := p.opt.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}{}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, fmt.Errorf("%w: status %d %s %s", ErrExchange, resp.StatusCode, e.Error, e.Description)
+	}
+	token := &Token{}
+	if err := json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if token.IdToken == "" {
+		return nil, fmt.Errorf("%w: missing id_token", ErrExchange)
+	}
+	return token, nil
+}
+
+// VerifyIdToken 验证 ID token 的签名、iss、aud、exp 和 nonce
+func (p *Provider) VerifyIdToken(ctx context.Context, raw, nonce string) (*Claims, error) {
+	_, jwks, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err := jwks.Parse(ctx, raw, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIdToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIdToken)
+	}
+	// 多个 aud 时 azp 须为当前客户端
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.opt.ClientId {
+		return nil, fmt.Errorf("%w: azp mismatch", ErrInvalidIdToken)
+	}
+	return claims, nil
+}
@@ -0,0 +1,149 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrUnsupportedHash = errors.New("unsupported password hash")
+
+type Option struct {
+	// argon2id / bcrypt，默认 argon2id
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// argon2id 内存，单位 KiB，默认 65536
+	Memory uint32 `json:"memory" yaml:"memory"`
+	// argon2id 迭代次数，默认 3
+	Iterations uint32 `json:"iterations" yaml:"iterations"`
+	// argon2id 并行度，默认 2
+	Parallelism uint8 `json:"parallelism" yaml:"parallelism"`
+	// bcrypt cost，默认 bcrypt.DefaultCost
+	Cost int `json:"cost" yaml:"cost"`
+}
+
+// Hasher 计算和校验密码哈希，argon2id 使用 PHC 字符串格式，可与其他实现互通
+type Hasher struct {
+	opt Option
+}
+
+func NewHasher(opt Option) (*Hasher, error) {
+	if opt.Algorithm == "" {
+		opt.Algorithm = Argon2id
+	}
+	if opt.Algorithm != Argon2id && opt.Algorithm != Bcrypt {
+		return nil, fmt.Errorf("unsupported password hash algorithm %s", opt.Algorithm)
+	}
+	if opt.Memory == 0 {
+		opt.Memory = 64 * 1024
+	}
+	if opt.Iterations == 0 {
+		opt.Iterations = 3
+	}
+	if opt.Parallelism == 0 {
+		opt.Parallelism = 2
+	}
+	if opt.Cost == 0 {
+		opt.Cost = bcrypt.DefaultCost
+	}
+	return &Hasher{opt: opt}, nil
+}
+
+const (
+	saltLen = 16
+	keyLen  = 32
+)
+
+// Hash 使用当前配置的算法计算哈希
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.opt.Algorithm == Bcrypt {
+		b, err := bcrypt.GenerateFromPassword([]byte(password), h.opt.Cost)
+		return string(b), err
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.opt.Iterations, h.opt.Memory, h.opt.Parallelism, keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.opt.Memory, h.opt.Iterations, h.opt.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt, key   []byte
+}
+
+func parseArgon2id(encoded string) (*argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, ErrUnsupportedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnsupportedHash
+	}
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, ErrUnsupportedHash
+	}
+	return p, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Verify 按哈希自身的算法和参数校验密码，与当前配置无关
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	if isBcrypt(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+// NeedsRehash 哈希的算法或参数与当前配置不一致时返回 true，应在校验通过后重新计算
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	if isBcrypt(encoded) {
+		if h.opt.Algorithm != Bcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.opt.Cost
+	}
+	if h.opt.Algorithm != Argon2id {
+		return true
+	}
+	p, err := parseArgon2id(encoded)
+	return err != nil || p.memory != h.opt.Memory || p.iterations != h.opt.Iterations ||
+		p.parallelism != h.opt.Parallelism || len(p.key) != keyLen
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashVerify(t *testing.T) {
+	for _, opt := range []Option{
+		{Algorithm: Argon2id, Memory: 1024, Iterations: 1, Parallelism: 1},
+		{Algorithm: Bcrypt, Cost: bcrypt.MinCost},
+	} {
+		h, err := NewHasher(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := h.Verify("correct horse", encoded); !ok || err != nil {
+			t.Fatalf("%s: verify failed: %v", opt.Algorithm, err)
+		}
+		if ok, _ := h.Verify("wrong horse", encoded); ok {
+			t.Fatalf("%s: wrong password accepted", opt.Algorithm)
+		}
+		if h.NeedsRehash(encoded) {
+			t.Fatalf("%s: fresh hash needs rehash", opt.Algorithm)
+		}
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	h, _ := NewHasher(Option{Memory: 1024, Iterations: 1, Parallelism: 1})
+	encoded, _ := h.Hash("secret")
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected format %s", encoded)
+	}
+	// 盐随机生成
+	other, _ := h.Hash("secret")
+	if other == encoded {
+		t.Fatal("hash should be salted")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weak, _ := NewHasher(Option{Memory: 1024, Iterations: 1, Parallelism: 1})
+	strong, _ := NewHasher(Option{Memory: 2048, Iterations: 1, Parallelism: 1})
+	legacy, _ := NewHasher(Option{Algorithm: Bcrypt, Cost: bcrypt.MinCost})
+	encoded, _ := weak.Hash("secret")
+	if !strong.NeedsRehash(encoded) {
+		t.Fatal("expected rehash when parameters change")
+	}
+	// 旧参数的哈希在新配置下仍可校验
+	if ok, _ := strong.Verify("secret", encoded); !ok {
+		t.Fatal("verify with old parameters failed")
+	}
+	bcryptHash, _ := legacy.Hash("secret")
+	if !strong.NeedsRehash(bcryptHash) {
+		t.Fatal("expected rehash when algorithm changes")
+	}
+	if ok, _ := strong.Verify("secret", bcryptHash); !ok {
+		t.Fatal("verify bcrypt hash failed")
+	}
+}
+
+func TestInvalidHash(t *testing.T) {
+	h, _ := NewHasher(Option{})
+	for _, encoded := range []string{"", "plain", "$argon2i$v=19$m=1,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=x$c2FsdA$a2V5"} {
+		if _, err := h.Verify("secret", encoded); err == nil {
+			t.Errorf("%q: expected error", encoded)
+		}
+	}
+	if _, err := NewHasher(Option{Algorithm: "md5"}); err == nil {
+		t.Fatal("expected unsupported algorithm")
+	}
+}
@@ -0,0 +1,23 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"service_template/pkg/logger"
+)
+
+// DecisionLogger 记录授权决策，用于审计和观察试运行策略
+type DecisionLogger interface {
+	Log(ctx context.Context, d *Decision)
+}
+
+type defaultLogger struct{}
+
+func (l *defaultLogger) Log(ctx context.Context, d *Decision) {
+	b, _ := json.Marshal(d)
+	if !d.Allowed {
+		logger.WithContext(ctx).Warnf("policy decision: %s", b)
+		return
+	}
+	logger.WithContext(ctx).Infof("policy decision: %s", b)
+}
@@ -0,0 +1,269 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"service_template/pkg/ipsearch"
+	"sync"
+	"time"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+	// NotApplicable 策略不适用于该请求
+	NotApplicable Effect = ""
+)
+
+var ErrDenied = errors.New("access denied by policy")
+
+type Subject struct {
+	Id         string                 `json:"id"`
+	TenantId   string                 `json:"tenant_id,omitempty"`
+	Roles      []string               `json:"roles,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type Resource struct {
+	Type       string                 `json:"type"`
+	Id         string                 `json:"id,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type Environment struct {
+	Time time.Time `json:"time"`
+	IP   string    `json:"ip,omitempty"`
+	// 由 IP 解析，未配置 IP 库时为空
+	Location   *ipsearch.IPAddress    `json:"location,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type Request struct {
+	Subject     Subject     `json:"subject"`
+	Action      string      `json:"action"`
+	Resource    Resource    `json:"resource"`
+	Environment Environment `json:"environment"`
+}
+
+// Policy 判断请求是否被允许，不适用时返回 NotApplicable
+type Policy interface {
+	Name() string
+	Evaluate(ctx context.Context, req *Request) (Effect, error)
+}
+
+type funcPolicy struct {
+	name string
+	fn   func(ctx context.Context, req *Request) (Effect, error)
+}
+
+// NewPolicy 使用 Go 函数定义策略
+func NewPolicy(name string, fn func(ctx context.Context, req *Request) (Effect, error)) Policy {
+	return &funcPolicy{name: name, fn: fn}
+}
+
+func (p *funcPolicy) Name() string {
+	return p.name
+}
+
+func (p *funcPolicy) Evaluate(ctx context.Context, req *Request) (Effect, error) {
+	return p.fn(ctx, req)
+}
+
+type Option struct {
+	// 为 true 时只记录决策，始终放行，用于上线前观察策略效果
+	DryRun bool `json:"dry_run" yaml:"dry_run"`
+	// 记录所有决策，为 false 时只记录拒绝和试运行结果与实际结果不一致的决策
+	LogAll bool         `json:"log_all" yaml:"log_all"`
+	Rules  []RuleOption `json:"rules" yaml:"rules"`
+	// 为 nil 时使用 pkg/logger 记录
+	Logger DecisionLogger `json:"-" yaml:"-"`
+	// 解析 IP 所在地，为 nil 时不解析
+	Locate ipsearch.Locator `json:"-" yaml:"-"`
+}
+
+// Decision 一次授权决策
+type Decision struct {
+	Request *Request `json:"request"`
+	// 实际执行的结果
+	Allowed bool `json:"allowed"`
+	// 非试运行策略的计算结果，全局试运行时可能与 Allowed 不一致
+	Effect Effect `json:"effect"`
+	// 决定结果的策略，默认拒绝时为空
+	Policy string `json:"policy,omitempty"`
+	// 包含试运行策略时的计算结果，与 Effect 不一致时说明新策略将改变决策
+	ShadowEffect Effect `json:"shadow_effect"`
+	ShadowPolicy string `json:"shadow_policy,omitempty"`
+	DryRun       bool   `json:"dry_run"`
+	// 执行出错的策略，出错的策略视为拒绝
+	Errors   map[string]string `json:"errors,omitempty"`
+	Duration time.Duration     `json:"duration"`
+}
+
+type entry struct {
+	policy Policy
+	dryRun bool
+}
+
+// Engine 按 deny 优先的规则组合策略，没有策略允许时拒绝
+type Engine struct {
+	opt    Option
+	logger DecisionLogger
+	locate ipsearch.Locator
+	now    func() time.Time
+
+	m        sync.RWMutex
+	policies []entry
+}
+
+func NewEngine(opt Option) (*Engine, error) {
+	e := &Engine{
+		opt:    opt,
+		logger: opt.Logger,
+		locate: opt.Locate,
+		now:    time.Now,
+	}
+	if e.logger == nil {
+		e.logger = &defaultLogger{}
+	}
+	for _, r := range opt.Rules {
+		p, err := NewRule(r)
+		if err != nil {
+			return nil, err
+		}
+		e.add(p, r.DryRun)
+	}
+	return e, nil
+}
+
+func (e *Engine) add(p Policy, dryRun bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.policies = append(e.policies, entry{policy: p, dryRun: dryRun})
+}
+
+// Register 注册策略
+func (e *Engine) Register(p Policy) {
+	e.add(p, false)
+}
+
+// RegisterDryRun 注册试运行的策略，其结果只记录在决策日志中，不影响实际决策
+func (e *Engine) RegisterDryRun(p Policy) {
+	e.add(p, true)
+}
+
+type combined struct {
+	effect Effect
+	policy string
+}
+
+// apply 按 deny 优先合并结果
+func (c *combined) apply(effect Effect, policy string) {
+	switch {
+	case effect == Deny && c.effect != Deny:
+		c.effect, c.policy = Deny, policy
+	case effect == Allow && c.effect == NotApplicable:
+		c.effect, c.policy = Allow, policy
+	}
+}
+
+// Evaluate 计算决策并记录决策日志
+func (e *Engine) Evaluate(ctx context.Context, req *Request) *Decision {
+	start := e.now()
+	if env, ok := FromContext(ctx); ok {
+		mergeEnvironment(&req.Environment, env)
+	}
+	if req.Environment.Time.IsZero() {
+		req.Environment.Time = start
+	}
+	if e.locate != nil && req.Environment.IP != "" && req.Environment.Location == nil {
+		if location, ok := e.locate(req.Environment.IP); ok {
+			req.Environment.Location = &location
+		}
+	}
+
+	e.m.RLock()
+	policies := e.policies
+	e.m.RUnlock()
+
+	d := &Decision{Request: req, DryRun: e.opt.DryRun}
+	var enforced, shadow combined
+	for _, p := range policies {
+		effect, err := p.policy.Evaluate(ctx, req)
+		if err != nil {
+			if d.Errors == nil {
+				d.Errors = make(map[string]string)
+			}
+			d.Errors[p.policy.Name()] = err.Error()
+			effect = Deny
+		}
+		shadow.apply(effect, p.policy.Name())
+		if !p.dryRun {
+			enforced.apply(effect, p.policy.Name())
+		}
+	}
+	if enforced.effect == NotApplicable {
+		enforced.effect = Deny
+	}
+	if shadow.effect == NotApplicable {
+		shadow.effect = Deny
+	}
+	d.Effect, d.Policy = enforced.effect, enforced.policy
+	d.ShadowEffect, d.ShadowPolicy = shadow.effect, shadow.policy
+	d.Allowed = d.Effect == Allow || e.opt.DryRun
+	d.Duration = e.now().Sub(start)
+	if e.opt.LogAll || d.Effect == Deny || d.ShadowEffect != d.Effect {
+		e.logger.Log(ctx, d)
+	}
+	return d
+}
+
+// Authorize 计算决策，拒绝时返回 ErrDenied
+func (e *Engine) Authorize(ctx context.Context, req *Request) error {
+	d := e.Evaluate(ctx, req)
+	if !d.Allowed {
+		if d.Policy != "" {
+			return fmt.Errorf("%w: %s", ErrDenied, d.Policy)
+		}
+		return ErrDenied
+	}
+	return nil
+}
+
+type envKey struct{}
+
+// NewContext 保存请求的环境信息，供服务层调用策略时使用
+func NewContext(ctx context.Context, env Environment) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+func FromContext(ctx context.Context) (Environment, bool) {
+	env, ok := ctx.Value(envKey{}).(Environment)
+	return env, ok
+}
+
+// mergeEnvironment 使用 ctx 中的环境信息补充请求中未设置的字段
+func mergeEnvironment(dst *Environment, src Environment) {
+	if dst.Time.IsZero() {
+		dst.Time = src.Time
+	}
+	if dst.IP == "" {
+		dst.IP = src.IP
+	}
+	if dst.Location == nil {
+		dst.Location = src.Location
+	}
+	if len(src.Attributes) == 0 {
+		return
+	}
+	attrs := make(map[string]interface{}, len(src.Attributes)+len(dst.Attributes))
+	for k, v := range src.Attributes {
+		attrs[k] = v
+	}
+	for k, v := range dst.Attributes {
+		attrs[k] = v
+	}
+	dst.Attributes = attrs
+}
@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"service_template/pkg/ipsearch"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	decisions []*Decision
+}
+
+func (r *recorder) Log(_ context.Context, d *Decision) {
+	r.decisions = append(r.decisions, d)
+}
+
+// ownRule 用户只能修改自己的订单
+var ownRule = RuleOption{
+	Name:      "order_owner",
+	Effect:    "allow",
+	Actions:   []string{"order:*"},
+	Resources: []string{"order"},
+	Conditions: []ConditionOption{
+		{Attr: "resource.owner_id", Op: OpEq, ValueFrom: "subject.id"},
+	},
+}
+
+func orderReq(subject string, owner int) *Request {
+	return &Request{
+		Subject:  Subject{Id: subject},
+		Action:   "order:update",
+		Resource: Resource{Type: "order", Id: "1", Attributes: map[string]interface{}{"owner_id": owner}},
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	rec := &recorder{}
+	e, err := NewEngine(Option{Rules: []RuleOption{ownRule}, Logger: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := e.Authorize(ctx, orderReq("5", 5)); err != nil {
+		t.Fatal(err)
+	}
+	err = e.Authorize(ctx, orderReq("6", 5))
+	if !errors.Is(err, ErrDenied) {
+		t.Fatalf("expected denied, got %v", err)
+	}
+	// 只记录拒绝的决策
+	if len(rec.decisions) != 1 || rec.decisions[0].Allowed || rec.decisions[0].Policy != "" {
+		t.Fatalf("unexpected decision log %+v", rec.decisions)
+	}
+	// 不匹配的操作默认拒绝
+	req := orderReq("5", 5)
+	req.Action = "invoice:read"
+	if d := e.Evaluate(ctx, req); d.Allowed {
+		t.Fatal("expected default deny")
+	}
+}
+
+func TestDenyOverrides(t *testing.T) {
+	e, _ := NewEngine(Option{Rules: []RuleOption{ownRule, {
+		Name:    "office_network",
+		Effect:  "deny",
+		Actions: []string{"*"},
+		Conditions: []ConditionOption{
+			{Attr: "env.ip", Op: OpCidr, Value: []interface{}{"10.0.0.0/8"}},
+		},
+	}}, Logger: &recorder{}})
+	ctx := NewContext(context.Background(), Environment{IP: "10.1.2.3"})
+	d := e.Evaluate(ctx, orderReq("5", 5))
+	if d.Allowed || d.Policy != "office_network" || d.Request.Environment.IP != "10.1.2.3" {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	ctx = NewContext(context.Background(), Environment{IP: "192.168.1.1"})
+	if d := e.Evaluate(ctx, orderReq("5", 5)); !d.Allowed || d.Policy != "order_owner" {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+}
+
+func TestDryRunPolicy(t *testing.T) {
+	rec := &recorder{}
+	e, _ := NewEngine(Option{Rules: []RuleOption{ownRule}, Logger: rec})
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	// 新策略：夜间禁止修改订单
+	e.RegisterDryRun(NewPolicy("no_night_update", func(ctx context.Context, req *Request) (Effect, error) {
+		if req.Environment.Time.Hour() >= 22 {
+			return Deny, nil
+		}
+		return NotApplicable, nil
+	}))
+	req := orderReq("5", 5)
+	req.Environment.Time = now
+	d := e.Evaluate(context.Background(), req)
+	if !d.Allowed || d.Effect != Allow || d.ShadowEffect != Deny || d.ShadowPolicy != "no_night_update" {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	// 试运行结果与实际不一致时记录
+	if len(rec.decisions) != 1 {
+		t.Fatalf("expected decision logged, got %d", len(rec.decisions))
+	}
+}
+
+func TestGlobalDryRun(t *testing.T) {
+	rec := &recorder{}
+	e, _ := NewEngine(Option{DryRun: true, Rules: []RuleOption{ownRule}, Logger: rec})
+	d := e.Evaluate(context.Background(), orderReq("6", 5))
+	if !d.Allowed || d.Effect != Deny || !d.DryRun {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	if len(rec.decisions) != 1 {
+		t.Fatal("expected decision logged")
+	}
+}
+
+func TestPolicyError(t *testing.T) {
+	e, _ := NewEngine(Option{Rules: []RuleOption{ownRule}, Logger: &recorder{}})
+	e.Register(NewPolicy("broken", func(ctx context.Context, req *Request) (Effect, error) {
+		return NotApplicable, errors.New("lookup failed")
+	}))
+	d := e.Evaluate(context.Background(), orderReq("5", 5))
+	if d.Allowed || d.Errors["broken"] == "" {
+		t.Fatalf("error should deny, got %+v", d)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	locate := func(ip string) (ipsearch.IPAddress, bool) {
+		if ip != "1.2.3.4" {
+			return ipsearch.IPAddress{IP: ip}, false
+		}
+		return ipsearch.IPAddress{IP: ip, CountryCode: "CN"}, true
+	}
+	e, _ := NewEngine(Option{LogAll: true, Logger: &recorder{}, Locate: locate, Rules: []RuleOption{{
+		Name:   "cn_only",
+		Effect: "allow",
+		Conditions: []ConditionOption{
+			{Attr: "env.country_code", Op: OpIn, Value: []string{"CN"}},
+		},
+	}}})
+	req := &Request{Action: "order:read", Environment: Environment{IP: "1.2.3.4"}}
+	if d := e.Evaluate(context.Background(), req); !d.Allowed {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	// 无法解析所在地的地址不满足条件
+	req = &Request{Action: "order:read", Environment: Environment{IP: "2001:db8::1"}}
+	if d := e.Evaluate(context.Background(), req); d.Allowed || req.Environment.Location != nil {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+}
+
+func TestInvalidRule(t *testing.T) {
+	cases := []RuleOption{
+		{Effect: "allow"},
+		{Name: "a", Effect: "permit"},
+		{Name: "a", Effect: "allow", Conditions: []ConditionOption{{Attr: "subject.id", Op: "like"}}},
+		{Name: "a", Effect: "allow", Conditions: []ConditionOption{{Attr: "user.id", Op: OpEq}}},
+		{Name: "a", Effect: "allow", Conditions: []ConditionOption{{Attr: "env.ip", Op: OpCidr, Value: "10.0.0.1"}}},
+	}
+	for i, c := range cases {
+		if _, err := NewRule(c); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	OpEq      = "eq"
+	OpNe      = "ne"
+	OpIn      = "in"
+	OpNotIn   = "not_in"
+	OpContain = "contains"
+	OpGt      = "gt"
+	OpGte     = "gte"
+	OpLt      = "lt"
+	OpLte     = "lte"
+	// OpCidr 属性为 IP，值为 CIDR 或 CIDR 列表
+	OpCidr = "cidr"
+)
+
+// ConditionOption 规则的条件，attr 格式为 action、subject.id、resource.owner_id、env.hour 等
+type ConditionOption struct {
+	Attr  string      `json:"attr" yaml:"attr"`
+	Op    string      `json:"op" yaml:"op"`
+	Value interface{} `json:"value" yaml:"value"`
+	// 与另一个属性比较，如 resource.owner_id eq subject.id，设置后忽略 value
+	ValueFrom string `json:"value_from" yaml:"value_from"`
+}
+
+// RuleOption 声明式规则，actions 和 resources 匹配且所有条件成立时生效
+type RuleOption struct {
+	Name string `json:"name" yaml:"name"`
+	// allow / deny
+	Effect string `json:"effect" yaml:"effect"`
+	// 为空时匹配所有操作，支持 * 和 order:* 形式的前缀匹配
+	Actions []string `json:"actions" yaml:"actions"`
+	// 资源类型，为空时匹配所有资源
+	Resources  []string          `json:"resources" yaml:"resources"`
+	Conditions []ConditionOption `json:"conditions" yaml:"conditions"`
+	// 试运行，只记录结果不影响决策
+	DryRun bool `json:"dry_run" yaml:"dry_run"`
+}
+
+type rule struct {
+	opt    RuleOption
+	effect Effect
+}
+
+// NewRule 校验并创建声明式规则
+func NewRule(opt RuleOption) (Policy, error) {
+	if opt.Name == "" {
+		return nil, fmt.Errorf("policy rule requires name")
+	}
+	r := &rule{opt: opt, effect: Effect(opt.Effect)}
+	if r.effect != Allow && r.effect != Deny {
+		return nil, fmt.Errorf("policy rule %s: unsupported effect %q", opt.Name, opt.Effect)
+	}
+	for _, c := range opt.Conditions {
+		switch c.Op {
+		case OpEq, OpNe, OpIn, OpNotIn, OpContain, OpGt, OpGte, OpLt, OpLte:
+		case OpCidr:
+			for _, v := range toList(c.Value) {
+				if _, _, err := net.ParseCIDR(fmt.Sprint(v)); err != nil {
+					return nil, fmt.Errorf("policy rule %s: %w", opt.Name, err)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("policy rule %s: unsupported op %q", opt.Name, c.Op)
+		}
+		if !validAttr(c.Attr) || (c.ValueFrom != "" && !validAttr(c.ValueFrom)) {
+			return nil, fmt.Errorf("policy rule %s: invalid attr %q", opt.Name, c.Attr)
+		}
+	}
+	return r, nil
+}
+
+func (r *rule) Name() string {
+	return r.opt.Name
+}
+
+func (r *rule) Evaluate(_ context.Context, req *Request) (Effect, error) {
+	if len(r.opt.Actions) > 0 && !matchAny(r.opt.Actions, req.Action) {
+		return NotApplicable, nil
+	}
+	if len(r.opt.Resources) > 0 && !matchAny(r.opt.Resources, req.Resource.Type) {
+		return NotApplicable, nil
+	}
+	for _, c := range r.opt.Conditions {
+		if !evalCondition(c, req) {
+			return NotApplicable, nil
+		}
+	}
+	return r.effect, nil
+}
+
+// matchPattern 支持 * 和 order:* 形式的前缀匹配
+func matchPattern(pattern, v string) bool {
+	if pattern == "*" || pattern == v {
+		return true
+	}
+	if strings.HasSuffix(pattern, ":*") {
+		return strings.HasPrefix(v, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+func matchAny(patterns []string, v string) bool {
+	for _, p := range patterns {
+		if matchPattern(p, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func validAttr(attr string) bool {
+	if attr == "action" {
+		return true
+	}
+	scope, name, ok := strings.Cut(attr, ".")
+	return ok && name != "" && (scope == "subject" || scope == "resource" || scope == "env")
+}
+
+// resolve 返回请求中的属性值，属性不存在时返回 false
+func resolve(req *Request, attr string) (interface{}, bool) {
+	if attr == "action" {
+		return req.Action, true
+	}
+	scope, name, _ := strings.Cut(attr, ".")
+	switch scope {
+	case "subject":
+		switch name {
+		case "id":
+			return req.Subject.Id, req.Subject.Id != ""
+		case "tenant_id":
+			return req.Subject.TenantId, req.Subject.TenantId != ""
+		case "roles":
+			return req.Subject.Roles, true
+		}
+		v, ok := req.Subject.Attributes[name]
+		return v, ok
+	case "resource":
+		switch name {
+		case "type":
+			return req.Resource.Type, true
+		case "id":
+			return req.Resource.Id, req.Resource.Id != ""
+		}
+		v, ok := req.Resource.Attributes[name]
+		return v, ok
+	case "env":
+		env := &req.Environment
+		switch name {
+		case "ip":
+			return env.IP, env.IP != ""
+		case "hour":
+			return env.Time.Hour(), !env.Time.IsZero()
+		case "weekday":
+			return int(env.Time.Weekday()), !env.Time.IsZero()
+		}
+		if loc := env.Location; loc != nil {
+			switch name {
+			case "country":
+				return loc.Country, loc.Country != ""
+			case "country_code":
+				return loc.CountryCode, loc.CountryCode != ""
+			case "province":
+				return loc.Province, loc.Province != ""
+			case "city":
+				return loc.City, loc.City != ""
+			case "isp":
+				return loc.ISP, loc.ISP != ""
+			}
+		}
+		v, ok := env.Attributes[name]
+		return v, ok
+	}
+	return nil, false
+}
+
+// evalCondition 属性不存在时条件不成立
+func evalCondition(c ConditionOption, req *Request) bool {
+	actual, ok := resolve(req, c.Attr)
+	if !ok {
+		return false
+	}
+	expected := c.Value
+	if c.ValueFrom != "" {
+		if expected, ok = resolve(req, c.ValueFrom); !ok {
+			return false
+		}
+	}
+	switch c.Op {
+	case OpEq:
+		return equal(actual, expected)
+	case OpNe:
+		return !equal(actual, expected)
+	case OpIn:
+		return contains(toList(expected), actual)
+	case OpNotIn:
+		return !contains(toList(expected), actual)
+	case OpContain:
+		return contains(toList(actual), expected)
+	case OpGt, OpGte, OpLt, OpLte:
+		a, ok1 := toFloat(actual)
+		e, ok2 := toFloat(expected)
+		if !ok1 || !ok2 {
+			return false
+		}
+		switch c.Op {
+		case OpGt:
+			return a > e
+		case OpGte:
+			return a >= e
+		case OpLt:
+			return a < e
+		default:
+			return a <= e
+		}
+	case OpCidr:
+		ip := net.ParseIP(fmt.Sprint(actual))
+		if ip == nil {
+			return false
+		}
+		for _, v := range toList(expected) {
+			if _, n, err := net.ParseCIDR(fmt.Sprint(v)); err == nil && n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equal 数值按大小比较，其他类型按字符串比较，使 owner_id 为 5 与 subject.id 为 "5" 相等
+func equal(a, b interface{}) bool {
+	fa, ok1 := toFloat(a)
+	fb, ok2 := toFloat(b)
+	if ok1 && ok2 {
+		return fa == fb
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func contains(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if equal(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// toList 将切片转换为 []interface{}，非切片视为只有一个元素
+func toList(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
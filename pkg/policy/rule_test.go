@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCondition(t *testing.T) {
+	req := &Request{
+		Subject: Subject{Id: "5", Roles: []string{"editor"}, Attributes: map[string]interface{}{"level": 3}},
+		Action:  "order:update",
+		Resource: Resource{Type: "order", Attributes: map[string]interface{}{
+			"owner_id": int64(5),
+			"status":   "paid",
+			"tags":     []string{"vip"},
+		}},
+		Environment: Environment{Time: time.Date(2024, 1, 1, 9, 30, 0, 0, time.Local), IP: "192.168.1.10"},
+	}
+	cases := []struct {
+		c    ConditionOption
+		want bool
+	}{
+		{ConditionOption{Attr: "resource.owner_id", Op: OpEq, ValueFrom: "subject.id"}, true},
+		{ConditionOption{Attr: "resource.status", Op: OpNe, Value: "paid"}, false},
+		{ConditionOption{Attr: "resource.status", Op: OpIn, Value: []interface{}{"paid", "shipped"}}, true},
+		{ConditionOption{Attr: "resource.status", Op: OpNotIn, Value: []string{"paid"}}, false},
+		{ConditionOption{Attr: "resource.tags", Op: OpContain, Value: "vip"}, true},
+		{ConditionOption{Attr: "subject.roles", Op: OpContain, Value: "admin"}, false},
+		{ConditionOption{Attr: "subject.level", Op: OpGte, Value: 3}, true},
+		{ConditionOption{Attr: "subject.level", Op: OpGt, Value: 3.5}, false},
+		{ConditionOption{Attr: "env.hour", Op: OpLt, Value: 18}, true},
+		{ConditionOption{Attr: "env.weekday", Op: OpEq, Value: 1}, true},
+		{ConditionOption{Attr: "env.ip", Op: OpCidr, Value: "192.168.0.0/16"}, true},
+		{ConditionOption{Attr: "action", Op: OpEq, Value: "order:update"}, true},
+		// 属性不存在时条件不成立
+		{ConditionOption{Attr: "resource.deleted_at", Op: OpNe, Value: "x"}, false},
+		{ConditionOption{Attr: "env.country", Op: OpEq, Value: "中国"}, false},
+	}
+	for _, tc := range cases {
+		if got := evalCondition(tc.c, req); got != tc.want {
+			t.Errorf("%s %s %v: got %v, want %v", tc.c.Attr, tc.c.Op, tc.c.Value, got, tc.want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, v string
+		want       bool
+	}{
+		{"*", "order:read", true},
+		{"order:*", "order:read", true},
+		{"order:*", "orders:read", false},
+		{"order:read", "order:read", true},
+		{"order:read", "order:update", false},
+	}
+	for _, tc := range cases {
+		if got := matchPattern(tc.pattern, tc.v); got != tc.want {
+			t.Errorf("%s %s: got %v, want %v", tc.pattern, tc.v, got, tc.want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package pusher
 
 import (
+	gocontext "context"
 	"service_template/pkg/logger"
+	"service_template/pkg/requestid"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,6 +19,18 @@ type Message struct {
 	Title       string `json:"title"`
 	Body        string `json:"body"`
 	CreatedTime int64  `json:"created_time"`
+	// 触发推送的请求 ID
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// NewMessage 创建消息，附带 ctx 中的请求 ID
+func NewMessage(ctx gocontext.Context, title, body string) Message {
+	return Message{
+		Title:       title,
+		Body:        body,
+		CreatedTime: time.Now().Unix(),
+		RequestId:   requestid.FromContext(ctx),
+	}
 }
 
 type Option struct {
@@ -0,0 +1,255 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"service_template/pkg/cache"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	// 与窗口边界对齐，便于构造边界场景
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.m.Lock()
+	c.now = c.now.Add(d)
+	c.m.Unlock()
+}
+
+func newTestLimiter(t testing.TB, opt Option, rdb *cache.Redis) RateLimiter {
+	l, err := NewRateLimiter(opt, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+type limiterCase struct {
+	name      string
+	algorithm string
+	store     string
+	rdb       *cache.Redis
+}
+
+func limiterCases(t *testing.T) []limiterCase {
+	var cases []limiterCase
+	algorithms := []string{AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmTokenBucket, AlgorithmGCRA}
+	for _, alg := range algorithms {
+		cases = append(cases, limiterCase{name: alg + "/local", algorithm: alg, store: StoreLocal})
+	}
+	rdb, err := cache.NewRedis(cache.Option{
+		Host: "192.168.92.153",
+		Port: 6379,
+	})
+	if err != nil {
+		t.Logf("redis unavailable, only local limiters are tested: %v", err)
+		return cases
+	}
+	t.Cleanup(func() {
+		_ = rdb.Close()
+	})
+	// redis 固定窗口使用服务端时间，无法使用假时钟
+	for _, alg := range algorithms[1:] {
+		cases = append(cases, limiterCase{name: alg + "/redis", algorithm: alg, store: StoreRedis, rdb: rdb.(*cache.Redis)})
+	}
+	return cases
+}
+
+// runSuite 对所有算法运行同一组行为测试
+func runSuite(t *testing.T, fn func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string)) {
+	for _, c := range limiterCases(t) {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			clock := newFakeClock()
+			l := newTestLimiter(t, Option{
+				Algorithm: c.algorithm,
+				Store:     c.store,
+				Max:       5,
+				Interval:  10,
+				Clock:     clock,
+			}, c.rdb)
+			fn(t, c, l, clock, fmt.Sprintf("test_ratelimiter:%d", rand.Int63()))
+		})
+	}
+}
+
+func countPass(t *testing.T, l RateLimiter, key string, n int) int {
+	pass := 0
+	for i := 0; i < n; i++ {
+		ok, err := l.CanPass(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			pass++
+		}
+	}
+	return pass
+}
+
+func TestLimiterBurst(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		if pass := countPass(t, l, key, 10); pass != 5 {
+			t.Fatalf("expect 5 requests passed, got %d", pass)
+		}
+	})
+}
+
+func TestLimiterRecover(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		countPass(t, l, key, 10)
+		// 滑动窗口计数需要上一窗口也完全过去才会完全恢复
+		clock.Advance(20*time.Second + time.Millisecond)
+		if pass := countPass(t, l, key, 10); pass != 5 {
+			t.Fatalf("expect 5 requests passed after the window passed, got %d", pass)
+		}
+	})
+}
+
+func TestLimiterKeysIndependent(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		countPass(t, l, key, 10)
+		if pass := countPass(t, l, key+":other", 10); pass != 5 {
+			t.Fatalf("expect 5 requests passed for another key, got %d", pass)
+		}
+	})
+}
+
+func TestLimiterReset(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		countPass(t, l, key, 10)
+		if err := l.Reset(key); err != nil {
+			t.Fatal(err)
+		}
+		if pass := countPass(t, l, key, 10); pass != 5 {
+			t.Fatalf("expect 5 requests passed after reset, got %d", pass)
+		}
+	})
+}
+
+func TestLimiterWindowBoundary(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		// 第一个请求开启窗口，随后在窗口结束前后各发起一轮请求
+		countPass(t, l, key, 1)
+		clock.Advance(9900 * time.Millisecond)
+		pass := countPass(t, l, key, 5)
+		clock.Advance(200 * time.Millisecond)
+		pass += countPass(t, l, key, 5)
+		if c.algorithm == AlgorithmFixedWindow {
+			// 固定窗口在边界处允许接近 2 倍的突发
+			if pass != 9 {
+				t.Fatalf("expect fixed window to pass 9 requests around boundary, got %d", pass)
+			}
+			return
+		}
+		if pass > 5 {
+			t.Fatalf("expect at most 5 requests passed around boundary, got %d", pass)
+		}
+	})
+}
+
+func TestLimiterSteadyRate(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		pass := 0
+		for i := 0; i < 200; i++ {
+			pass += countPass(t, l, key, 1)
+			clock.Advance(500 * time.Millisecond)
+		}
+		// 100 秒内按 5 次/10 秒，首个窗口允许突发；滑动窗口计数为估算值，会略偏保守
+		if pass < 40 || pass > 55 {
+			t.Fatalf("expect about 50 requests passed in 100s, got %d", pass)
+		}
+	})
+}
+
+func TestLimiterDecision(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		for i := int64(1); i <= 5; i++ {
+			d, err := l.Allow(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !d.Allowed || d.Limit != 5 || d.Remaining != 5-i {
+				t.Fatalf("unexpected decision %+v after %d requests", d, i)
+			}
+			if !d.ResetAt.After(clock.Now()) {
+				t.Fatalf("reset time %v should be after now", d.ResetAt)
+			}
+		}
+		d, err := l.Allow(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed || d.Remaining != 0 || d.RetryAfter <= 0 {
+			t.Fatalf("unexpected decision %+v when limited", d)
+		}
+		// 等待 RetryAfter 之后应当能够通过
+		clock.Advance(d.RetryAfter + time.Millisecond)
+		if d, _ := l.Allow(key); !d.Allowed {
+			t.Fatalf("still limited after retry after, decision: %+v", d)
+		}
+	})
+}
+
+func TestLimiterAllowN(t *testing.T) {
+	runSuite(t, func(t *testing.T, c limiterCase, l RateLimiter, clock *fakeClock, key string) {
+		d, err := l.AllowN(key, 3)
+		if err != nil || !d.Allowed || d.Remaining != 2 {
+			t.Fatalf("unexpected decision %+v, err: %v", d, err)
+		}
+		// 配额不足时不消耗
+		d, _ = l.AllowN(key, 3)
+		if d.Allowed {
+			t.Fatal("allowed cost exceeding remaining quota")
+		}
+		d, _ = l.AllowN(key, 2)
+		if !d.Allowed || d.Remaining != 0 {
+			t.Fatalf("rejected cost within remaining quota, decision: %+v", d)
+		}
+		if _, err := l.AllowN(key, 0); err != ErrInvalidCost {
+			t.Fatalf("expect ErrInvalidCost, got %v", err)
+		}
+	})
+}
+
+func TestLimiterWait(t *testing.T) {
+	l := newTestLimiter(t, Option{Algorithm: AlgorithmTokenBucket, Max: 10, Interval: 1}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	for i := 0; i < 12; i++ {
+		if err := l.Wait(ctx, "wait", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("wait returned too early: %v", elapsed)
+	}
+	if err := l.Wait(ctx, "wait", 11); err != ErrExceedsLimit {
+		t.Fatalf("expect ErrExceedsLimit, got %v", err)
+	}
+	short, cancel2 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel2()
+	for i := 0; i < 10; i++ {
+		_, _ = l.AllowN("wait2", 1)
+	}
+	if err := l.Wait(short, "wait2", 5); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
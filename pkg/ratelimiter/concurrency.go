@@ -0,0 +1,122 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type ConcurrencyOption struct {
+	// 最大并发数，自适应模式下为初始并发数
+	Limit int `json:"limit" yaml:"limit"`
+	// 按请求延迟自适应调整并发数（AIMD）
+	Adaptive bool `json:"adaptive" yaml:"adaptive"`
+	// 自适应模式下并发数的下限，默认为 1
+	MinLimit int `json:"min_limit" yaml:"min_limit"`
+	// 自适应模式下并发数的上限，默认等于 Limit
+	MaxLimit int `json:"max_limit" yaml:"max_limit"`
+	// 目标延迟，单位毫秒，超过时按 Backoff 乘性减少并发数，默认 100
+	TargetLatency int `json:"target_latency" yaml:"target_latency"`
+	// 乘性减少的系数，默认 0.9
+	Backoff float64 `json:"backoff" yaml:"backoff"`
+	Clock   Clock   `json:"-" yaml:"-"`
+}
+
+// ConcurrencyLimiter 限制同时处理中的请求数。
+// 自适应模式下，请求延迟不超过目标延迟时并发数每轮加 1，超过时按比例减少且每个延迟周期最多减少一次，
+// 从而在下游变慢时提前拒绝请求，而不是让请求堆积。
+type ConcurrencyLimiter struct {
+	opt      ConcurrencyOption
+	m        sync.Mutex
+	inflight int
+	limit    float64
+	// 上次乘性减少的时间，之前开始的请求不再触发减少
+	decreasedAt time.Time
+}
+
+func NewConcurrencyLimiter(opt ConcurrencyOption) *ConcurrencyLimiter {
+	if opt.Limit <= 0 {
+		panic("concurrency limit must be positive")
+	}
+	if opt.MinLimit <= 0 {
+		opt.MinLimit = 1
+	}
+	if opt.MaxLimit <= 0 {
+		opt.MaxLimit = opt.Limit
+	}
+	if opt.TargetLatency <= 0 {
+		opt.TargetLatency = 100
+	}
+	if opt.Backoff <= 0 || opt.Backoff >= 1 {
+		opt.Backoff = 0.9
+	}
+	if opt.Clock == nil {
+		opt.Clock = realClock{}
+	}
+	return &ConcurrencyLimiter{opt: opt, limit: float64(opt.Limit)}
+}
+
+// Acquire 获取一个并发配额，成功时须在请求结束后调用 release
+func (l *ConcurrencyLimiter) Acquire() (release func(), ok bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.inflight >= l.currentLimit() {
+		return nil, false
+	}
+	l.inflight++
+	start := l.opt.Clock.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.release(start)
+		})
+	}, true
+}
+
+func (l *ConcurrencyLimiter) release(start time.Time) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	inflight := l.inflight
+	l.inflight--
+	if !l.opt.Adaptive {
+		return
+	}
+	now := l.opt.Clock.Now()
+	if now.Sub(start) > time.Duration(l.opt.TargetLatency)*time.Millisecond {
+		if start.Before(l.decreasedAt) {
+			return
+		}
+		l.limit = math.Max(l.limit*l.opt.Backoff, float64(l.opt.MinLimit))
+		l.decreasedAt = now
+		return
+	}
+	// 并发数未被充分使用时不增加，避免空闲时上限无限放大
+	if inflight*2 >= int(l.limit) {
+		l.limit = math.Min(l.limit+1/l.limit, float64(l.opt.MaxLimit))
+	}
+}
+
+func (l *ConcurrencyLimiter) currentLimit() int {
+	return int(l.limit)
+}
+
+// Limit 当前的并发上限
+func (l *ConcurrencyLimiter) Limit() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.currentLimit()
+}
+
+// Inflight 当前处理中的请求数
+func (l *ConcurrencyLimiter) Inflight() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.inflight
+}
+
+// Utilization 并发使用率
+func (l *ConcurrencyLimiter) Utilization() float64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return float64(l.inflight) / float64(l.currentLimit())
+}
@@ -0,0 +1,138 @@
+package ratelimiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOption{Limit: 3})
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		release, ok := l.Acquire()
+		if !ok {
+			t.Fatalf("acquire %d failed", i)
+		}
+		releases = append(releases, release)
+	}
+	if _, ok := l.Acquire(); ok {
+		t.Fatal("acquired beyond limit")
+	}
+	releases[0]()
+	// 重复释放不应多归还配额
+	releases[0]()
+	if n := l.Inflight(); n != 2 {
+		t.Fatalf("expect 2 inflight, got %d", n)
+	}
+	if _, ok := l.Acquire(); !ok {
+		t.Fatal("acquire failed after release")
+	}
+	if _, ok := l.Acquire(); ok {
+		t.Fatal("acquired beyond limit after release")
+	}
+}
+
+func TestConcurrencyLimiterConcurrent(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOption{Limit: 5})
+	var (
+		wg   sync.WaitGroup
+		m    sync.Mutex
+		peak int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				release, ok := l.Acquire()
+				if !ok {
+					continue
+				}
+				m.Lock()
+				if n := l.Inflight(); n > peak {
+					peak = n
+				}
+				m.Unlock()
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > 5 {
+		t.Fatalf("inflight exceeds limit: %d", peak)
+	}
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	clock := newFakeClock()
+	l := NewConcurrencyLimiter(ConcurrencyOption{
+		Limit:         10,
+		Adaptive:      true,
+		MinLimit:      2,
+		TargetLatency: 100,
+		Backoff:       0.5,
+		Clock:         clock,
+	})
+	// 慢请求使并发上限乘性减少，且不低于下限
+	for i := 0; i < 5; i++ {
+		release, ok := l.Acquire()
+		if !ok {
+			t.Fatal("acquire failed")
+		}
+		clock.Advance(200 * time.Millisecond)
+		release()
+	}
+	if n := l.Limit(); n != 2 {
+		t.Fatalf("expect limit shrink to 2, got %d", n)
+	}
+	// 并发跑满且延迟正常时逐步恢复，不超过上限
+	for i := 0; i < 200; i++ {
+		var releases []func()
+		for {
+			release, ok := l.Acquire()
+			if !ok {
+				break
+			}
+			releases = append(releases, release)
+		}
+		clock.Advance(10 * time.Millisecond)
+		for _, release := range releases {
+			release()
+		}
+	}
+	if n := l.Limit(); n != 10 {
+		t.Fatalf("expect limit grow back to 10, got %d", n)
+	}
+}
+
+func TestConcurrencyLimiterDecreaseOncePerWindow(t *testing.T) {
+	clock := newFakeClock()
+	l := NewConcurrencyLimiter(ConcurrencyOption{
+		Limit:         10,
+		Adaptive:      true,
+		TargetLatency: 100,
+		Backoff:       0.5,
+		Clock:         clock,
+	})
+	var releases []func()
+	for i := 0; i < 8; i++ {
+		release, _ := l.Acquire()
+		releases = append(releases, release)
+	}
+	// 同时开始的慢请求只减少一次
+	clock.Advance(200 * time.Millisecond)
+	for _, release := range releases {
+		release()
+	}
+	if n := l.Limit(); n != 5 {
+		t.Fatalf("expect limit shrink to 5 once, got %d", n)
+	}
+	// 减少之后开始的慢请求再次减少
+	release, _ := l.Acquire()
+	clock.Advance(200 * time.Millisecond)
+	release()
+	if n := l.Limit(); n != 2 {
+		t.Fatalf("expect limit shrink to 2, got %d", n)
+	}
+}
@@ -0,0 +1,106 @@
+package ratelimiter
+
+import (
+	"service_template/pkg/cache"
+	"service_template/pkg/logger"
+	"sync"
+	"time"
+)
+
+// DegradePolicy Redis 不可用时 Redis 限流器的处理策略
+type DegradePolicy string
+
+const (
+	// DegradeFailOpen 放行所有请求
+	DegradeFailOpen DegradePolicy = "fail_open"
+	// DegradeFailClosed 拒绝所有请求
+	DegradeFailClosed DegradePolicy = "fail_closed"
+	// DegradeLocal 切换为本地限流，每个实例的配额为 Max/Replicas
+	DegradeLocal DegradePolicy = "local"
+)
+
+// degradingLimiter 在 Redis 不可用时按策略降级，Redis 恢复后自动切回
+type degradingLimiter struct {
+	rdb *cache.Redis
+	// 默认为 rdb.IsOk
+	healthy func() bool
+	redis   allower
+	local   allower
+	opt     Option
+	policy  DegradePolicy
+
+	m        sync.Mutex
+	degraded bool
+}
+
+func newDegradingLimiter(opt Option, rdb *cache.Redis) *degradingLimiter {
+	l := &degradingLimiter{
+		rdb:     rdb,
+		healthy: rdb.IsOk,
+		redis:   newRedisAlgorithm(opt, rdb),
+		opt:     opt,
+		policy:  opt.Degrade,
+	}
+	if opt.Degrade == DegradeLocal {
+		replicas := int64(opt.Replicas)
+		if replicas <= 0 {
+			replicas = 1
+		}
+		localOpt := opt
+		localOpt.Max = max64(opt.Max/replicas, 1)
+		localOpt.Burst = max64(opt.Burst/replicas, 1)
+		l.local = newLocalAlgorithm(localOpt)
+	}
+	return l
+}
+
+func (l *degradingLimiter) allowN(key string, n int64) (Decision, error) {
+	if l.healthy() {
+		d, err := l.redis.allowN(key, n)
+		if err == nil {
+			l.transition(false, nil)
+			return d, nil
+		}
+		l.transition(true, err)
+	} else {
+		l.transition(true, l.rdb.Error())
+	}
+	switch l.policy {
+	case DegradeFailOpen:
+		return Decision{Allowed: true, Limit: l.opt.limit(), Remaining: l.opt.limit(), ResetAt: l.opt.Clock.Now()}, nil
+	case DegradeFailClosed:
+		return Decision{Limit: l.opt.limit(), ResetAt: l.opt.Clock.Now().Add(time.Second), RetryAfter: time.Second}, nil
+	default:
+		// NewRateLimiter 已校验策略，此处只能是 DegradeLocal
+		return l.local.allowN(key, n)
+	}
+}
+
+// reset 同时清除降级期间本地保存的状态
+func (l *degradingLimiter) reset(key string) error {
+	if l.local != nil {
+		_ = l.local.reset(key)
+	}
+	return l.redis.reset(key)
+}
+
+func (l *degradingLimiter) transition(degraded bool, err error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.degraded == degraded {
+		return
+	}
+	l.degraded = degraded
+	if degraded {
+		logger.Warnf("rate limiter: redis unavailable (%v), degrade to %s", err, l.policy)
+	} else {
+		logger.Infof("rate limiter: redis recovered, switch back from %s", l.policy)
+	}
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
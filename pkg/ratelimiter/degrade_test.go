@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"errors"
+	"service_template/pkg/cache"
+	"sync/atomic"
+	"testing"
+)
+
+func newDownLimiter(t *testing.T, policy DegradePolicy) RateLimiter {
+	// 未连接的 Redis 视为不可用
+	return newTestLimiter(t, Option{
+		Algorithm: AlgorithmSlidingWindow,
+		Store:     StoreRedis,
+		Max:       10,
+		Interval:  10,
+		Degrade:   policy,
+		Replicas:  2,
+		Clock:     newFakeClock(),
+	}, &cache.Redis{})
+}
+
+func TestDegradeFailOpen(t *testing.T) {
+	l := newDownLimiter(t, DegradeFailOpen)
+	if pass := countPass(t, l, "key", 100); pass != 100 {
+		t.Fatalf("expect all requests passed, got %d", pass)
+	}
+}
+
+func TestDegradeFailClosed(t *testing.T) {
+	l := newDownLimiter(t, DegradeFailClosed)
+	d, err := l.Allow("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed || d.RetryAfter <= 0 {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+}
+
+func TestDegradeLocal(t *testing.T) {
+	l := newDownLimiter(t, DegradeLocal)
+	// 2 个实例，每个实例按 10/2 限流
+	if pass := countPass(t, l, "key", 20); pass != 5 {
+		t.Fatalf("expect 5 requests passed, got %d", pass)
+	}
+}
+
+func TestInvalidDegradePolicy(t *testing.T) {
+	_, err := NewRateLimiter(Option{Store: StoreRedis, Max: 10, Interval: 10, Degrade: "locl"}, &cache.Redis{})
+	if err == nil {
+		t.Fatal("expected error for unknown degrade policy")
+	}
+}
+
+// fakeRedisAlgorithm 模拟 Redis 限流器，始终放行并记录调用次数
+type fakeRedisAlgorithm struct {
+	calls int64
+	err   error
+}
+
+func (f *fakeRedisAlgorithm) allowN(key string, n int64) (Decision, error) {
+	atomic.AddInt64(&f.calls, 1)
+	if f.err != nil {
+		return Decision{}, f.err
+	}
+	return Decision{Allowed: true, Limit: 10, Remaining: 9}, nil
+}
+
+func (f *fakeRedisAlgorithm) reset(key string) error {
+	return f.err
+}
+
+func TestDegradeRecover(t *testing.T) {
+	l := newDownLimiter(t, DegradeLocal).(*limiter)
+	dl := l.allower.(*degradingLimiter)
+	redis := &fakeRedisAlgorithm{}
+	var healthy atomic.Bool
+	dl.redis = redis
+	dl.healthy = healthy.Load
+
+	// Redis 不可用时按本地配额限流，不访问 Redis
+	if pass := countPass(t, l, "key", 20); pass != 5 || redis.calls != 0 {
+		t.Fatalf("expect 5 local passes without redis calls, got %d passes and %d calls", pass, redis.calls)
+	}
+	// 恢复后重新使用 Redis，本地配额耗尽不影响判定
+	healthy.Store(true)
+	if pass := countPass(t, l, "key", 20); pass != 20 || redis.calls != 20 {
+		t.Fatalf("expect redis to be used after recovery, got %d passes and %d calls", pass, redis.calls)
+	}
+	if dl.degraded {
+		t.Fatal("expect limiter to leave degraded state")
+	}
+	// Redis 调用出错时再次降级
+	redis.err = errors.New("connection reset")
+	if pass := countPass(t, l, "key", 5); pass != 0 || !dl.degraded {
+		t.Fatalf("expect local limiter to be exhausted after degrading, got %d passes", pass)
+	}
+}
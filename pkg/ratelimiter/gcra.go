@@ -0,0 +1,87 @@
+package ratelimiter
+
+import (
+	"service_template/pkg/cache"
+	"time"
+)
+
+// GCRA：只保存理论到达时间 (TAT)，每个请求将 TAT 推后一个发射间隔，时间单位为微秒
+const gcraScript = `
+local now = tonumber(ARGV[1])
+local emission = tonumber(ARGV[2])
+local tolerance = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local tat = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tat < now
+then
+	tat = now
+end
+local newTat = tat + n * emission
+local allowAt = newTat - tolerance
+if now < allowAt
+then
+	local remaining = math.floor((tolerance - (tat - now)) / emission)
+	return {0, remaining, math.ceil((tat - now) / 1000), math.ceil((allowAt - now) / 1000)}
+end
+redis.call('SET', KEYS[1], newTat, 'PX', math.ceil((newTat - now) / 1000))
+local remaining = math.floor((tolerance - (newTat - now)) / emission)
+return {1, remaining, math.ceil((newTat - now) / 1000), 0}
+`
+
+type redisGCRA struct {
+	rdb *cache.Redis
+	opt Option
+}
+
+func (r *redisGCRA) allowN(key string, n int64) (Decision, error) {
+	now := r.opt.Clock.Now()
+	emission := emissionInterval(r.opt)
+	tolerance := emission * time.Duration(r.opt.Burst)
+	return evalDecision(r.rdb, r.opt.Burst, now, gcraScript, []string{key},
+		now.UnixMicro(), emission.Microseconds(), tolerance.Microseconds(), n)
+}
+
+func (r *redisGCRA) reset(key string) error {
+	return resetRedis(r.rdb, key)
+}
+
+// emissionInterval 两个请求之间的理论间隔
+func emissionInterval(opt Option) time.Duration {
+	return opt.window() / time.Duration(opt.Max)
+}
+
+type localGCRA struct {
+	store *localStore
+	opt   Option
+}
+
+func (l *localGCRA) allowN(key string, n int64) (Decision, error) {
+	now := l.opt.Clock.Now()
+	emission := emissionInterval(l.opt)
+	tolerance := emission * time.Duration(l.opt.Burst)
+	d := Decision{Limit: l.opt.Burst}
+	l.store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+		tat, _ := state.(time.Time)
+		if tat.Before(now) {
+			tat = now
+		}
+		newTat := tat.Add(emission * time.Duration(n))
+		allowAt := newTat.Add(-tolerance)
+		if now.Before(allowAt) {
+			d.Remaining = int64((tolerance - tat.Sub(now)) / emission)
+			d.ResetAt = tat
+			d.RetryAfter = allowAt.Sub(now)
+			return tat, tat
+		}
+		d.Allowed = true
+		d.Remaining = int64((tolerance - newTat.Sub(now)) / emission)
+		d.ResetAt = newTat
+		return newTat, newTat
+	})
+	return d, nil
+}
+
+func (l *localGCRA) reset(key string) error {
+	l.store.delete(key)
+	return nil
+}
@@ -0,0 +1,160 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"service_template/pkg/cache"
+	"strconv"
+	"time"
+)
+
+// Period 配额周期，按自然日/自然月计算
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+
+	// 周期结束后计数继续保留一段时间，便于持久化最终用量
+	quotaRetention = 24 * time.Hour
+)
+
+// Window 返回 now 所在周期的标识及结束时间
+func (p Period) Window(now time.Time) (string, time.Time) {
+	switch p {
+	case PeriodMonth:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start.Format("2006-01"), start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+	}
+}
+
+// QuotaLimit 一个周期内的配额，HardLimit 为 0 时只计数不拦截
+type QuotaLimit struct {
+	Period    Period
+	HardLimit int64
+}
+
+// QuotaUsage 一个周期内的用量
+type QuotaUsage struct {
+	Period   Period
+	PeriodId string
+	Used     int64
+	ResetAt  time.Time
+}
+
+// QuotaCounter 基于 Redis 的长周期配额计数器
+type QuotaCounter struct {
+	rdb    *cache.Redis
+	prefix string
+	clock  Clock
+}
+
+func NewQuotaCounter(rdb *cache.Redis, prefix string, clock Clock) *QuotaCounter {
+	if prefix == "" {
+		prefix = "quota"
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &QuotaCounter{rdb: rdb, prefix: prefix, clock: clock}
+}
+
+func (q *QuotaCounter) key(key string, period Period, id string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", q.prefix, key, period, id)
+}
+
+// Consume 在所有周期内同时消耗 n 个配额，任一周期超出 HardLimit 时均不消耗
+func (q *QuotaCounter) Consume(ctx context.Context, key string, n int64, limits ...QuotaLimit) ([]QuotaUsage, bool, error) {
+	if n <= 0 {
+		return nil, false, ErrInvalidCost
+	}
+	if !q.rdb.IsOk() {
+		return nil, false, q.rdb.Error()
+	}
+	script := `
+local n = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[i * 2])
+	local used = tonumber(redis.call('GET', key) or '0')
+	if limit > 0 and used + n > limit
+	then
+		local res = {0}
+		for _, k in ipairs(KEYS) do
+			table.insert(res, tonumber(redis.call('GET', k) or '0'))
+		end
+		return res
+	end
+end
+local res = {1}
+for i, key in ipairs(KEYS) do
+	table.insert(res, redis.call('INCRBY', key, n))
+	redis.call('PEXPIREAT', key, ARGV[i * 2 + 1])
+end
+return res
+`
+	now := q.clock.Now()
+	usages := make([]QuotaUsage, len(limits))
+	keys := make([]string, len(limits))
+	args := []interface{}{n}
+	for i, l := range limits {
+		id, end := l.Period.Window(now)
+		usages[i] = QuotaUsage{Period: l.Period, PeriodId: id, ResetAt: end}
+		keys[i] = q.key(key, l.Period, id)
+		args = append(args, l.HardLimit, end.Add(quotaRetention).UnixMilli())
+	}
+	res, err := q.rdb.Eval(ctx, script, keys, args...).Int64Slice()
+	if err != nil {
+		q.rdb.OccurErr(err)
+		return nil, false, err
+	}
+	if len(res) != len(limits)+1 {
+		return nil, false, errInvalidResult
+	}
+	for i := range usages {
+		usages[i].Used = res[i+1]
+	}
+	return usages, res[0] == 1, nil
+}
+
+// Usage 返回 key 在当前周期内的用量
+func (q *QuotaCounter) Usage(ctx context.Context, key string, period Period) (QuotaUsage, error) {
+	id, end := period.Window(q.clock.Now())
+	used, err := q.Get(ctx, key, period, id)
+	return QuotaUsage{Period: period, PeriodId: id, Used: used, ResetAt: end}, err
+}
+
+// Get 返回 key 在指定周期内的用量，周期结束后在保留期内仍可读取
+func (q *QuotaCounter) Get(ctx context.Context, key string, period Period, periodId string) (int64, error) {
+	if !q.rdb.IsOk() {
+		return 0, q.rdb.Error()
+	}
+	v, err := q.rdb.Get(ctx, q.key(key, period, periodId))
+	if err != nil {
+		if cache.IsNotFound(err) {
+			return 0, nil
+		}
+		q.rdb.OccurErr(err)
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// Restore 计数不存在时（如 Redis 数据丢失）以持久化的用量初始化，返回是否写入
+func (q *QuotaCounter) Restore(ctx context.Context, key string, period Period, periodId string, used int64) (bool, error) {
+	id, end := period.Window(q.clock.Now())
+	if id != periodId {
+		return false, nil
+	}
+	if !q.rdb.IsOk() {
+		return false, q.rdb.Error()
+	}
+	ok, err := q.rdb.SetNX(ctx, q.key(key, period, id), used, end.Add(quotaRetention).Sub(q.clock.Now()))
+	if err != nil {
+		q.rdb.OccurErr(err)
+		return false, err
+	}
+	return ok, nil
+}
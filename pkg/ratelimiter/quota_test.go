@@ -0,0 +1,58 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"service_template/pkg/cache"
+	"testing"
+	"time"
+)
+
+func TestPeriodWindow(t *testing.T) {
+	now := time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)
+	id, end := PeriodDay.Window(now)
+	if id != "2024-12-31" || !end.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected day window %s %v", id, end)
+	}
+	id, end = PeriodMonth.Window(now)
+	if id != "2024-12" || !end.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected month window %s %v", id, end)
+	}
+}
+
+func TestQuotaCounter(t *testing.T) {
+	rdb, err := cache.NewRedis(cache.Option{
+		Host: "192.168.92.153",
+		Port: 6379,
+	})
+	if err != nil {
+		t.Skipf("redis unavailable: %v", err)
+	}
+	defer rdb.Close()
+	ctx := context.Background()
+	q := NewQuotaCounter(rdb.(*cache.Redis), "test_quota", nil)
+	key := fmt.Sprintf("%d", rand.Int63())
+	limits := []QuotaLimit{{Period: PeriodDay, HardLimit: 5}, {Period: PeriodMonth, HardLimit: 100}}
+	usages, ok, err := q.Consume(ctx, key, 3, limits...)
+	if err != nil || !ok || usages[0].Used != 3 || usages[1].Used != 3 {
+		t.Fatalf("unexpected usages %+v, ok: %v, err: %v", usages, ok, err)
+	}
+	// 超出日配额时，所有周期均不消耗
+	usages, ok, err = q.Consume(ctx, key, 3, limits...)
+	if err != nil || ok || usages[0].Used != 3 || usages[1].Used != 3 {
+		t.Fatalf("unexpected usages %+v, ok: %v, err: %v", usages, ok, err)
+	}
+	usage, err := q.Usage(ctx, key, PeriodMonth)
+	if err != nil || usage.Used != 3 {
+		t.Fatalf("unexpected usage %+v, err: %v", usage, err)
+	}
+	// 已存在的计数不会被覆盖
+	id, _ := PeriodMonth.Window(time.Now())
+	if restored, err := q.Restore(ctx, key, PeriodMonth, id, 50); err != nil || restored {
+		t.Fatalf("restore overwrote existing counter, err: %v", err)
+	}
+	if restored, err := q.Restore(ctx, key+":new", PeriodMonth, id, 50); err != nil || !restored {
+		t.Fatalf("restore failed, err: %v", err)
+	}
+}
@@ -2,18 +2,286 @@ package ratelimiter
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"service_template/pkg/cache"
-	"sync"
-	"sync/atomic"
 	"time"
 )
 
+const (
+	AlgorithmFixedWindow   = "fixed_window"
+	AlgorithmSlidingLog    = "sliding_log"
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmGCRA          = "gcra"
+
+	StoreRedis = "redis"
+	StoreLocal = "local"
+)
+
+var (
+	ErrInvalidCost   = errors.New("rate limiter cost must be positive")
+	ErrExceedsLimit  = errors.New("rate limiter cost exceeds limit")
+	errInvalidResult = errors.New("unexpected rate limiter script result")
+)
+
 type RateLimiter interface {
+	// CanPass 等价于 Allow(key).Allowed
 	CanPass(key string) (bool, error)
+	Allow(key string) (Decision, error)
+	// AllowN 一次消耗 n 个配额，不通过时不消耗
+	AllowN(key string, n int64) (Decision, error)
+	// Wait 阻塞直到 n 个配额可用或 ctx 结束，适用于出站调用
+	Wait(ctx context.Context, key string, n int64) error
+	// Reset 清除 key 已消耗的配额，如登录成功后清零失败次数
+	Reset(key string) error
+}
+
+// Decision 限流判定结果，可直接用于响应头
+type Decision struct {
+	Allowed bool
+	// 配额上限
+	Limit int64
+	// 本次判定后剩余的配额
+	Remaining int64
+	// 配额完全恢复的时间
+	ResetAt time.Time
+	// 不通过时，需要等待多久才可能通过
+	RetryAfter time.Duration
+}
+
+type Option struct {
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	Store     string `json:"store" yaml:"store"`
+	// 每个窗口允许通过的请求数
+	Max int64 `json:"max" yaml:"max"`
+	// 窗口长度，单位秒
+	Interval int `json:"interval" yaml:"interval"`
+	// 令牌桶和 GCRA 允许的突发请求数，默认等于 Max
+	Burst int64 `json:"burst" yaml:"burst"`
+	// 本地限流器最多保存的 key 数量，超出后淘汰最久未访问的 key
+	MaxEntries int `json:"max_entries" yaml:"max_entries"`
+	// Redis 不可用时的处理策略，为空时直接返回错误
+	Degrade DegradePolicy `json:"degrade" yaml:"degrade"`
+	// 实例数，降级为本地限流时每个实例的配额为 Max/Replicas
+	Replicas int   `json:"replicas" yaml:"replicas"`
+	Clock    Clock `json:"-" yaml:"-"`
+}
+
+// Clock 限流器使用的时钟，便于测试时替换
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (opt Option) validate() error {
+	if opt.Max <= 0 || opt.Interval <= 0 {
+		return errors.New("rate limiter max and interval must be positive")
+	}
+	switch opt.Algorithm {
+	case AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmTokenBucket, AlgorithmGCRA:
+	default:
+		return fmt.Errorf("unsupported rate limiter algorithm %q", opt.Algorithm)
+	}
+	switch opt.Store {
+	case StoreRedis, StoreLocal, "":
+	default:
+		return fmt.Errorf("unsupported rate limiter store %q", opt.Store)
+	}
+	switch opt.Degrade {
+	case DegradeFailOpen, DegradeFailClosed, DegradeLocal, "":
+	default:
+		return fmt.Errorf("unsupported rate limiter degrade policy %q", opt.Degrade)
+	}
+	return nil
+}
+
+func NewRateLimiter(opt Option, rdb *cache.Redis) (RateLimiter, error) {
+	if opt.Algorithm == "" {
+		opt.Algorithm = AlgorithmFixedWindow
+	}
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	if opt.Burst <= 0 {
+		opt.Burst = opt.Max
+	}
+	if opt.Clock == nil {
+		opt.Clock = realClock{}
+	}
+	if opt.Store != StoreRedis {
+		return &limiter{newLocalAlgorithm(opt), opt.limit()}, nil
+	}
+	if opt.Degrade != "" {
+		return &limiter{newDegradingLimiter(opt, rdb), opt.limit()}, nil
+	}
+	return &limiter{newRedisAlgorithm(opt, rdb), opt.limit()}, nil
+}
+
+func mustNewRateLimiter(opt Option, rdb *cache.Redis) RateLimiter {
+	l, err := NewRateLimiter(opt, rdb)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+func newRedisAlgorithm(opt Option, rdb *cache.Redis) allower {
+	switch opt.Algorithm {
+	case AlgorithmFixedWindow:
+		return &redisRateLimiter{rdb, opt.Max, opt.Interval}
+	case AlgorithmSlidingLog:
+		return &redisSlidingLog{rdb: rdb, opt: opt}
+	case AlgorithmSlidingWindow:
+		return &redisSlidingWindow{rdb: rdb, opt: opt}
+	case AlgorithmTokenBucket:
+		return &redisTokenBucket{rdb: rdb, opt: opt}
+	case AlgorithmGCRA:
+		return &redisGCRA{rdb: rdb, opt: opt}
+	default:
+		panic("unsupported rate limiter algorithm")
+	}
+}
+
+func newLocalAlgorithm(opt Option) allower {
+	switch opt.Algorithm {
+	case AlgorithmFixedWindow:
+		return &localRateLimiter{store: newLocalStore(opt.MaxEntries), opt: opt}
+	case AlgorithmSlidingLog:
+		return &localSlidingLog{store: newLocalStore(opt.MaxEntries), opt: opt}
+	case AlgorithmSlidingWindow:
+		return &localSlidingWindow{store: newLocalStore(opt.MaxEntries), opt: opt}
+	case AlgorithmTokenBucket:
+		return &localTokenBucket{store: newLocalStore(opt.MaxEntries), opt: opt}
+	case AlgorithmGCRA:
+		return &localGCRA{store: newLocalStore(opt.MaxEntries), opt: opt}
+	default:
+		panic("unsupported rate limiter algorithm")
+	}
+}
+
+// limit 单次可消耗的最大配额
+func (opt Option) limit() int64 {
+	switch opt.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		return opt.Burst
+	default:
+		return opt.Max
+	}
+}
+
+func (opt Option) window() time.Duration {
+	return time.Duration(opt.Interval) * time.Second
+}
+
+// allower 各限流算法的实现
+type allower interface {
+	allowN(key string, n int64) (Decision, error)
+	reset(key string) error
+}
+
+// limiter 基于 allowN 实现 RateLimiter 的其余方法
+type limiter struct {
+	allower
+	limit int64
+}
+
+func (l *limiter) CanPass(key string) (bool, error) {
+	d, err := l.AllowN(key, 1)
+	return d.Allowed, err
+}
+
+func (l *limiter) Allow(key string) (Decision, error) {
+	return l.AllowN(key, 1)
+}
+
+func (l *limiter) AllowN(key string, n int64) (Decision, error) {
+	if n <= 0 {
+		return Decision{}, ErrInvalidCost
+	}
+	return l.allowN(key, n)
+}
+
+func (l *limiter) Reset(key string) error {
+	return l.reset(key)
+}
+
+func (l *limiter) Wait(ctx context.Context, key string, n int64) error {
+	if n > l.limit {
+		return ErrExceedsLimit
+	}
+	for {
+		d, err := l.AllowN(key, n)
+		if err != nil {
+			return err
+		}
+		if d.Allowed {
+			return nil
+		}
+		wait := d.RetryAfter
+		if wait <= 0 {
+			wait = time.Millisecond
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// evalDecision 执行限流脚本，脚本返回 {allowed, remaining, reset_after_ms, retry_after_ms}
+func evalDecision(rdb *cache.Redis, limit int64, now time.Time, script string, keys []string, args ...interface{}) (Decision, error) {
+	if !rdb.IsOk() {
+		return Decision{}, rdb.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := rdb.Eval(ctx, script, keys, args...).Int64Slice()
+	if err != nil {
+		rdb.OccurErr(err)
+		return Decision{}, err
+	}
+	if len(res) != 4 {
+		return Decision{}, errInvalidResult
+	}
+	return Decision{
+		Allowed:    res[0] == 1,
+		Limit:      limit,
+		Remaining:  res[1],
+		ResetAt:    now.Add(time.Duration(res[2]) * time.Millisecond),
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// resetRedis 删除限流状态所在的 Redis key
+func resetRedis(rdb *cache.Redis, keys ...string) error {
+	if !rdb.IsOk() {
+		return rdb.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := rdb.Del(ctx, keys...)
+	if err != nil {
+		rdb.OccurErr(err)
+	}
+	return err
 }
 
 func NewRedisRateLimiter(rdb *cache.Redis, max int64, interval int) RateLimiter {
-	return &redisRateLimiter{rdb, max, interval}
+	return mustNewRateLimiter(Option{
+		Algorithm: AlgorithmFixedWindow,
+		Store:     StoreRedis,
+		Max:       max,
+		Interval:  interval,
+	}, rdb)
 }
 
 type redisRateLimiter struct {
@@ -22,63 +290,76 @@ type redisRateLimiter struct {
 	interval int
 }
 
-func (r *redisRateLimiter) CanPass(key string) (bool, error) {
-	if !r.rdb.IsOk() {
-		return false, r.rdb.Error()
-	}
+func (r *redisRateLimiter) allowN(key string, n int64) (Decision, error) {
 	script := `
-local res = redis.call('INCR', KEYS[1])
-if res == 1
-then 
+local max = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if count + n > max
+then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl < 0
+	then
+		ttl = 0
+	end
+	return {0, max - count, ttl, ttl}
+end
+count = redis.call('INCRBY', KEYS[1], n)
+if count == n
+then
 	redis.call('EXPIRE', KEYS[1], ARGV[1])
-end 
-return res
+end
+return {1, max - count, redis.call('PTTL', KEYS[1]), 0}
 `
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	count, err := r.rdb.Eval(ctx, script, []string{key}, r.interval).Int64()
-	if err != nil {
-		r.rdb.OccurErr(err)
-		return false, err
-	}
-	return count <= r.max, nil
+	return evalDecision(r.rdb, r.max, time.Now(), script, []string{key}, r.interval, r.max, n)
+}
+
+func (r *redisRateLimiter) reset(key string) error {
+	return resetRedis(r.rdb, key)
 }
 
 func NewLocalRateLimiter(max int64, interval int) RateLimiter {
-	return &localRateLimiter{
-		m:        sync.Mutex{},
-		max:      max,
-		interval: interval,
-		entries:  make(map[string]*Entry, 2048),
-	}
+	return mustNewRateLimiter(Option{
+		Algorithm: AlgorithmFixedWindow,
+		Store:     StoreLocal,
+		Max:       max,
+		Interval:  interval,
+	}, nil)
 }
 
-type Entry struct {
-	count     atomic.Int64
-	ExpiredAt time.Time
+type fixedWindowState struct {
+	count     int64
+	expiredAt time.Time
 }
 
 type localRateLimiter struct {
-	m        sync.Mutex
-	max      int64
-	interval int
-	entries  map[string]*Entry
+	store *localStore
+	opt   Option
 }
 
-func (l *localRateLimiter) CanPass(key string) (bool, error) {
-	l.m.Lock()
-	if e, ok := l.entries[key]; ok {
-		l.m.Unlock()
-		if e.ExpiredAt.Before(time.Now()) {
-			e.count.Store(0)
-			e.ExpiredAt = time.Now().Add(time.Second * time.Duration(l.interval))
+func (l *localRateLimiter) allowN(key string, n int64) (Decision, error) {
+	now := l.opt.Clock.Now()
+	d := Decision{Limit: l.opt.Max}
+	l.store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+		s, ok := state.(*fixedWindowState)
+		if !ok {
+			s = &fixedWindowState{expiredAt: now.Add(l.opt.window())}
+		}
+		d.ResetAt = s.expiredAt
+		if s.count+n > l.opt.Max {
+			d.Remaining = l.opt.Max - s.count
+			d.RetryAfter = s.expiredAt.Sub(now)
+			return s, s.expiredAt
 		}
-		e.count.Add(1)
-		return e.count.Load() <= l.max, nil
-	}
-	e := &Entry{ExpiredAt: time.Now().Add(time.Second * time.Duration(l.interval))}
-	e.count.Store(1)
-	l.entries[key] = e
-	l.m.Unlock()
-	return true, nil
+		s.count += n
+		d.Allowed = true
+		d.Remaining = l.opt.Max - s.count
+		return s, s.expiredAt
+	})
+	return d, nil
+}
+
+func (l *localRateLimiter) reset(key string) error {
+	l.store.delete(key)
+	return nil
 }
@@ -0,0 +1,109 @@
+package ratelimiter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"service_template/pkg/cache"
+	"time"
+)
+
+// 滑动日志：记录窗口内每个请求的时间戳，精确但占用内存与请求数成正比
+const slidingLogScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if n > max
+then
+	return {0, max - count, window, window}
+end
+if count + n > max
+then
+	-- 需要等待最早的 count + n - max 个请求移出窗口
+	local idx = count + n - max - 1
+	local oldest = redis.call('ZRANGE', KEYS[1], idx, idx, 'WITHSCORES')
+	local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+	return {0, max - count, tonumber(newest[2]) + window - now, tonumber(oldest[2]) + window - now}
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, max - count - n, window, 0}
+`
+
+type redisSlidingLog struct {
+	rdb *cache.Redis
+	opt Option
+}
+
+func (r *redisSlidingLog) allowN(key string, n int64) (Decision, error) {
+	member, err := randomMember()
+	if err != nil {
+		return Decision{}, err
+	}
+	now := r.opt.Clock.Now()
+	return evalDecision(r.rdb, r.opt.Max, now, slidingLogScript, []string{key},
+		now.UnixMilli(), r.opt.window().Milliseconds(), r.opt.Max, n, member)
+}
+
+func (r *redisSlidingLog) reset(key string) error {
+	return resetRedis(r.rdb, key)
+}
+
+type localSlidingLog struct {
+	store *localStore
+	opt   Option
+}
+
+func (l *localSlidingLog) allowN(key string, n int64) (Decision, error) {
+	now := l.opt.Clock.Now()
+	window := l.opt.window()
+	boundary := now.Add(-window)
+	d := Decision{Limit: l.opt.Max}
+	l.store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+		log, _ := state.([]time.Time)
+		i := 0
+		for i < len(log) && !log[i].After(boundary) {
+			i++
+		}
+		log = log[i:]
+		count := int64(len(log))
+		d.Remaining = l.opt.Max - count
+		switch {
+		case n > l.opt.Max:
+			d.ResetAt = now.Add(window)
+			d.RetryAfter = window
+		case count+n > l.opt.Max:
+			d.ResetAt = log[count-1].Add(window)
+			d.RetryAfter = log[count+n-l.opt.Max-1].Add(window).Sub(now)
+		default:
+			for j := int64(0); j < n; j++ {
+				log = append(log, now)
+			}
+			d.Allowed = true
+			d.Remaining -= n
+			d.ResetAt = now.Add(window)
+		}
+		if len(log) == 0 {
+			return nil, now
+		}
+		return log, log[len(log)-1].Add(window)
+	})
+	return d, nil
+}
+
+func (l *localSlidingLog) reset(key string) error {
+	l.store.delete(key)
+	return nil
+}
+
+func randomMember() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,129 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math"
+	"service_template/pkg/cache"
+	"time"
+)
+
+// 滑动窗口计数：按上一窗口计数在当前时刻的剩余占比加权估算，内存固定
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local elapsed = now % window
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+local estimate = prev * (window - elapsed) / window + curr
+if n > max
+then
+	return {0, math.floor(max - estimate), window, window}
+end
+if estimate + n > max
+then
+	local retry
+	if curr + n <= max
+	then
+		retry = window * (1 - (max - curr - n) / prev) - elapsed
+	else
+		retry = window - elapsed + math.max(0, window * (1 - (max - n) / curr))
+	end
+	local reset = window - elapsed
+	if curr > 0
+	then
+		reset = reset + window
+	end
+	return {0, math.max(0, math.floor(max - estimate)), math.ceil(reset), math.ceil(retry)}
+end
+redis.call('INCRBY', KEYS[1], n)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {1, math.max(0, math.floor(max - estimate - n)), 2 * window - elapsed, 0}
+`
+
+type redisSlidingWindow struct {
+	rdb *cache.Redis
+	opt Option
+}
+
+func (r *redisSlidingWindow) allowN(key string, n int64) (Decision, error) {
+	now := r.opt.Clock.Now()
+	window := r.opt.window().Milliseconds()
+	idx := now.UnixMilli() / window
+	keys := []string{fmt.Sprintf("%s:%d", key, idx), fmt.Sprintf("%s:%d", key, idx-1)}
+	return evalDecision(r.rdb, r.opt.Max, now, slidingWindowScript, keys, now.UnixMilli(), window, r.opt.Max, n)
+}
+
+// reset 删除当前窗口和上一个窗口的计数
+func (r *redisSlidingWindow) reset(key string) error {
+	idx := r.opt.Clock.Now().UnixMilli() / r.opt.window().Milliseconds()
+	return resetRedis(r.rdb, fmt.Sprintf("%s:%d", key, idx), fmt.Sprintf("%s:%d", key, idx-1))
+}
+
+type slidingWindowState struct {
+	// 当前窗口的起始时间
+	start      time.Time
+	prev, curr int64
+}
+
+type localSlidingWindow struct {
+	store *localStore
+	opt   Option
+}
+
+func (l *localSlidingWindow) allowN(key string, n int64) (Decision, error) {
+	now := l.opt.Clock.Now()
+	window := l.opt.window()
+	start := now.Truncate(window)
+	max := float64(l.opt.Max)
+	d := Decision{Limit: l.opt.Max}
+	l.store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+		s, ok := state.(*slidingWindowState)
+		if !ok {
+			s = &slidingWindowState{start: start}
+		}
+		switch {
+		case s.start.Equal(start):
+		case s.start.Add(window).Equal(start):
+			s.prev, s.curr = s.curr, 0
+			s.start = start
+		default:
+			s.prev, s.curr = 0, 0
+			s.start = start
+		}
+		elapsed := now.Sub(start)
+		estimate := float64(s.prev)*float64(window-elapsed)/float64(window) + float64(s.curr)
+		switch {
+		case n > l.opt.Max:
+			d.Remaining = int64(math.Max(0, max-estimate))
+			d.ResetAt = now.Add(window)
+			d.RetryAfter = window
+		case estimate+float64(n) > max:
+			var retry float64
+			if s.curr+n <= l.opt.Max {
+				retry = float64(window)*(1-(max-float64(s.curr+n))/float64(s.prev)) - float64(elapsed)
+			} else {
+				retry = float64(window-elapsed) + math.Max(0, float64(window)*(1-(max-float64(n))/float64(s.curr)))
+			}
+			d.Remaining = int64(math.Max(0, max-estimate))
+			d.ResetAt = start.Add(window)
+			if s.curr > 0 {
+				d.ResetAt = d.ResetAt.Add(window)
+			}
+			d.RetryAfter = time.Duration(math.Ceil(retry))
+		default:
+			s.curr += n
+			d.Allowed = true
+			d.Remaining = int64(math.Max(0, max-estimate-float64(n)))
+			d.ResetAt = start.Add(2 * window)
+		}
+		return s, s.start.Add(2 * window)
+	})
+	return d, nil
+}
+
+func (l *localSlidingWindow) reset(key string) error {
+	l.store.delete(key)
+	return nil
+}
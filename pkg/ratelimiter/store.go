@@ -0,0 +1,136 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	storeShards = 64
+	// 默认最多保存的 key 数量
+	defaultMaxEntries = 100000
+	// 每次访问最多顺带清理的过期 key 数量
+	sweepBatch = 8
+	// 每个分片完整清理过期 key 的间隔
+	fullSweepInterval = time.Minute
+)
+
+// localStore 本地限流器按 key 保存的状态。
+// 按 key 分片以减少锁竞争，每个分片按 LRU 顺序淘汰超出容量的 key。
+// 多数算法的过期时间随访问向后推移，LRU 尾部通常最早过期，每次访问时从尾部顺带清理；
+// 固定窗口等算法的过期时间不随访问推移，尾部的 key 未过期时前面仍可能有过期的 key，
+// 因此每个分片在访问时按 fullSweepInterval 完整清理一次，无需后台协程。
+type localStore struct {
+	shards [storeShards]*storeShard
+}
+
+type storeShard struct {
+	m        sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// 头部为最近访问的 key
+	lru *list.List
+	// 上次完整清理的时间
+	sweptAt time.Time
+}
+
+type storeEntry struct {
+	key      string
+	state    interface{}
+	expireAt time.Time
+}
+
+func newLocalStore(maxEntries int) *localStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	capacity := (maxEntries + storeShards - 1) / storeShards
+	s := &localStore{}
+	for i := range s.shards {
+		s.shards[i] = &storeShard{
+			capacity: capacity,
+			entries:  make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+	}
+	return s
+}
+
+func (s *localStore) shard(key string) *storeShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()%storeShards]
+}
+
+// update 在分片锁内读取并更新 key 对应的状态。
+// state 不存在或已过期时为 nil，fn 返回新的状态及其过期时间。
+func (s *localStore) update(key string, now time.Time, fn func(state interface{}) (interface{}, time.Time)) {
+	sh := s.shard(key)
+	sh.m.Lock()
+	defer sh.m.Unlock()
+	var e *storeEntry
+	if el, ok := sh.entries[key]; ok {
+		e = el.Value.(*storeEntry)
+		if !e.expireAt.After(now) {
+			e.state = nil
+		}
+		sh.lru.MoveToFront(el)
+	} else {
+		e = &storeEntry{key: key}
+		sh.entries[key] = sh.lru.PushFront(e)
+	}
+	e.state, e.expireAt = fn(e.state)
+	sh.sweep(now)
+}
+
+// delete 删除 key 对应的状态
+func (s *localStore) delete(key string) {
+	sh := s.shard(key)
+	sh.m.Lock()
+	defer sh.m.Unlock()
+	if el, ok := sh.entries[key]; ok {
+		sh.lru.Remove(el)
+		delete(sh.entries, key)
+	}
+}
+
+// len 当前保存的 key 数量
+func (s *localStore) len() int {
+	n := 0
+	for _, sh := range s.shards {
+		sh.m.Lock()
+		n += len(sh.entries)
+		sh.m.Unlock()
+	}
+	return n
+}
+
+// sweep 从 LRU 尾部淘汰超出容量或已过期的 key，并定期完整清理过期 key
+func (sh *storeShard) sweep(now time.Time) {
+	for i := 0; i < sweepBatch; i++ {
+		el := sh.lru.Back()
+		if el == nil {
+			break
+		}
+		e := el.Value.(*storeEntry)
+		if len(sh.entries) <= sh.capacity && e.expireAt.After(now) {
+			break
+		}
+		sh.lru.Remove(el)
+		delete(sh.entries, e.key)
+	}
+	if now.Sub(sh.sweptAt) < fullSweepInterval {
+		return
+	}
+	sh.sweptAt = now
+	for el := sh.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if e := el.Value.(*storeEntry); !e.expireAt.After(now) {
+			sh.lru.Remove(el)
+			delete(sh.entries, e.key)
+		}
+		el = prev
+	}
+}
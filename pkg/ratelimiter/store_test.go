@@ -0,0 +1,154 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreBounded(t *testing.T) {
+	store := newLocalStore(1000)
+	now := time.Now()
+	for i := 0; i < 100000; i++ {
+		store.update(fmt.Sprintf("%d", i), now, func(state interface{}) (interface{}, time.Time) {
+			return i, now.Add(time.Hour)
+		})
+	}
+	// 按分片向上取整
+	if n := store.len(); n > 1024 {
+		t.Fatalf("store grows beyond max entries: %d", n)
+	}
+}
+
+func TestLocalStoreLRU(t *testing.T) {
+	store := newLocalStore(2 * storeShards)
+	now := time.Now()
+	set := func(key string) {
+		store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+			if state == nil {
+				return 1, now.Add(time.Hour)
+			}
+			return state.(int) + 1, now.Add(time.Hour)
+		})
+	}
+	get := func(key string) interface{} {
+		var v interface{}
+		store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+			v = state
+			return state, now.Add(time.Hour)
+		})
+		return v
+	}
+	set("hot")
+	sh := store.shard("hot")
+	// 向同一分片写入其他 key，hot 持续被访问不应被淘汰
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("%d", i)
+		if store.shard(key) != sh {
+			continue
+		}
+		set("hot")
+		set(key)
+	}
+	if v := get("hot"); v == nil {
+		t.Fatal("recently used key evicted")
+	}
+}
+
+func TestLocalStoreExpire(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(t, Option{Algorithm: AlgorithmFixedWindow, Max: 1, Interval: 1, Clock: clock}, nil).(*limiter)
+	store := l.allower.(*localRateLimiter).store
+	for i := 0; i < 1000; i++ {
+		_, _ = l.CanPass(fmt.Sprintf("%d", i))
+	}
+	if n := store.len(); n != 1000 {
+		t.Fatalf("expect 1000 keys, got %d", n)
+	}
+	clock.Advance(2 * time.Second)
+	// 访问新 key 时顺带清理过期 key
+	for i := 0; i < 1000; i++ {
+		_, _ = l.CanPass(fmt.Sprintf("new:%d", i))
+	}
+	if n := store.len(); n > 1000+storeShards {
+		t.Fatalf("expired keys not swept, %d keys left", n)
+	}
+}
+
+func TestLocalStoreFullSweep(t *testing.T) {
+	store := newLocalStore(0)
+	now := time.Now()
+	set := func(key string, ttl time.Duration) {
+		store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+			return 1, now.Add(ttl)
+		})
+	}
+	// 尾部的 key 未过期，前面的 key 已过期
+	set("long", time.Hour)
+	sh := store.shard("long")
+	n := 0
+	for i := 0; n < 100; i++ {
+		key := fmt.Sprintf("%d", i)
+		if store.shard(key) == sh {
+			set(key, time.Second)
+			n++
+		}
+	}
+	now = now.Add(fullSweepInterval)
+	set("long", time.Hour)
+	if n := len(sh.entries); n != 1 {
+		t.Fatalf("expired keys behind an unexpired tail not swept, %d keys left", n)
+	}
+}
+
+func TestLocalLimiterConcurrent(t *testing.T) {
+	for _, alg := range []string{AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmTokenBucket, AlgorithmGCRA} {
+		l := newTestLimiter(t, Option{Algorithm: alg, Max: 100, Interval: 60}, nil)
+		var (
+			wg   sync.WaitGroup
+			m    sync.Mutex
+			pass int
+		)
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					ok, err := l.CanPass("same")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if ok {
+						m.Lock()
+						pass++
+						m.Unlock()
+					}
+					_, _ = l.CanPass(fmt.Sprintf("%d", rand.Intn(1000)))
+				}
+			}()
+		}
+		wg.Wait()
+		if pass != 100 {
+			t.Fatalf("%s: expect 100 requests passed, got %d", alg, pass)
+		}
+	}
+}
+
+func BenchmarkLocalLimiter(b *testing.B) {
+	for _, alg := range []string{AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmTokenBucket, AlgorithmGCRA} {
+		b.Run(alg, func(b *testing.B) {
+			l := newTestLimiter(b, Option{Algorithm: alg, Max: 10, Interval: 60, MaxEntries: 10000}, nil)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := l.CanPass(fmt.Sprintf("%d", rand.Intn(100000)))
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimiter
+
+import (
+	"math"
+	"service_template/pkg/cache"
+	"time"
+)
+
+// 令牌桶：以 Max/Interval 的速率补充令牌，桶容量为 Burst
+const tokenBucketScript = `
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local n = tonumber(ARGV[5])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil
+then
+	tokens = capacity
+	ts = now
+end
+if now > ts
+then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+local allowed = 0
+local retry = 0
+if tokens >= n
+then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, math.floor(tokens), math.ceil((capacity - tokens) / rate), retry}
+`
+
+type redisTokenBucket struct {
+	rdb *cache.Redis
+	opt Option
+}
+
+func (r *redisTokenBucket) allowN(key string, n int64) (Decision, error) {
+	now := r.opt.Clock.Now()
+	rate := tokenRate(r.opt) / 1000
+	ttl := int64(math.Ceil(float64(r.opt.Burst)/rate)) + 1
+	return evalDecision(r.rdb, r.opt.Burst, now, tokenBucketScript, []string{key},
+		now.UnixMilli(), rate, r.opt.Burst, ttl, n)
+}
+
+func (r *redisTokenBucket) reset(key string) error {
+	return resetRedis(r.rdb, key)
+}
+
+// tokenRate 每秒补充的令牌数
+func tokenRate(opt Option) float64 {
+	return float64(opt.Max) / float64(opt.Interval)
+}
+
+type tokenBucketState struct {
+	tokens float64
+	last   time.Time
+}
+
+type localTokenBucket struct {
+	store *localStore
+	opt   Option
+}
+
+func (l *localTokenBucket) allowN(key string, n int64) (Decision, error) {
+	now := l.opt.Clock.Now()
+	rate := tokenRate(l.opt)
+	capacity := float64(l.opt.Burst)
+	d := Decision{Limit: l.opt.Burst}
+	l.store.update(key, now, func(state interface{}) (interface{}, time.Time) {
+		s, ok := state.(*tokenBucketState)
+		if !ok {
+			s = &tokenBucketState{tokens: capacity, last: now}
+		}
+		if now.After(s.last) {
+			s.tokens = math.Min(capacity, s.tokens+now.Sub(s.last).Seconds()*rate)
+			s.last = now
+		}
+		if s.tokens >= float64(n) {
+			s.tokens -= float64(n)
+			d.Allowed = true
+		} else {
+			d.RetryAfter = secondsToDuration((float64(n) - s.tokens) / rate)
+		}
+		d.Remaining = int64(s.tokens)
+		d.ResetAt = now.Add(secondsToDuration((capacity - s.tokens) / rate))
+		return s, d.ResetAt
+	})
+	return d, nil
+}
+
+func (l *localTokenBucket) reset(key string) error {
+	l.store.delete(key)
+	return nil
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,72 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header 请求 ID 的请求头和响应头
+const Header = "X-Request-ID"
+
+// maxLength 客户端传入的请求 ID 的最大长度
+const maxLength = 128
+
+type contextKey struct{}
+
+// New 生成 32 位十六进制的请求 ID
+func New() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid 只接受长度有限的可见 ASCII 字符，避免日志注入
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext 返回 ctx 中的请求 ID，没有时返回空字符串
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+type roundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	id := FromContext(r.Context())
+	if id == "" || r.Header.Get(Header) != "" {
+		return t.next.RoundTrip(r)
+	}
+	// RoundTripper 不能修改原请求
+	r = r.Clone(r.Context())
+	r.Header.Set(Header, id)
+	return t.next.RoundTrip(r)
+}
+
+// RoundTripper 返回将请求 context 中的请求 ID 传递给下游的 RoundTripper，next 为 nil 时使用 http.DefaultTransport
+func RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &roundTripper{next: next}
+}
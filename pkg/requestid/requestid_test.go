@@ -0,0 +1,63 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	if id := New(); len(id) != 32 || !Valid(id) {
+		t.Fatalf("unexpected generated id %q", id)
+	}
+	for _, id := range []string{"", "a b", "a\nb", "中文", strings.Repeat("a", maxLength+1)} {
+		if Valid(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+	if !Valid("trace-1:abc_2.3") {
+		t.Fatal("expected valid id")
+	}
+}
+
+func TestContext(t *testing.T) {
+	if FromContext(context.Background()) != "" {
+		t.Fatal("expected empty id")
+	}
+	if id := FromContext(NewContext(context.Background(), "abc")); id != "abc" {
+		t.Fatalf("expected abc, got %q", id)
+	}
+}
+
+func TestRoundTripper(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(Header))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: RoundTripper(nil)}
+	do := func(ctx context.Context, header string) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if header != "" {
+			req.Header.Set(Header, header)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return req
+	}
+	ctx := NewContext(context.Background(), "abc")
+	req := do(ctx, "")
+	if req.Header.Get(Header) != "" {
+		t.Fatal("original request should not be modified")
+	}
+	do(ctx, "explicit")
+	do(context.Background(), "")
+	if len(got) != 3 || got[0] != "abc" || got[1] != "explicit" || got[2] != "" {
+		t.Fatalf("unexpected downstream ids %q", got)
+	}
+}
@@ -0,0 +1,366 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HmacSha256 = "hmac-sha256"
+	HmacSha512 = "hmac-sha512"
+
+	// FormatFull 签名方法、路径、查询参数、指定的请求头、时间戳、nonce 和 body 的哈希
+	FormatFull = "full"
+	// FormatBody 只签名时间戳、nonce 和 body，用于只能签名 body 的 webhook
+	FormatBody = "body"
+
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrUnknownClient    = errors.New("unknown client")
+	ErrTimestampSkew    = errors.New("timestamp out of window")
+	ErrReplayed         = errors.New("nonce replayed")
+	ErrBodyTooLarge     = errors.New("body too large")
+)
+
+type Option struct {
+	ClientHeader    string `json:"client_header" yaml:"client_header"`
+	TimestampHeader string `json:"timestamp_header" yaml:"timestamp_header"`
+	NonceHeader     string `json:"nonce_header" yaml:"nonce_header"`
+	SignatureHeader string `json:"signature_header" yaml:"signature_header"`
+	// hmac-sha256 / hmac-sha512，默认 hmac-sha256
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// hex / base64，默认 hex
+	Encoding string `json:"encoding" yaml:"encoding"`
+	// full / body，默认 full
+	Format string `json:"format" yaml:"format"`
+	// format 为 full 时参与签名的请求头
+	SignedHeaders []string `json:"signed_headers" yaml:"signed_headers"`
+	// 允许的时钟偏差，单位秒，默认 300
+	Skew int `json:"skew" yaml:"skew"`
+	// 校验时读取 body 的最大字节数，默认 1MB
+	MaxBodySize int64 `json:"max_body_size" yaml:"max_body_size"`
+	// 客户端 ID 与密钥，一个客户端可配置多个密钥用于轮换
+	Clients map[string][]string `json:"clients" yaml:"clients"`
+}
+
+func (opt *Option) setDefault() {
+	if opt.ClientHeader == "" {
+		opt.ClientHeader = "X-Client-Id"
+	}
+	if opt.TimestampHeader == "" {
+		opt.TimestampHeader = "X-Timestamp"
+	}
+	if opt.NonceHeader == "" {
+		opt.NonceHeader = "X-Nonce"
+	}
+	if opt.SignatureHeader == "" {
+		opt.SignatureHeader = "X-Signature"
+	}
+	if opt.Algorithm == "" {
+		opt.Algorithm = HmacSha256
+	}
+	if opt.Encoding == "" {
+		opt.Encoding = EncodingHex
+	}
+	if opt.Format == "" {
+		opt.Format = FormatFull
+	}
+	if opt.Skew <= 0 {
+		opt.Skew = 300
+	}
+	if opt.MaxBodySize <= 0 {
+		opt.MaxBodySize = 1 << 20
+	}
+}
+
+func (opt *Option) validate() error {
+	switch opt.Algorithm {
+	case HmacSha256, HmacSha512:
+	default:
+		return fmt.Errorf("unsupported signature algorithm %s", opt.Algorithm)
+	}
+	switch opt.Encoding {
+	case EncodingHex, EncodingBase64:
+	default:
+		return fmt.Errorf("unsupported signature encoding %s", opt.Encoding)
+	}
+	switch opt.Format {
+	case FormatFull, FormatBody:
+	default:
+		return fmt.Errorf("unsupported signature format %s", opt.Format)
+	}
+	return nil
+}
+
+func (opt *Option) hash() func() hash.Hash {
+	if opt.Algorithm == HmacSha512 {
+		return sha512.New
+	}
+	return sha256.New
+}
+
+// readBody 读取 body 并重新写回请求，使后续处理仍可读取，limit 大于 0 时限制读取的字节数
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	reader := r.Body
+	if limit > 0 {
+		reader = http.MaxBytesReader(nil, r.Body, limit)
+	}
+	body, err := io.ReadAll(reader)
+	_ = r.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, ErrBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// canonicalQuery 按参数名和值排序
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Canonical 返回待签名的字符串
+func (opt *Option) Canonical(r *http.Request, body []byte, timestamp, nonce string) string {
+	if opt.Format == FormatBody {
+		return timestamp + "\n" + nonce + "\n" + string(body)
+	}
+	sum := sha256.Sum256(body)
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(r.Method))
+	b.WriteString("\n")
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+	b.WriteString("\n")
+	b.WriteString(canonicalQuery(r.URL.Query()))
+	b.WriteString("\n")
+	for _, h := range opt.SignedHeaders {
+		b.WriteString(strings.ToLower(h))
+		b.WriteString(":")
+		b.WriteString(strings.TrimSpace(r.Header.Get(h)))
+		b.WriteString("\n")
+	}
+	b.WriteString(timestamp)
+	b.WriteString("\n")
+	b.WriteString(nonce)
+	b.WriteString("\n")
+	b.WriteString(hex.EncodeToString(sum[:]))
+	return b.String()
+}
+
+func (opt *Option) sign(secret, canonical string) []byte {
+	mac := hmac.New(opt.hash(), []byte(secret))
+	mac.Write([]byte(canonical))
+	return mac.Sum(nil)
+}
+
+func (opt *Option) encode(sig []byte) string {
+	if opt.Encoding == EncodingBase64 {
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	return hex.EncodeToString(sig)
+}
+
+func (opt *Option) decode(sig string) ([]byte, error) {
+	if opt.Encoding == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(sig)
+	}
+	return hex.DecodeString(sig)
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Signer 为发出的请求签名
+type Signer struct {
+	opt      Option
+	clientId string
+	secret   string
+	now      func() time.Time
+}
+
+func NewSigner(opt Option, clientId, secret string) (*Signer, error) {
+	opt.setDefault()
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	return &Signer{opt: opt, clientId: clientId, secret: secret, now: time.Now}, nil
+}
+
+// Sign 设置客户端 ID、时间戳、nonce 和签名请求头，需在设置完 SignedHeaders 后调用
+func (s *Signer) Sign(r *http.Request) error {
+	body, err := readBody(r, 0)
+	if err != nil {
+		return err
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	sig := s.opt.sign(s.secret, s.opt.Canonical(r, body, timestamp, nonce))
+	r.Header.Set(s.opt.ClientHeader, s.clientId)
+	r.Header.Set(s.opt.TimestampHeader, timestamp)
+	r.Header.Set(s.opt.NonceHeader, nonce)
+	r.Header.Set(s.opt.SignatureHeader, s.opt.encode(sig))
+	return nil
+}
+
+type roundTripper struct {
+	signer *Signer
+	next   http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTripper 不应修改传入的请求
+	r = r.Clone(r.Context())
+	if r.Body != nil && r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	if err := t.signer.Sign(r); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(r)
+}
+
+// RoundTripper 返回为每个请求签名的 RoundTripper，next 为 nil 时使用 http.DefaultTransport
+func (s *Signer) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &roundTripper{signer: s, next: next}
+}
+
+// NonceStore 记录已使用的 nonce，pkg/cache 中的缓存均满足该接口
+type NonceStore interface {
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+}
+
+// Verifier 校验请求签名
+type Verifier struct {
+	opt    Option
+	nonces NonceStore
+	now    func() time.Time
+}
+
+// NewVerifier nonces 为 nil 时不检查重放
+func NewVerifier(opt Option, nonces NonceStore) (*Verifier, error) {
+	opt.setDefault()
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	return &Verifier{opt: opt, nonces: nonces, now: time.Now}, nil
+}
+
+func nonceKey(clientId, nonce string) string {
+	return "signature_nonce:" + clientId + ":" + nonce
+}
+
+// Verify 校验签名，返回客户端 ID
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	clientId := r.Header.Get(v.opt.ClientHeader)
+	timestamp := r.Header.Get(v.opt.TimestampHeader)
+	nonce := r.Header.Get(v.opt.NonceHeader)
+	signature := r.Header.Get(v.opt.SignatureHeader)
+	if clientId == "" || timestamp == "" || nonce == "" || signature == "" {
+		return "", ErrMissingSignature
+	}
+	secrets, ok := v.opt.Clients[clientId]
+	if !ok || len(secrets) == 0 {
+		return clientId, ErrUnknownClient
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return clientId, ErrTimestampSkew
+	}
+	skew := v.now().Unix() - ts
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > int64(v.opt.Skew) {
+		return clientId, ErrTimestampSkew
+	}
+	sig, err := v.opt.decode(signature)
+	if err != nil {
+		return clientId, ErrInvalidSignature
+	}
+	body, err := readBody(r, v.opt.MaxBodySize)
+	if err != nil {
+		return clientId, err
+	}
+	canonical := v.opt.Canonical(r, body, timestamp, nonce)
+	valid := false
+	for _, secret := range secrets {
+		if hmac.Equal(sig, v.opt.sign(secret, canonical)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return clientId, ErrInvalidSignature
+	}
+	// 签名通过后再记录 nonce，避免伪造的请求占用 nonce
+	if v.nonces != nil {
+		// 超出时间窗口的请求会被拒绝，nonce 只需保存到窗口结束；并发的重放请求只有一个能写入
+		ok, err := v.nonces.SetNX(r.Context(), nonceKey(clientId, nonce), 1, 2*time.Duration(v.opt.Skew)*time.Second)
+		if err != nil {
+			return clientId, err
+		}
+		if !ok {
+			return clientId, ErrReplayed
+		}
+	}
+	return clientId, nil
+}
@@ -0,0 +1,183 @@
+package signature
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"service_template/pkg/cache"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newPair(t *testing.T, opt Option) (*Signer, *Verifier) {
+	opt.Clients = map[string][]string{"partner": {"new-secret", "old-secret"}}
+	nonces, _ := cache.NewInmemory(cache.Option{})
+	v, err := NewVerifier(opt, nonces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSigner(opt, "partner", "old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, v
+}
+
+func signedRequest(t *testing.T, s *Signer, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1&a=0", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if err := s.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	for _, opt := range []Option{
+		{},
+		{Algorithm: HmacSha512, Encoding: EncodingBase64, SignedHeaders: []string{"Content-Type"}},
+		{Format: FormatBody},
+	} {
+		s, v := newPair(t, opt)
+		r := signedRequest(t, s, `{"id":1}`)
+		clientId, err := v.Verify(r)
+		if err != nil || clientId != "partner" {
+			t.Fatalf("%+v: verify failed: %v", opt, err)
+		}
+		// body 仍可被后续处理读取
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"id":1}` {
+			t.Fatalf("body not restored: %s", body)
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	s, v := newPair(t, Option{SignedHeaders: []string{"Content-Type"}})
+	cases := map[string]func(r *http.Request){
+		"body": func(r *http.Request) {
+			r.Body = io.NopCloser(bytes.NewReader([]byte(`{"id":2}`)))
+		},
+		"query": func(r *http.Request) {
+			r.URL.RawQuery = "a=1&b=3"
+		},
+		"header": func(r *http.Request) {
+			r.Header.Set("Content-Type", "text/plain")
+		},
+		"method": func(r *http.Request) {
+			r.Method = http.MethodPut
+		},
+	}
+	for name, tamper := range cases {
+		r := signedRequest(t, s, `{"id":1}`)
+		tamper(r)
+		if _, err := v.Verify(r); err != ErrInvalidSignature {
+			t.Errorf("%s: expected invalid signature, got %v", name, err)
+		}
+	}
+	// 查询参数顺序不影响签名
+	r := signedRequest(t, s, `{"id":1}`)
+	r.URL.RawQuery = "a=0&a=1&b=2"
+	if _, err := v.Verify(r); err != nil {
+		t.Errorf("query order: %v", err)
+	}
+}
+
+func TestReplayAndSkew(t *testing.T) {
+	s, v := newPair(t, Option{Skew: 60})
+	r := signedRequest(t, s, "x")
+	replay := r.Clone(r.Context())
+	replay.Body = io.NopCloser(strings.NewReader("x"))
+	if _, err := v.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(replay); err != ErrReplayed {
+		t.Fatalf("expected replayed, got %v", err)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	if _, err := v.Verify(signedRequest(t, s, "x")); err != ErrTimestampSkew {
+		t.Fatalf("expected skew, got %v", err)
+	}
+	s.now = time.Now
+	r = signedRequest(t, s, "x")
+	r.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Add(time.Minute+10*time.Second).Unix(), 10))
+	if _, err := v.Verify(r); err != ErrTimestampSkew {
+		t.Fatalf("expected skew, got %v", err)
+	}
+}
+
+func TestConcurrentReplay(t *testing.T) {
+	s, v := newPair(t, Option{})
+	r := signedRequest(t, s, "x")
+	// 同一请求并发重放时只有一个通过
+	var passed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		replay := r.Clone(r.Context())
+		replay.Body = io.NopCloser(strings.NewReader("x"))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(replay); err == nil {
+				atomic.AddInt32(&passed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if passed != 1 {
+		t.Fatalf("expected exactly one request to pass, got %d", passed)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	s, v := newPair(t, Option{MaxBodySize: 8})
+	if _, err := v.Verify(signedRequest(t, s, "12345678")); err != nil {
+		t.Fatalf("body within limit rejected: %v", err)
+	}
+	if _, err := v.Verify(signedRequest(t, s, "123456789")); err != ErrBodyTooLarge {
+		t.Fatalf("expected body too large, got %v", err)
+	}
+}
+
+func TestUnknownClient(t *testing.T) {
+	_, v := newPair(t, Option{})
+	s, _ := NewSigner(Option{}, "other", "new-secret")
+	if _, err := v.Verify(signedRequest(t, s, "x")); err != ErrUnknownClient {
+		t.Fatalf("expected unknown client, got %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := v.Verify(r); err != ErrMissingSignature {
+		t.Fatalf("expected missing signature, got %v", err)
+	}
+	if _, err := NewVerifier(Option{Algorithm: "md5"}, nil); err == nil {
+		t.Fatal("expected unsupported algorithm")
+	}
+}
+
+func TestRoundTripper(t *testing.T) {
+	s, v := newPair(t, Option{})
+	var verifyErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, verifyErr = v.Verify(r)
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: s.RoundTripper(nil)}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/hook?x=1", strings.NewReader(`{"event":"paid"}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if verifyErr != nil {
+		t.Fatal(verifyErr)
+	}
+	if req.Header.Get("X-Signature") != "" {
+		t.Fatal("original request modified")
+	}
+}
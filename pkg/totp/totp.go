@@ -0,0 +1,155 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SHA1   = "SHA1"
+	SHA256 = "SHA256"
+	SHA512 = "SHA512"
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type Option struct {
+	// SHA1 / SHA256 / SHA512，默认 SHA1，多数验证器应用只支持 SHA1
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// 验证码位数，默认 6
+	Digits int `json:"digits" yaml:"digits"`
+	// 时间步长，单位秒，默认 30
+	Period int `json:"period" yaml:"period"`
+	// 允许前后偏差的步数，默认 1，小于 0 时不允许偏差
+	Skew int `json:"skew" yaml:"skew"`
+}
+
+// TOTP RFC 6238 基于时间的一次性密码
+type TOTP struct {
+	opt Option
+}
+
+func New(opt Option) (*TOTP, error) {
+	if opt.Algorithm == "" {
+		opt.Algorithm = SHA1
+	}
+	switch opt.Algorithm {
+	case SHA1, SHA256, SHA512:
+	default:
+		return nil, fmt.Errorf("unsupported totp algorithm %s", opt.Algorithm)
+	}
+	if opt.Digits == 0 {
+		opt.Digits = 6
+	}
+	if opt.Digits < 6 || opt.Digits > 10 {
+		return nil, fmt.Errorf("unsupported totp digits %d", opt.Digits)
+	}
+	if opt.Period <= 0 {
+		opt.Period = 30
+	}
+	if opt.Skew < 0 {
+		opt.Skew = 0
+	} else if opt.Skew == 0 {
+		opt.Skew = 1
+	}
+	return &TOTP{opt: opt}, nil
+}
+
+// GenerateSecret 生成 base32 编码的密钥，长度与算法的输出长度一致
+func (t *TOTP) GenerateSecret() (string, error) {
+	b := make([]byte, t.hash()().Size())
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+func (t *TOTP) hash() func() hash.Hash {
+	switch t.opt.Algorithm {
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// Step 返回时间所在的时间步
+func (t *TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.opt.Period)
+}
+
+// code RFC 4226 HOTP
+func (t *TOTP) code(key []byte, step int64) string {
+	mac := hmac.New(t.hash(), key)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := int64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	mod := int64(1)
+	for i := 0; i < t.opt.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.opt.Digits, value%mod)
+}
+
+// Code 返回指定时间的验证码
+func (t *TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return t.code(key, t.Step(at)), nil
+}
+
+// Validate 在偏差窗口内校验验证码，返回匹配的时间步，调用方应拒绝不大于上次使用的时间步以防重放
+func (t *TOTP) Validate(secret, code string, at time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != t.opt.Digits {
+		return 0, false
+	}
+	step := t.Step(at)
+	for i := -t.opt.Skew; i <= t.opt.Skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(t.code(key, step+int64(i))), []byte(code)) == 1 {
+			return step + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// URI 返回 otpauth:// 格式的配置地址，即验证器应用扫描的二维码内容
+func (t *TOTP) URI(issuer, account, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	if issuer != "" {
+		v.Set("issuer", issuer)
+	}
+	v.Set("algorithm", t.opt.Algorithm)
+	v.Set("digits", strconv.Itoa(t.opt.Digits))
+	v.Set("period", strconv.Itoa(t.opt.Period))
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
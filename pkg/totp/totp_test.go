@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的测试向量
+func TestRFC6238(t *testing.T) {
+	secrets := map[string]string{
+		SHA1:   "12345678901234567890",
+		SHA256: "12345678901234567890123456789012",
+		SHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	cases := []struct {
+		at   int64
+		algo string
+		code string
+	}{
+		{59, SHA1, "94287082"},
+		{59, SHA256, "46119246"},
+		{59, SHA512, "90693936"},
+		{1111111109, SHA1, "07081804"},
+		{1111111109, SHA256, "68084774"},
+		{1111111109, SHA512, "25091201"},
+		{1111111111, SHA1, "14050471"},
+		{1234567890, SHA1, "89005924"},
+		{2000000000, SHA1, "69279037"},
+		{20000000000, SHA1, "65353130"},
+		{20000000000, SHA256, "77737706"},
+		{20000000000, SHA512, "47863826"},
+	}
+	for _, tc := range cases {
+		totp, err := New(Option{Algorithm: tc.algo, Digits: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret := base32.StdEncoding.EncodeToString([]byte(secrets[tc.algo]))
+		code, err := totp.Code(secret, time.Unix(tc.at, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tc.code {
+			t.Errorf("%s at %d: got %s, want %s", tc.algo, tc.at, code, tc.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	totp, _ := New(Option{})
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := totp.Code(secret, now)
+	if step, ok := totp.Validate(secret, code, now); !ok || step != totp.Step(now) {
+		t.Fatal("current code rejected")
+	}
+	// 前后一个时间步内有效
+	if step, ok := totp.Validate(secret, code, now.Add(30*time.Second)); !ok || step != totp.Step(now) {
+		t.Fatal("code within skew rejected")
+	}
+	if _, ok := totp.Validate(secret, code, now.Add(90*time.Second)); ok {
+		t.Fatal("code outside skew accepted")
+	}
+	if _, ok := totp.Validate(secret, "12345", now); ok {
+		t.Fatal("short code accepted")
+	}
+	if _, ok := totp.Validate("not base32!", code, now); ok {
+		t.Fatal("invalid secret accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	totp, _ := New(Option{})
+	u, err := url.Parse(totp.URI("Service Template", "bob@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Service Template:bob@example.com" {
+		t.Fatalf("unexpected uri %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Service Template" || q.Get("digits") != "6" {
+		t.Fatalf("unexpected query %v", q)
+	}
+}